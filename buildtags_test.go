@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// buildTags are the tags the README documents, alone, together and with
+// the pure Go zlib backend
+var buildTags = []string{
+	"nowriter",
+	"noreport",
+	"noarchive",
+	"purego",
+	"nowriter,noreport,noarchive",
+	"nowriter,noreport,noarchive,purego",
+}
+
+func TestBuildTags(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the module once per tag")
+	}
+	goTool := filepath.Join(runtime.GOROOT(), "bin", "go")
+	for _, tags := range buildTags {
+		tags := tags
+		t.Run(tags, func(t *testing.T) {
+			t.Parallel()
+			out, err := exec.Command(goTool, "build", "-tags", tags, "./...").CombinedOutput()
+			if err != nil {
+				t.Errorf("go build -tags %s ./...: %v\n%s", tags, err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func percentOf(part, whole uint64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole) * 100
+}
+
+// dedupCmd represents the dedup command
+var dedupCmd = &cobra.Command{
+	Use:   "dedup <old> <new>",
+	Short: "report the overlap of two generations of packs",
+	Long:  `report how many objects and bytes of the new packs the old ones already have, each a pack directory or a single pack`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		stats, err := pack.CompareGenerations(args[0], args[1])
+		if err != nil {
+			log.Printf(catalog.Format(catalog.DedupFailed), err)
+			os.Exit(1)
+		}
+		log.Printf(catalog.Format(catalog.DedupGen), "old", stats.OldObjects, stats.OldBytes)
+		log.Printf(catalog.Format(catalog.DedupGen), "new", stats.NewObjects, stats.NewBytes)
+		log.Printf(catalog.Format(catalog.DedupShare), "common objects", stats.CommonObjects, stats.CommonBytes,
+			percentOf(stats.CommonBytes, stats.NewBytes))
+		log.Printf(catalog.Format(catalog.DedupShare), "identical entries", stats.SameEntries, stats.SameEntryBytes,
+			percentOf(stats.SameEntryBytes, stats.NewBytes))
+		log.Printf(catalog.Format(catalog.DedupShare), "new only", stats.NewOnlyObjects, stats.NewOnlyBytes,
+			percentOf(stats.NewOnlyBytes, stats.NewBytes))
+		log.Printf(catalog.Format(catalog.DedupShare), "old only", stats.OldOnlyObjects, stats.OldOnlyBytes,
+			percentOf(stats.OldOnlyBytes, stats.OldBytes))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dedupCmd)
+}
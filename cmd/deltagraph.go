@@ -0,0 +1,62 @@
+//go:build !noreport
+
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var deltaGraphFormat string
+var deltaGraphObjectsDir string
+
+// deltaGraphCmd represents the delta-graph command
+var deltaGraphCmd = &cobra.Command{
+	Use:   "delta-graph <pack>",
+	Short: "export the delta chains of a pack as a graph",
+	Long:  `print the deltas of a pack and the bases they need as a DOT or JSON graph, with an edge from each delta to its base, to see why resolving it is slow or needs much memory`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var opts []pack.Option
+		if deltaGraphObjectsDir != "" {
+			opts = append(opts, pack.WithObjectSource(pack.NewLooseObjectSource(deltaGraphObjectsDir)))
+		}
+		graph, err := pack.DeltaGraphOf(args[0], opts...)
+		if graph != nil {
+			var writeErr error
+			switch deltaGraphFormat {
+			case "dot":
+				writeErr = graph.WriteDOT(os.Stdout)
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				writeErr = enc.Encode(graph)
+			default:
+				writeErr = fmt.Errorf("unknown format %q", deltaGraphFormat)
+			}
+			if writeErr != nil {
+				err = writeErr
+			}
+		}
+		if err != nil {
+			log.Printf(catalog.Format(catalog.DeltaGraphFailed), err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deltaGraphCmd)
+
+	deltaGraphCmd.Flags().StringVar(&deltaGraphFormat, "format", "dot", "output format, dot or json")
+	deltaGraphCmd.Flags().StringVar(&deltaGraphObjectsDir, "objects-dir", "", "look up the bases of a thin pack in this .git/objects directory")
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/pack"
+	"github.com/adlternative/git-miner/pkg/packfs"
+	log "github.com/sirupsen/logrus"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var exportFormat string
+var exportRoot string
+var exportNoVerify bool
+var exportCRLF bool
+var exportLFSObjects string
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export <pack> <dest>",
+	Short: "extract the objects or worktrees of a pack",
+	Long: `verify a pack and its idx, then write what is below --root in the view mount shows, e.g.
+commits/<oid> for the worktree of a commit, into the directory dest (--format dir) or the tar
+archive dest, - for stdout (--format tar), or write every object into the objects directory
+dest as a loose object (--format loose). --crlf and --lfs-objects make worktrees read like a
+checkout, loose objects keep the content they hash to.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		packPath, dest := args[0], args[1]
+		if !exportNoVerify {
+			if err := pack.Verify(packPath); err != nil {
+				log.Printf(catalog.Format(catalog.VerifyFailed), err)
+				os.Exit(1)
+			}
+		}
+		fsys, err := packfs.New(packPath, transformerOptions(exportCRLF, exportLFSObjects)...)
+		if err != nil {
+			log.Printf(catalog.Format(catalog.ExportFailed), err)
+			os.Exit(1)
+		}
+		defer fsys.Close()
+
+		switch exportFormat {
+		case "dir":
+			err = fsys.Extract(dest, exportRoot)
+		case "tar":
+			err = exportTar(fsys, dest)
+		case "loose":
+			err = fsys.WriteLoose(dest)
+		default:
+			err = fmt.Errorf("unknown format %q", exportFormat)
+		}
+		if err != nil {
+			log.Printf(catalog.Format(catalog.ExportFailed), err)
+			os.Exit(1)
+		}
+		if dest != "-" {
+			log.Printf(catalog.Format(catalog.Exported), dest)
+		}
+	},
+}
+
+// transformerOptions returns the options passing worktree blobs through the
+// transformers the --crlf and --lfs-objects flags ask for
+func transformerOptions(crlf bool, lfsObjects string) []packfs.Option {
+	var opts []packfs.Option
+	if crlf {
+		opts = append(opts, packfs.WithTransformer(packfs.CRLF))
+	}
+	if lfsObjects != "" {
+		opts = append(opts, packfs.WithTransformer(packfs.LFS(packfs.LFSObjects(lfsObjects))))
+	}
+	return opts
+}
+
+func exportTar(fsys *packfs.FS, dest string) error {
+	if dest == "-" {
+		return fsys.WriteTar(os.Stdout, exportRoot)
+	}
+	file, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if err := fsys.WriteTar(file, exportRoot); err != nil {
+		file.Close()
+		os.Remove(dest)
+		return err
+	}
+	return file.Close()
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVar(&exportFormat, "format", "dir", "what to write, dir, tar or loose")
+	exportCmd.Flags().StringVar(&exportRoot, "root", ".", "with dir and tar, the part of the view to write, e.g. commits/<oid>")
+	exportCmd.Flags().BoolVar(&exportNoVerify, "no-verify", false, "skip verifying the pack first, for one verified before")
+	exportCmd.Flags().BoolVar(&exportCRLF, "crlf", false, "check worktree text files out with CRLF line ends, like core.autocrlf=true")
+	exportCmd.Flags().StringVar(&exportLFSObjects, "lfs-objects", "", "replace Git LFS pointers in worktrees with their objects from this .git/lfs/objects directory")
+}
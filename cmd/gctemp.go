@@ -0,0 +1,50 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var tempExpire time.Duration
+var tempDryRun bool
+
+// gcTempCmd represents the gc-temp command
+var gcTempCmd = &cobra.Command{
+	Use:   "gc-temp",
+	Short: "remove stale temporary pack files",
+	Long:  `remove tmp_pack_, tmp_idx_ and similar files left behind by interrupted writers`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		stale, err := pack.FindStaleTempFiles(args[0], tempExpire)
+		if err != nil {
+			log.Printf(catalog.Format(catalog.TempFailed), err)
+			os.Exit(1)
+		}
+		for _, path := range stale {
+			if tempDryRun {
+				log.Printf(catalog.Format(catalog.TempWouldRm), path)
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				log.Printf(catalog.Format(catalog.TempRmFailed), path, err)
+				os.Exit(1)
+			}
+			log.Printf(catalog.Format(catalog.TempRemoved), path)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcTempCmd)
+
+	gcTempCmd.Flags().DurationVar(&tempExpire, "older-than", pack.DefaultTempExpire, "only remove files last modified longer ago than this")
+	gcTempCmd.Flags().BoolVarP(&tempDryRun, "dry-run", "n", false, "only report what would be removed")
+}
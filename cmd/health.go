@@ -0,0 +1,70 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var staleSlack time.Duration
+var healthCheckIdx bool
+var healthMaxOpenPacks int
+
+// healthCmd represents the health command
+var healthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "report on the packs of a pack directory",
+	Long:  `report the age of every pack and its idx, rev and bitmap, and flag sidecars older than their pack, or with --check-idx an idx which does not fit its pack`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ages, err := pack.PackAges(args[0], staleSlack)
+		if err != nil {
+			log.Printf(catalog.Format(catalog.HealthFailed), err)
+			os.Exit(1)
+		}
+		if healthCheckIdx {
+			pack.CheckIdx(ages, pack.WithFileBudget(pack.NewFileBudget(healthMaxOpenPacks)))
+		}
+		stale := 0
+		for _, age := range ages {
+			log.Printf(catalog.Format(catalog.HealthPack), age.Path, age.ModTime.Format(time.RFC3339))
+			for _, sidecar := range age.Sidecars {
+				switch {
+				case !sidecar.Exists:
+					log.Printf(catalog.Format(catalog.HealthMissing), sidecar.Ext)
+				case sidecar.Stale:
+					log.Printf(catalog.Format(catalog.HealthStale), sidecar.Ext,
+						sidecar.ModTime.Format(time.RFC3339), age.ModTime.Sub(sidecar.ModTime))
+				default:
+					log.Printf(catalog.Format(catalog.HealthSidecar), sidecar.Ext, sidecar.ModTime.Format(time.RFC3339))
+				}
+			}
+			if age.IdxMismatch != nil {
+				log.Printf(catalog.Format(catalog.HealthIdxMismatch), age.IdxMismatch)
+			}
+			if age.Stale() {
+				stale++
+			}
+		}
+		if stale > 0 {
+			log.Printf(catalog.Format(catalog.HealthSummary), stale, len(ages))
+			os.Exit(1)
+		}
+		log.Printf(catalog.Format(catalog.HealthOK), len(ages))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(healthCmd)
+
+	healthCmd.Flags().BoolVar(&healthCheckIdx, "check-idx", false, "open every pack with its idx to check that they fit")
+	healthCmd.Flags().IntVar(&healthMaxOpenPacks, "max-open-packs", 0, "with --check-idx, keep at most this many pack files open (default: half the open file limit)")
+	healthCmd.Flags().DurationVar(&staleSlack, "slack", pack.DefaultStaleSlack, "how much older than its pack a sidecar may be before it is stale")
+}
@@ -0,0 +1,32 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// idxCmd represents the idx command
+var idxCmd = &cobra.Command{
+	Use:   "idx <idx>",
+	Short: "check a pack idx without its pack",
+	Long:  `check the structure, sort order and checksum of a pack .idx, and of the .rev next to it, without the pack being there`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := pack.VerifyIdx(args[0]); err != nil {
+			log.Printf(catalog.Format(catalog.VerifyFailed), err)
+			os.Exit(1)
+		}
+		log.Printf(catalog.Format(catalog.VerifyOK), args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(idxCmd)
+}
@@ -4,6 +4,7 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"github.com/adlternative/git-miner/pkg/catalog"
 	"github.com/adlternative/git-miner/pkg/index"
 	log "github.com/sirupsen/logrus"
 	"os"
@@ -19,10 +20,10 @@ var indexCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := index.Verify(args[0]); err != nil {
-			log.Printf("verify failed: %v\n", err)
+			log.Printf(catalog.Format(catalog.VerifyFailed), err)
 			os.Exit(1)
 		}
-		log.Printf("%s ok", args[0])
+		log.Printf(catalog.Format(catalog.VerifyOK), args[0])
 
 	},
 }
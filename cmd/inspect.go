@@ -0,0 +1,94 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/oid"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var inspectBytes int
+
+func spaced(b []byte) string {
+	var parts []string
+	for _, c := range b {
+		parts = append(parts, fmt.Sprintf("%02x", c))
+	}
+	return strings.Join(parts, " ")
+}
+
+func inspectEntry(packPath string, at string) error {
+	source, err := pack.NewPackObjectSource(packPath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	offset, err := strconv.ParseUint(at, 10, 64)
+	if err != nil {
+		id, parseErr := oid.FromHex(at)
+		if parseErr != nil {
+			return fmt.Errorf("%s is neither an offset nor an object id", at)
+		}
+		if offset, err = source.Offset(id); err != nil {
+			return err
+		}
+	}
+
+	info, err := source.Inspect(offset, inspectBytes)
+	if info == nil {
+		return err
+	}
+	field := func(name string, format string, a ...interface{}) {
+		log.Printf(catalog.Format(catalog.InspectField), name, fmt.Sprintf(format, a...))
+	}
+	field("offset", "%d, %d bytes packed", info.Offset, info.PackedSize)
+	field("header", "%s: type %s, size %d", spaced(info.SizeBytes), info.Type, info.Size)
+	switch info.Type {
+	case pack.ObjOfsDelta:
+		field("base", "%s: distance %d, offset %d", spaced(info.BaseBytes), info.Offset-info.BaseOffset, info.BaseOffset)
+	case pack.ObjRefDelta:
+		field("base", "oid %s, offset %d", info.BaseOid, info.BaseOffset)
+	}
+	field("oid", "%s", info.Oid)
+	if info.HasIdxCRC {
+		field("crc32", "%08x, idx has %08x", info.CRC32, info.IdxCRC32)
+	} else {
+		field("crc32", "%08x", info.CRC32)
+	}
+	if info.Type.IsDelta() {
+		field("delta", "base size %d, result size %d", info.DeltaBaseSize, info.DeltaResultSize)
+	}
+	log.Printf(catalog.Format(catalog.InspectDump), len(info.Data), hex.Dump(info.Data))
+	return err
+}
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <pack> <offset|oid>",
+	Short: "decode a single pack entry",
+	Long:  `print the header fields and bytes, the base pointer, the delta header and the first inflated bytes of a pack entry`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := inspectEntry(args[0], args[1]); err != nil {
+			log.Printf(catalog.Format(catalog.InspectFailed), err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+
+	inspectCmd.Flags().IntVar(&inspectBytes, "bytes", 64, "how many inflated bytes to dump")
+}
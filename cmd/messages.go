@@ -0,0 +1,33 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/adlternative/git-miner/pkg/catalog"
+	log "github.com/sirupsen/logrus"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// messagesCmd represents the messages command
+var messagesCmd = &cobra.Command{
+	Use:   "messages",
+	Short: "print the message catalog",
+	Long:  `print the message catalog as JSON, a starting point for a --messages file`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(catalog.Messages()); err != nil {
+			log.Printf(catalog.Format(catalog.MessagesFailed), err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(messagesCmd)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/midx"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var midxBitmap string
+var midxBaseline string
+var midxMaxOpenPacks int
+
+// midxCmd represents the midx command
+var midxCmd = &cobra.Command{
+	Use:   "midx",
+	Short: "check multi-pack-index format",
+	Long:  `check multi-pack-index format and cross-check its packs and its bitmap`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		budget := pack.NewFileBudget(midxMaxOpenPacks)
+		if err := midx.Verify(args[0], midxBitmap, loadBaseline(midxBaseline), budget); err != nil {
+			log.Printf(catalog.Format(catalog.VerifyFailed), err)
+			os.Exit(1)
+		}
+		log.Printf(catalog.Format(catalog.VerifyOK), args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(midxCmd)
+
+	midxCmd.Flags().StringVar(&midxBaseline, "baseline", "", "JSON file of acknowledged inconsistencies that do not fail the check")
+	midxCmd.Flags().IntVar(&midxMaxOpenPacks, "max-open-packs", 0, "keep at most this many pack files open, closing the least recently read (default: half the open file limit)")
+	midxCmd.Flags().StringVar(&midxBitmap, "bitmap", "", "bitmap file to check (default: the one next to the multi-pack-index)")
+}
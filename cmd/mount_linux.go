@@ -0,0 +1,70 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/pack"
+	"github.com/adlternative/git-miner/pkg/packfs"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var mountNoVerify bool
+var mountCRLF bool
+var mountLFSObjects string
+
+// mountCmd represents the mount command
+var mountCmd = &cobra.Command{
+	Use:   "mount <pack> <dir>",
+	Short: "browse a pack as a read-only filesystem",
+	Long:  `verify a pack and its idx, then mount them read-only at dir through FUSE, with the content of each object under objects/<oid> and the worktree of each commit under commits/<oid>, to browse recovered content with normal tools without extracting everything`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		packPath, dir := args[0], args[1]
+		if !mountNoVerify {
+			if err := pack.Verify(packPath); err != nil {
+				log.Printf(catalog.Format(catalog.VerifyFailed), err)
+				os.Exit(1)
+			}
+		}
+		fsys, err := packfs.New(packPath, transformerOptions(mountCRLF, mountLFSObjects)...)
+		if err != nil {
+			log.Printf(catalog.Format(catalog.MountFailed), err)
+			os.Exit(1)
+		}
+		defer fsys.Close()
+		server, err := packfs.Mount(fsys, dir)
+		if err != nil {
+			log.Printf(catalog.Format(catalog.MountFailed), err)
+			os.Exit(1)
+		}
+		log.Printf(catalog.Format(catalog.Mounted), packPath, dir)
+
+		// no temporary files to remove here, a signal unmounts instead
+		signal.Reset(os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		go func() {
+			for range signals {
+				if err := server.Unmount(); err != nil {
+					log.Printf(catalog.Format(catalog.UnmountFailed), dir, err)
+				}
+			}
+		}()
+		server.Wait()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mountCmd)
+
+	mountCmd.Flags().BoolVar(&mountNoVerify, "no-verify", false, "skip verifying the pack first, for one verified before")
+	mountCmd.Flags().BoolVar(&mountCRLF, "crlf", false, "check worktree text files out with CRLF line ends, like core.autocrlf=true")
+	mountCmd.Flags().StringVar(&mountLFSObjects, "lfs-objects", "", "replace Git LFS pointers in worktrees with their objects from this .git/lfs/objects directory")
+}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/object"
+	"github.com/adlternative/git-miner/pkg/oid"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var diffPacks []string
+var diffObjectsDir string
+
+type diffObject struct {
+	_type pack.ObjectType
+	data  []byte
+}
+
+// readDiffObject reads <pack>:<offset>, or an object id from the --pack
+// packs and the --objects-dir loose objects
+func readDiffObject(arg string) (*diffObject, error) {
+	if i := strings.LastIndexByte(arg, ':'); i > 0 {
+		offset, err := strconv.ParseUint(arg[i+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad offset in %s: %w", arg, err)
+		}
+		source, err := pack.NewPackObjectSource(arg[:i])
+		if err != nil {
+			return nil, err
+		}
+		defer source.Close()
+		_type, data, err := source.ReadObjectAt(offset)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", arg, err)
+		}
+		return &diffObject{_type, data}, nil
+	}
+
+	id, err := oid.FromHex(arg)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither an object id nor <pack>:<offset>", arg)
+	}
+	var sources []pack.ObjectSource
+	budget := pack.NewFileBudget(0)
+	for _, packPath := range diffPacks {
+		source, err := pack.NewPackObjectSource(packPath, pack.WithFileBudget(budget))
+		if err != nil {
+			return nil, err
+		}
+		defer source.Close()
+		sources = append(sources, source)
+	}
+	if diffObjectsDir != "" {
+		sources = append(sources, pack.NewLooseObjectSource(diffObjectsDir))
+	}
+	for _, source := range sources {
+		_type, data, err := source.ReadObject(id)
+		if err == nil {
+			return &diffObject{_type, data}, nil
+		} else if !errors.Is(err, pack.ErrObjectNotFound) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", pack.ErrObjectNotFound, arg)
+}
+
+func diffObjects(a, b *diffObject) ([]string, error) {
+	if a._type != b._type {
+		return []string{fmt.Sprintf("~ type: %s -> %s", a._type, b._type)}, nil
+	}
+	switch a._type {
+	case pack.ObjTree:
+		treeA, err := object.ParseTree(a.data)
+		if err != nil {
+			return nil, err
+		}
+		treeB, err := object.ParseTree(b.data)
+		if err != nil {
+			return nil, err
+		}
+		return object.DiffTrees(treeA, treeB), nil
+	case pack.ObjCommit, pack.ObjTag:
+		commitA, err := object.ParseCommit(a.data)
+		if err != nil {
+			return nil, err
+		}
+		commitB, err := object.ParseCommit(b.data)
+		if err != nil {
+			return nil, err
+		}
+		return object.DiffCommits(commitA, commitB), nil
+	}
+	return object.DiffBlobs(a.data, b.data), nil
+}
+
+// objDiffCmd represents the objdiff command
+var objDiffCmd = &cobra.Command{
+	Use:   "objdiff <object> <object>",
+	Short: "compare two objects",
+	Long: `compare two objects structurally: tree entries, commit and tag headers, or where blobs differ.
+An object is an object id, looked up in --pack and --objects-dir, or <pack>:<offset>.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var objects []*diffObject
+		for _, arg := range args {
+			obj, err := readDiffObject(arg)
+			if err != nil {
+				log.Printf(catalog.Format(catalog.ObjDiffFailed), err)
+				os.Exit(1)
+			}
+			objects = append(objects, obj)
+		}
+		lines, err := diffObjects(objects[0], objects[1])
+		if err != nil {
+			log.Printf(catalog.Format(catalog.ObjDiffFailed), err)
+			os.Exit(1)
+		}
+		if len(lines) == 0 {
+			log.Printf(catalog.Format(catalog.ObjDiffSame), objects[0]._type)
+			return
+		}
+		for _, line := range lines {
+			log.Printf(catalog.Format(catalog.ObjDiffLine), line)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(objDiffCmd)
+
+	objDiffCmd.Flags().StringSliceVar(&diffPacks, "pack", nil, "pack to look up object ids in, may be repeated")
+	objDiffCmd.Flags().StringVar(&diffObjectsDir, "objects-dir", "", "loose object directory to look up object ids in")
+}
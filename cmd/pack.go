@@ -4,28 +4,183 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/finding"
 	"github.com/adlternative/git-miner/pkg/pack"
 	log "github.com/sirupsen/logrus"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+var bigFileThreshold uint64
+var threads int
+var idle bool
+var idleMaxLoad float64
+var objectsDir string
+var fixThin string
+var inflater string
+var dropCache bool
+var networkFS bool
+var doubleRead bool
+var packFormat string
+var packBaseline string
+var samplePercent string
+var sampleSeed int64
+var progressInterval time.Duration
+var resumeState string
+var resumeBudget time.Duration
+var teePath string
+var writeMissing bool
+var writeBitmap bool
+var explain bool
+var maxErrors int
+var checkTrees bool
+var checkSignatures bool
+var checkText bool
+var severities string
+var checks string
+
 // packCmd represents the pack command
 var packCmd = &cobra.Command{
 	Use:   "pack",
 	Short: "check pack format",
-	Long:  `check git pack file format`,
+	Long:  `check git pack file format, or that of every pack in a tar, tar.gz or zip archive`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := pack.Verify(args[0]); err != nil {
-			log.Printf("verify failed: %v\n", err)
+		opts := []pack.Option{
+			pack.WithBigFileThreshold(bigFileThreshold),
+			pack.WithThreads(threads),
+			pack.WithIdle(idle, idleMaxLoad),
+			pack.WithDropCache(dropCache),
+			pack.WithNetworkFS(networkFS),
+			pack.WithDoubleRead(doubleRead),
+			pack.WithBaseline(loadBaseline(packBaseline)),
+			pack.WithProgress(progressInterval),
+			pack.WithWriteMissing(writeMissing || writeBitmap, writeBitmap),
+			pack.WithMaxErrors(maxErrors),
+			pack.WithTreeChecks(checkTrees),
+			pack.WithSignatureChecks(checkSignatures),
+			pack.WithTextChecks(checkText),
+		}
+		if inflater != "" {
+			backend, err := pack.LookupInflater(inflater)
+			if err != nil {
+				log.Printf(catalog.Format(catalog.BadOption), err)
+				os.Exit(1)
+			}
+			opts = append(opts, pack.WithInflater(backend))
+		}
+		var presets []string
+		if checks != "" {
+			presets = strings.Split(checks, ",")
+		}
+		presetOpts, err := pack.PresetOptions(presets, severities)
+		if err != nil {
+			log.Printf(catalog.Format(catalog.BadOption), err)
 			os.Exit(1)
 		}
-		log.Printf("%s ok", args[0])
+		opts = append(opts, presetOpts...)
+		if objectsDir != "" {
+			opts = append(opts, pack.WithObjectSource(pack.NewLooseObjectSource(objectsDir)))
+		}
+
+		if (maxErrors != 0 || resumeBudget != 0) && resumeState == "" {
+			err = fmt.Errorf("--max-errors and --budget only work with --resume")
+		} else if (writeMissing || writeBitmap) && (pack.IsArchive(args[0]) || fixThin != "" || samplePercent != "" || resumeState != "" || teePath != "" || packFormat != "text") {
+			err = fmt.Errorf("--write-missing and --write-bitmap only work with a plain verification of a pack file")
+		} else if pack.IsArchive(args[0]) {
+			if fixThin != "" || samplePercent != "" || resumeState != "" || teePath != "" || packFormat != "text" {
+				err = fmt.Errorf("--fix-thin, --sample, --resume, --tee and --format are not supported for archives")
+			} else {
+				err = verifyArchive(args[0], opts)
+			}
+		} else if teePath != "" {
+			if fixThin != "" || samplePercent != "" || resumeState != "" || packFormat != "text" {
+				err = fmt.Errorf("--tee cannot be combined with --fix-thin, --sample, --resume or --format")
+			} else {
+				err = verifyTo(args[0], teePath, opts)
+			}
+		} else if fixThin != "" {
+			err = fixThinPack(args[0], fixThin, opts)
+		} else if samplePercent != "" {
+			err = samplePack(args[0], opts)
+		} else if resumeState != "" {
+			var state *pack.ResumeState
+			state, err = pack.VerifyWindow(args[0], resumeState, resumeBudget, opts...)
+			if err == nil && state.Remaining > 0 {
+				// not done yet, the next window goes on
+				return
+			}
+		} else if packFormat == "json" {
+			err = printReport(args[0], opts)
+		} else if packFormat != "text" {
+			err = fmt.Errorf("unknown format %q", packFormat)
+		} else {
+			err = pack.Verify(args[0], opts...)
+		}
+		var known *finding.Finding
+		if errors.As(err, &known) && known.Known {
+			log.Printf(catalog.Format(catalog.VerifyKnown), err)
+			return
+		}
+		if err != nil {
+			log.Printf(catalog.Format(catalog.VerifyFailed), err)
+			if explain {
+				explainFailure(err)
+			}
+			os.Exit(1)
+		}
+		log.Printf(catalog.Format(catalog.VerifyOK), args[0])
 	},
 }
 
+func samplePack(packPath string, opts []pack.Option) error {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(samplePercent, "%"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return fmt.Errorf("bad --sample %q, want a percentage like 5%%", samplePercent)
+	}
+	seed := sampleSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return pack.Sample(packPath, percent, seed, opts...)
+}
+
 func init() {
 	rootCmd.AddCommand(packCmd)
+
+	packCmd.Flags().Uint64Var(&bigFileThreshold, "big-file-threshold", pack.DefaultBigFileThreshold,
+		"objects larger than this are inflated in chunks instead of in memory")
+	packCmd.Flags().IntVar(&threads, "threads", 0, "number of goroutines resolving objects (default: one per CPU, within the container CPU quota)")
+	packCmd.Flags().BoolVar(&idle, "idle", false, "give way to other work: fewer goroutines by default, yielding between objects")
+	packCmd.Flags().Float64Var(&idleMaxLoad, "max-load", 0, "with --idle, pause while the load average per CPU is above this")
+	packCmd.Flags().BoolVar(&dropCache, "drop-cache", false, "drop the pack from the page cache after verifying it")
+	packCmd.Flags().StringVar(&packFormat, "format", "text", "output format, text or json")
+	packCmd.Flags().DurationVar(&progressInterval, "progress", 0, "log throughput and an ETA this often, e.g. 1s")
+	packCmd.Flags().StringVar(&samplePercent, "sample", "", "only verify this percentage of the entries, picked at random through the idx")
+	packCmd.Flags().Int64Var(&sampleSeed, "seed", 0, "seed picking the --sample entries (default: random)")
+	packCmd.Flags().StringVar(&resumeState, "resume", "", "verify through the idx in windows, recording the progress in this JSON file")
+	packCmd.Flags().DurationVar(&resumeBudget, "budget", 0, "with --resume, stop the window after this long, verifying commits and trees, then the largest blobs first (default: no limit)")
+	packCmd.Flags().IntVar(&maxErrors, "max-errors", 0, "with --resume, end the window after this many failed entries (default: no limit)")
+	packCmd.Flags().StringVar(&packBaseline, "baseline", "", "JSON file of acknowledged findings that do not fail the check")
+	packCmd.Flags().BoolVar(&networkFS, "nfs", false, "harden reads for network filesystems")
+	packCmd.Flags().BoolVar(&doubleRead, "double-read", false, "read every entry twice and report differences as storage corruption")
+	packCmd.Flags().StringVar(&objectsDir, "objects-dir", "", "loose object directory to look up thin pack bases in")
+	packCmd.Flags().StringVar(&inflater, "inflater", "", fmt.Sprintf("zlib backend, one of %s", strings.Join(pack.InflaterNames(), ", ")))
+	packCmd.Flags().StringVar(&teePath, "tee", "", "copy the pack to this path while verifying it, kept only if it verifies")
+	packCmd.Flags().BoolVar(&writeMissing, "write-missing", false, "once the pack verified, write its idx and rev if they are missing")
+	packCmd.Flags().BoolVar(&writeBitmap, "write-bitmap", false, "write a missing bitmap as well, implies --write-missing")
+	packCmd.Flags().BoolVar(&checkTrees, "check-trees", false, "check the modes and symlinks of the tree entries, like git fsck")
+	packCmd.Flags().BoolVar(&checkSignatures, "check-signatures", false, "count the signed commits and tags and check the framing of their signatures")
+	packCmd.Flags().BoolVar(&checkText, "check-text", false, "check commit and tag messages and entry names for bad UTF-8, NUL and control characters")
+	packCmd.Flags().StringVar(&severities, "severity", "", "override the severity of findings by code, e.g. control-character=error,bad-encoding=ignore")
+	packCmd.Flags().StringVar(&checks, "checks", "", fmt.Sprintf("turn on the checks of these presets, comma separated: %s", strings.Join(pack.PresetNames(), ", ")))
+	packCmd.Flags().BoolVar(&explain, "explain", false, "on failure, explain in plain words what it means and what to do")
+	packCmd.Flags().StringVar(&fixThin, "fix-thin", "", "write the pack completed with its thin pack bases to this path")
 }
@@ -0,0 +1,14 @@
+//go:build !noarchive
+
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+func verifyArchive(archivePath string, opts []pack.Option) error {
+	return pack.VerifyArchive(archivePath, opts...)
+}
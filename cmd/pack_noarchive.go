@@ -0,0 +1,17 @@
+//go:build noarchive
+
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+var errNoArchive = errors.New("this build cannot read archives, the noarchive tag was given")
+
+func verifyArchive(archivePath string, opts []pack.Option) error {
+	return errNoArchive
+}
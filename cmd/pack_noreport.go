@@ -0,0 +1,23 @@
+//go:build noreport
+
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+)
+
+var errNoReport = errors.New("this build has no reports or explanations, the noreport tag was given")
+
+func explainFailure(err error) {
+	log.Printf(catalog.Format(catalog.BadOption), errNoReport)
+}
+
+func printReport(packPath string, opts []pack.Option) error {
+	return errNoReport
+}
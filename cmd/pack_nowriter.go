@@ -0,0 +1,18 @@
+//go:build nowriter
+
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+func verifyTo(packPath string, teePath string, opts []pack.Option) error {
+	return pack.ErrNoWriter
+}
+
+func fixThinPack(packPath string, fixThin string, opts []pack.Option) error {
+	return pack.ErrNoWriter
+}
@@ -0,0 +1,52 @@
+//go:build !noreport
+
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"strings"
+)
+
+var schemaVersion int
+
+// explainFailure spells out what a failed verification means for users who
+// are no git experts
+func explainFailure(err error) {
+	e := pack.Explain(err)
+	list := func(items []string) string {
+		var s strings.Builder
+		for _, item := range items {
+			fmt.Fprintf(&s, "  - %s\n", item)
+		}
+		return s.String()
+	}
+	log.Printf(catalog.Format(catalog.ExplainSummary), e.Class, e.Summary)
+	log.Printf(catalog.Format(catalog.ExplainCauses), list(e.Causes))
+	log.Printf(catalog.Format(catalog.ExplainSteps), list(e.NextSteps))
+}
+
+func printReport(packPath string, opts []pack.Option) error {
+	report, verifyErr := pack.VerifyReport(packPath, schemaVersion, opts...)
+	if report == nil {
+		return verifyErr
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+func init() {
+	packCmd.Flags().IntVar(&schemaVersion, "schema-version", pack.SchemaVersion,
+		fmt.Sprintf("schema version of the json output, one of %v", pack.SchemaVersions()))
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/finding"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var refsObjectsDir string
+var refsLazyIdx bool
+var refsMaxOpenPacks int
+
+// refsCmd represents the refs command
+var refsCmd = &cobra.Command{
+	Use:   "refs <advertisement> <pack-dir>",
+	Short: "check that a mirror has every ref of its remote complete",
+	Long:  `read the refs of a remote as git ls-remote prints them, from a file or - for stdin, and report those whose tips are missing from the packs of pack-dir or reach objects that are, e.g. git ls-remote origin | git miner refs - .git/objects/pack`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var in io.Reader = os.Stdin
+		if args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				log.Printf(catalog.Format(catalog.RefsFailed), err)
+				os.Exit(1)
+			}
+			defer file.Close()
+			in = file
+		}
+		refs, err := pack.ParseRefAdvertisement(in)
+		if err != nil {
+			log.Printf(catalog.Format(catalog.RefsFailed), err)
+			os.Exit(1)
+		}
+
+		opts := []pack.Option{pack.WithLazyIdx(refsLazyIdx)}
+		if refsMaxOpenPacks > 0 {
+			opts = append(opts, pack.WithFileBudget(pack.NewFileBudget(refsMaxOpenPacks)))
+		}
+		packs, err := pack.OpenPackDir(args[1], opts...)
+		if err != nil {
+			log.Printf(catalog.Format(catalog.RefsFailed), err)
+			os.Exit(1)
+		}
+		var sources []pack.ObjectSource
+		for _, source := range packs {
+			defer source.Close()
+			sources = append(sources, source)
+		}
+		if refsObjectsDir != "" {
+			sources = append(sources, pack.NewLooseObjectSource(refsObjectsDir))
+		}
+
+		findings, err := pack.CheckRefs(refs, sources...)
+		if err != nil {
+			log.Printf(catalog.Format(catalog.RefsFailed), err)
+			os.Exit(1)
+		}
+		for _, f := range findings {
+			log.Printf(catalog.Format(catalog.Finding), f.String())
+		}
+		log.Printf(catalog.Format(catalog.RefsChecked), len(refs)-len(findings), len(refs))
+		if finding.Failed(findings) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(refsCmd)
+
+	refsCmd.Flags().StringVar(&refsObjectsDir, "objects-dir", "", "look up objects in this .git/objects directory as well")
+	refsCmd.Flags().BoolVar(&refsLazyIdx, "lazy-idx", false, "check only the layout of each idx, not its checksum and order, to open many large ones quickly")
+	refsCmd.Flags().IntVar(&refsMaxOpenPacks, "max-open-packs", 0, "keep at most this many pack files open, closing the least recently read (default: half the open file limit)")
+}
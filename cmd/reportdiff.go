@@ -0,0 +1,70 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/finding"
+	log "github.com/sirupsen/logrus"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var reportDiffFormat string
+
+// reportDiffCmd represents the report-diff command
+var reportDiffCmd = &cobra.Command{
+	Use:   "report-diff <old> <new>",
+	Short: "compare the findings of two verification runs",
+	Long: `compare the findings of two JSON reports, or JSON arrays of findings, and list the new,
+resolved and unchanged ones. It fails when the new run has errors the old one did not, so that
+scheduled scrubs alert only on new corruption.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if reportDiffFormat != "text" && reportDiffFormat != "json" {
+			log.Printf(catalog.Format(catalog.BadOption), fmt.Errorf("unknown format %q", reportDiffFormat))
+			os.Exit(1)
+		}
+		oldFindings, err := finding.LoadFindings(args[0])
+		if err != nil {
+			log.Printf(catalog.Format(catalog.ReportDiffFailed), err)
+			os.Exit(1)
+		}
+		newFindings, err := finding.LoadFindings(args[1])
+		if err != nil {
+			log.Printf(catalog.Format(catalog.ReportDiffFailed), err)
+			os.Exit(1)
+		}
+		diff := finding.Compare(oldFindings, newFindings)
+
+		if reportDiffFormat == "text" {
+			for _, f := range diff.New {
+				log.Printf(catalog.Format(catalog.ReportDiffFinding), "new", f.String())
+			}
+			for _, f := range diff.Resolved {
+				log.Printf(catalog.Format(catalog.ReportDiffFinding), "resolved", f.String())
+			}
+			log.Printf(catalog.Format(catalog.ReportDiffSummary), len(diff.New), len(diff.Resolved), len(diff.Unchanged))
+		} else {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(diff); err != nil {
+				log.Printf(catalog.Format(catalog.ReportDiffFailed), err)
+				os.Exit(1)
+			}
+		}
+		if finding.Failed(diff.New) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportDiffCmd)
+
+	reportDiffCmd.Flags().StringVar(&reportDiffFormat, "format", "text", "output format, text or json")
+}
@@ -5,7 +5,12 @@ package cmd
 
 import (
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/finding"
+	"github.com/adlternative/git-miner/pkg/pack"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -20,12 +25,56 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	removeTempFilesOnSignal()
 	err := rootCmd.Execute()
 	if err != nil {
+		pack.RemoveTempFiles()
 		os.Exit(1)
 	}
 }
 
+// removeTempFilesOnSignal makes sure an interrupted writer leaves no
+// temporary files behind
+func removeTempFilesOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-signals
+		pack.RemoveTempFiles()
+		signal.Reset()
+		if s, ok := sig.(syscall.Signal); ok {
+			os.Exit(128 + int(s))
+		}
+		os.Exit(1)
+	}()
+}
+
+var messagesFile string
+
+// loadMessages swaps in the operator's message catalog
+func loadMessages() {
+	if messagesFile == "" {
+		return
+	}
+	if err := catalog.Load(messagesFile); err != nil {
+		log.Printf(catalog.Format(catalog.MessagesLoad), err)
+		os.Exit(1)
+	}
+}
+
+// loadBaseline loads the baseline file of a command, if it has one
+func loadBaseline(path string) *finding.Baseline {
+	if path == "" {
+		return nil
+	}
+	baseline, err := finding.LoadBaseline(path)
+	if err != nil {
+		log.Printf(catalog.Format(catalog.BadOption), err)
+		os.Exit(1)
+	}
+	return baseline
+}
+
 type myFormatter struct{}
 
 func (f *myFormatter) Format(entry *log.Entry) ([]byte, error) {
@@ -39,12 +88,13 @@ func initLog() {
 }
 
 func init() {
-	cobra.OnInitialize(initLog)
+	cobra.OnInitialize(initLog, loadMessages)
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.git-miner.yaml)")
+	rootCmd.PersistentFlags().StringVar(&messagesFile, "messages", "", "JSON file mapping message ids to replacement texts")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -0,0 +1,40 @@
+//go:build !nowriter
+
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/fuzz"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// seedCorpusCmd represents the seed-corpus command
+var seedCorpusCmd = &cobra.Command{
+	Use:   "seed-corpus <dir>",
+	Short: "write a corpus of small test packs",
+	Long: `write small good and deliberately damaged packs, listed in packs/MANIFEST, and seeds
+for the fuzz functions into dir. The output is the same on every run.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := fuzz.WritePackCorpus(filepath.Join(args[0], fuzz.PacksDir)); err != nil {
+			log.Printf(catalog.Format(catalog.CorpusFailed), err)
+			os.Exit(1)
+		}
+		if err := fuzz.WriteSeedCorpus(args[0]); err != nil {
+			log.Printf(catalog.Format(catalog.CorpusFailed), err)
+			os.Exit(1)
+		}
+		log.Printf(catalog.Format(catalog.CorpusWritten), args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(seedCorpusCmd)
+}
@@ -4,13 +4,13 @@ go 1.18
 
 require (
 	github.com/adlternative/git-zlib-cgo v0.0.0-20230313114948-7226d8eb5490
+	github.com/hanwen/go-fuse/v2 v2.5.1
 	github.com/sirupsen/logrus v1.9.0
 	github.com/spf13/cobra v1.6.1
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
-
 )
@@ -0,0 +1,178 @@
+package bitmap
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const Signature = 0x4249544d
+const headerSize = 4 + 2 + 2 + 4 + HashSize
+const HashSize = 20
+
+// MaxXorOffset is the farthest back an entry may reference for its xor base
+const MaxXorOffset = 160
+
+const (
+	OptFullDag     = 0x1
+	OptHashCache   = 0x4
+	OptLookupTable = 0x10
+)
+
+const lookupTableEntrySize = 4 + 8 + 4
+
+type Entry struct {
+	// ObjectPos is the position of the commit in the index (or MIDX) order
+	ObjectPos uint32
+	XorOffset uint8
+	Flags     uint8
+	offset    uint64
+
+	raw *Bitmap
+	// Bitmap is the entry's bitmap with the xor base applied
+	Bitmap *Bitmap
+}
+
+type File struct {
+	buf []byte
+
+	Version    uint16
+	Options    uint16
+	EntryCount uint32
+	// Checksum is the checksum of the pack or MIDX this bitmap belongs to
+	Checksum []byte
+
+	Commits *Bitmap
+	Trees   *Bitmap
+	Blobs   *Bitmap
+	Tags    *Bitmap
+
+	Entries []*Entry
+
+	// TrailerLen is the number of bytes between the last entry and the
+	// trailing checksum, i.e. the optional hash cache and lookup table.
+	TrailerLen uint64
+}
+
+func NewFile(fileName string) (*File, error) {
+	buf, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &File{
+		buf: buf,
+	}, nil
+}
+
+func (f *File) Parse() error {
+	if len(f.buf) < headerSize+HashSize {
+		return fmt.Errorf("bitmap file is too short")
+	}
+
+	if signature := binary.BigEndian.Uint32(f.buf[0:4]); signature != Signature {
+		return fmt.Errorf("bad bitmap signature %x", signature)
+	}
+	f.Version = binary.BigEndian.Uint16(f.buf[4:6])
+	if f.Version != 1 {
+		return fmt.Errorf("unsupported bitmap version %d", f.Version)
+	}
+	f.Options = binary.BigEndian.Uint16(f.buf[6:8])
+	f.EntryCount = binary.BigEndian.Uint32(f.buf[8:12])
+	f.Checksum = f.buf[12 : 12+HashSize]
+
+	trailerOffset := len(f.buf) - HashSize
+	sum := sha1.Sum(f.buf[:trailerOffset])
+	if !bytes.Equal(sum[:], f.buf[trailerOffset:]) {
+		return fmt.Errorf("bitmap checksum mismatch")
+	}
+
+	offset := headerSize
+	for _, b := range []**Bitmap{&f.Commits, &f.Trees, &f.Blobs, &f.Tags} {
+		bitmap, n, err := ParseEWAH(f.buf[offset:trailerOffset])
+		if err != nil {
+			return fmt.Errorf("parse type bitmap at %d failed: %w", offset, err)
+		}
+		*b = bitmap
+		offset += n
+	}
+
+	for i := uint32(0); i < f.EntryCount; i++ {
+		if offset+6 > trailerOffset {
+			return fmt.Errorf("too short bitmap entry %d header", i)
+		}
+		entry := &Entry{
+			ObjectPos: binary.BigEndian.Uint32(f.buf[offset : offset+4]),
+			XorOffset: f.buf[offset+4],
+			Flags:     f.buf[offset+5],
+			offset:    uint64(offset),
+		}
+		offset += 6
+
+		raw, n, err := ParseEWAH(f.buf[offset:trailerOffset])
+		if err != nil {
+			return fmt.Errorf("parse bitmap entry %d failed: %w", i, err)
+		}
+		offset += n
+		entry.raw = raw
+
+		if entry.XorOffset > MaxXorOffset || uint32(entry.XorOffset) > i {
+			return fmt.Errorf("bitmap entry %d has invalid xor offset %d", i, entry.XorOffset)
+		}
+		if entry.XorOffset == 0 {
+			entry.Bitmap = raw
+		} else {
+			entry.Bitmap = raw.Xor(f.Entries[i-uint32(entry.XorOffset)].Bitmap)
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+
+	f.TrailerLen = uint64(trailerOffset - offset)
+	return nil
+}
+
+// ExpectedTrailerLen returns how long TrailerLen should be for a bitmap
+// covering objectCount objects.
+func (f *File) ExpectedTrailerLen(objectCount uint32) uint64 {
+	var length uint64
+	if f.Options&OptHashCache != 0 {
+		length += uint64(objectCount) * 4
+	}
+	if f.Options&OptLookupTable != 0 {
+		length += uint64(f.EntryCount) * lookupTableEntrySize
+	}
+	return length
+}
+
+// Write writes the bitmap file of a pack of objectCount objects with the given
+// checksum. The type bitmaps and entries are in pack order, no entry is
+// xor'ed against another.
+func Write(w io.Writer, checksum []byte, objectCount uint32, commits, trees, blobs, tags *Bitmap, entries []*Entry) error {
+	buf := make([]byte, 8, headerSize)
+	binary.BigEndian.PutUint32(buf[0:4], Signature)
+	binary.BigEndian.PutUint16(buf[4:6], 1)
+	binary.BigEndian.PutUint16(buf[6:8], OptFullDag)
+	buf = appendUint32(buf, uint32(len(entries)))
+	buf = append(buf, checksum...)
+	for _, b := range []*Bitmap{commits, trees, blobs, tags} {
+		buf = b.AppendEWAH(buf, objectCount)
+	}
+	for _, entry := range entries {
+		buf = appendUint32(buf, entry.ObjectPos)
+		buf = append(buf, 0, entry.Flags)
+		buf = entry.Bitmap.AppendEWAH(buf, objectCount)
+	}
+	sum := sha1.Sum(buf)
+	buf = append(buf, sum[:]...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func (f *File) Show() {
+	log.Printf("[bitmap] version:%d, options:%#x, entries:%d, checksum:%x\n", f.Version, f.Options, f.EntryCount, f.Checksum)
+	log.Printf("[bitmap] commits:%d, trees:%d, blobs:%d, tags:%d\n", f.Commits.Count(), f.Trees.Count(), f.Blobs.Count(), f.Tags.Count())
+}
@@ -0,0 +1,206 @@
+package bitmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// Bitmap is an uncompressed bitmap, bit i lives in words[i/64] at bit i%64
+type Bitmap struct {
+	words []uint64
+}
+
+func (b *Bitmap) Get(pos uint32) bool {
+	i := pos / 64
+	if int(i) >= len(b.words) {
+		return false
+	}
+	return b.words[i]&(1<<(pos%64)) != 0
+}
+
+func (b *Bitmap) Set(pos uint32) {
+	i := int(pos / 64)
+	for i >= len(b.words) {
+		b.words = append(b.words, 0)
+	}
+	b.words[i] |= 1 << (pos % 64)
+}
+
+// Count returns the number of set bits
+func (b *Bitmap) Count() int {
+	count := 0
+	for _, w := range b.words {
+		count += bits.OnesCount64(w)
+	}
+	return count
+}
+
+// Each calls fn with the position of each set bit in ascending order
+func (b *Bitmap) Each(fn func(pos uint32)) {
+	for i, w := range b.words {
+		for w != 0 {
+			pos := uint32(i*64 + bits.TrailingZeros64(w))
+			fn(pos)
+			w &= w - 1
+		}
+	}
+}
+
+func (b *Bitmap) Xor(other *Bitmap) *Bitmap {
+	n := len(b.words)
+	if len(other.words) > n {
+		n = len(other.words)
+	}
+	words := make([]uint64, n)
+	copy(words, b.words)
+	for i, w := range other.words {
+		words[i] ^= w
+	}
+	return &Bitmap{words: words}
+}
+
+func (b *Bitmap) And(other *Bitmap) *Bitmap {
+	n := len(b.words)
+	if len(other.words) < n {
+		n = len(other.words)
+	}
+	words := make([]uint64, n)
+	for i := 0; i < n; i++ {
+		words[i] = b.words[i] & other.words[i]
+	}
+	return &Bitmap{words: words}
+}
+
+func (b *Bitmap) Or(other *Bitmap) *Bitmap {
+	n := len(b.words)
+	if len(other.words) > n {
+		n = len(other.words)
+	}
+	words := make([]uint64, n)
+	copy(words, b.words)
+	for i, w := range other.words {
+		words[i] |= w
+	}
+	return &Bitmap{words: words}
+}
+
+// ParseEWAH decodes an EWAH compressed bitmap and returns it with the number
+// of bytes consumed from buf.
+func ParseEWAH(buf []byte) (*Bitmap, int, error) {
+	if len(buf) < 8 {
+		return nil, 0, fmt.Errorf("too short ewah header")
+	}
+	bitSize := binary.BigEndian.Uint32(buf[0:4])
+	wordCount := binary.BigEndian.Uint32(buf[4:8])
+	length := 8 + uint64(wordCount)*8 + 4
+	if length > uint64(len(buf)) {
+		return nil, 0, fmt.Errorf("ewah with %d words overruns buffer", wordCount)
+	}
+
+	words := make([]uint64, wordCount)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint64(buf[8+i*8:])
+	}
+	rlwPos := binary.BigEndian.Uint32(buf[length-4:])
+	if wordCount > 0 && rlwPos >= wordCount {
+		return nil, 0, fmt.Errorf("ewah rlw position %d out of %d words", rlwPos, wordCount)
+	}
+
+	maxWords := (uint64(bitSize) + 63) / 64
+	out := make([]uint64, 0, maxWords)
+	for i := uint64(0); i < uint64(wordCount); {
+		rlw := words[i]
+		i++
+		runningBit := rlw&1 != 0
+		runningLen := (rlw >> 1) & 0xffffffff
+		literalWords := rlw >> 33
+
+		if uint64(len(out))+runningLen+literalWords > maxWords {
+			return nil, 0, fmt.Errorf("ewah expands beyond its %d bits", bitSize)
+		}
+		if i+literalWords > uint64(wordCount) {
+			return nil, 0, fmt.Errorf("ewah literal words overrun %d words", wordCount)
+		}
+
+		fill := uint64(0)
+		if runningBit {
+			fill = ^uint64(0)
+		}
+		for j := uint64(0); j < runningLen; j++ {
+			out = append(out, fill)
+		}
+		out = append(out, words[i:i+literalWords]...)
+		i += literalWords
+	}
+
+	return &Bitmap{words: out}, int(length), nil
+}
+
+// Max returns the highest set bit, ok is false for an empty bitmap
+func (b *Bitmap) Max() (pos uint32, ok bool) {
+	for i := len(b.words) - 1; i >= 0; i-- {
+		if b.words[i] != 0 {
+			return uint32(i*64 + 63 - bits.LeadingZeros64(b.words[i])), true
+		}
+	}
+	return 0, false
+}
+
+// maxRunningLen and maxLiteralWords are the limits of the fields of a run
+// length word
+const (
+	maxRunningLen   = 1<<32 - 1
+	maxLiteralWords = 1<<31 - 1
+)
+
+// AppendEWAH appends b EWAH compressed as a bitmap of bitSize bits, bits at
+// bitSize and above must be clear.
+func (b *Bitmap) AppendEWAH(buf []byte, bitSize uint32) []byte {
+	n := int((uint64(bitSize) + 63) / 64)
+	word := func(i int) uint64 {
+		if i < len(b.words) {
+			return b.words[i]
+		}
+		return 0
+	}
+
+	var words []uint64
+	rlwPos := 0
+	for i := 0; i < n; {
+		// a run of clean words, then the dirty words up to the next one
+		rlwPos = len(words)
+		fill := uint64(0)
+		if word(i) == ^uint64(0) {
+			fill = ^uint64(0)
+		}
+		runningLen := uint64(0)
+		for i < n && word(i) == fill && runningLen < maxRunningLen {
+			runningLen++
+			i++
+		}
+		literals := i
+		for i < n && i-literals < maxLiteralWords && word(i) != 0 && word(i) != ^uint64(0) {
+			i++
+		}
+		words = append(words, fill&1|runningLen<<1|uint64(i-literals)<<33)
+		for j := literals; j < i; j++ {
+			words = append(words, word(j))
+		}
+	}
+
+	buf = appendUint32(buf, bitSize)
+	buf = appendUint32(buf, uint32(len(words)))
+	for _, w := range words {
+		var raw [8]byte
+		binary.BigEndian.PutUint64(raw[:], w)
+		buf = append(buf, raw[:]...)
+	}
+	return appendUint32(buf, uint32(rlwPos))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	var raw [4]byte
+	binary.BigEndian.PutUint32(raw[:], v)
+	return append(buf, raw[:]...)
+}
@@ -0,0 +1,172 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ID names a message. IDs are stable, so scripts may match on them while
+// the text behind them is rewritten or translated.
+type ID string
+
+const (
+	VerifyOK          ID = "verify.ok"
+	VerifyFailed      ID = "verify.failed"
+	VerifyKnown       ID = "verify.known"
+	VerifySignatures  ID = "verify.signatures"
+	VerifyProducer    ID = "verify.producer"
+	BadOption         ID = "option.bad"
+	TempFailed        ID = "gc-temp.failed"
+	TempWouldRm       ID = "gc-temp.would-remove"
+	TempRmFailed      ID = "gc-temp.remove-failed"
+	TempRemoved       ID = "gc-temp.removed"
+	IdxChecked        ID = "idx.checked"
+	HealthFailed      ID = "health.failed"
+	HealthPack        ID = "health.pack"
+	HealthMissing     ID = "health.sidecar-missing"
+	HealthStale       ID = "health.sidecar-stale"
+	HealthSidecar     ID = "health.sidecar"
+	HealthIdxMismatch ID = "health.idx-mismatch"
+	HealthSummary     ID = "health.stale-summary"
+	HealthOK          ID = "health.ok"
+	SidecarWritten    ID = "write-missing.written"
+	ExplainSummary    ID = "explain.summary"
+	ExplainCauses     ID = "explain.causes"
+	ExplainSteps      ID = "explain.steps"
+	ThinAppended      ID = "fix-thin.appended"
+	DropCacheError    ID = "drop-cache.failed"
+	Finding           ID = "finding"
+	Sampled           ID = "sample.done"
+	ResumeWindow      ID = "resume.window"
+	MaxErrors         ID = "resume.max-errors"
+	Progress          ID = "progress"
+	ArchivePack       ID = "archive.pack"
+	DedupFailed       ID = "dedup.failed"
+	DedupGen          ID = "dedup.generation"
+	DedupShare        ID = "dedup.share"
+	ObjDiffFailed     ID = "objdiff.failed"
+	ObjDiffSame       ID = "objdiff.same"
+	ObjDiffLine       ID = "objdiff.line"
+	CorpusFailed      ID = "seed-corpus.failed"
+	CorpusWritten     ID = "seed-corpus.written"
+	DeltaGraphFailed  ID = "delta-graph.failed"
+	MountFailed       ID = "mount.failed"
+	Mounted           ID = "mount.mounted"
+	UnmountFailed     ID = "mount.unmount-failed"
+	RefsFailed        ID = "refs.failed"
+	RefsChecked       ID = "refs.checked"
+	MessagesFailed    ID = "messages.failed"
+	MessagesLoad      ID = "messages.load-failed"
+	ExportFailed      ID = "export.failed"
+	Exported          ID = "export.written"
+	InspectFailed     ID = "inspect.failed"
+	InspectField      ID = "inspect.field"
+	InspectDump       ID = "inspect.dump"
+	ReportDiffFailed  ID = "report-diff.failed"
+	ReportDiffFinding ID = "report-diff.finding"
+	ReportDiffSummary ID = "report-diff.summary"
+	PhaseDone         ID = "progress.phase-done"
+	PhaseShare        ID = "progress.phase-share"
+)
+
+// defaults are the built-in texts, fmt formats whose arguments are listed
+// next to each ID. An override may reorder them with %[n]v.
+var defaults = map[ID]string{
+	VerifyOK:          "%s ok",                                                                              // path
+	VerifyFailed:      "verify failed: %v\n",                                                                // error
+	VerifyKnown:       "verify stopped at a known finding: %v\n",                                            // error
+	VerifySignatures:  "%s: %d of %d commits and %d of %d tags signed, %d malformed\n",                      // path, signed commits, commits, signed tags, tags, malformed
+	VerifyProducer:    "%s was likely written by %s (%.0f%% of the heuristics agree): %s\n",                 // path, producer, confidence, evidence
+	BadOption:         "%v\n",                                                                               // error
+	TempFailed:        "gc-temp failed: %v\n",                                                               // error
+	TempWouldRm:       "would remove %s\n",                                                                  // path
+	TempRmFailed:      "remove %s failed: %v\n",                                                             // path, error
+	TempRemoved:       "removed %s\n",                                                                       // path
+	IdxChecked:        "%s: version %d idx of %d objects for pack %x, rev %s\n",                             // path, version, objects, pack checksum, "checked" or "missing"
+	HealthFailed:      "health failed: %v\n",                                                                // error
+	HealthPack:        "%s mtime=%s\n",                                                                      // pack path, mtime
+	HealthMissing:     "  %s missing\n",                                                                     // extension
+	HealthStale:       "  %s mtime=%s stale, %s older than the pack\n",                                      // extension, mtime, age
+	HealthSidecar:     "  %s mtime=%s\n",                                                                    // extension, mtime
+	HealthIdxMismatch: "  .idx does not fit the pack: %v\n",                                                 // error
+	HealthSummary:     "%d of %d packs have a stale or missing idx, rev or bitmap, or an idx not fitting\n", // stale, total
+	HealthOK:          "%d packs ok\n",                                                                      // total
+	SidecarWritten:    "wrote %s\n",                                                                         // path
+	ExplainSummary:    "%s: %s\n",                                                                           // class, summary
+	ExplainCauses:     "likely causes:\n%s",                                                                 // "  - cause" lines
+	ExplainSteps:      "what to do next:\n%s",                                                               // "  - step" lines
+	ThinAppended:      "appended %d bases to %s\n",                                                          // count, path
+	DropCacheError:    "drop page cache of %s failed: %v\n",                                                 // path, error
+	Finding:           "%v\n",                                                                               // finding
+	Sampled:           "verified %d of %d entries, seed %d\n",                                               // sampled, total, seed
+	ResumeWindow:      "verified %d of %d entries in this window, %d failed, %d left\n",                     // verified, total, failed, left
+	MaxErrors:         "stopping the window after %d failed entries\n",                                      // failed
+	Progress:          "%s: %d/%d objects (%.0f%%), %.0f objects/s, %.1f MiB/s, eta %s\n",                   // phase, done, total, percent, objects/s, MiB/s, eta
+	ArchivePack:       "verifying %s\n",                                                                     // archive:member
+	DedupFailed:       "dedup failed: %v\n",                                                                 // error
+	DedupGen:          "%s: %d objects, %d bytes\n",                                                         // generation, objects, bytes
+	DedupShare:        "%s: %d objects, %d bytes (%.1f%%)\n",                                                // what, objects, bytes, percent of its generation
+	ObjDiffFailed:     "objdiff failed: %v\n",                                                               // error
+	ObjDiffSame:       "the %s objects are the same\n",                                                      // type
+	ObjDiffLine:       "%s\n",                                                                               // difference
+	CorpusFailed:      "seed-corpus failed: %v\n",                                                           // error
+	CorpusWritten:     "wrote the corpus to %s\n",                                                           // dir
+	DeltaGraphFailed:  "delta-graph failed: %v\n",                                                           // error
+	MountFailed:       "mount failed: %v\n",                                                                 // error
+	Mounted:           "%s mounted read-only at %s, Ctrl-C or umount to end\n",                              // pack, dir
+	UnmountFailed:     "unmount %s failed, still serving: %v\n",                                             // dir, error
+	RefsFailed:        "refs failed: %v\n",                                                                  // error
+	RefsChecked:       "%d of %d refs are complete locally\n",                                               // complete refs, refs
+	MessagesFailed:    "messages failed: %v\n",                                                              // error
+	MessagesLoad:      "load messages failed: %v\n",                                                         // error
+	ExportFailed:      "export failed: %v\n",                                                                // error
+	Exported:          "wrote %s\n",                                                                         // dest
+	InspectFailed:     "inspect failed: %v\n",                                                               // error
+	InspectField:      "%s: %s\n",                                                                           // field, value
+	InspectDump:       "first %d bytes:\n%s",                                                                // length, hexdump
+	ReportDiffFailed:  "report-diff failed: %v\n",                                                           // error
+	ReportDiffFinding: "%s: %s\n",                                                                           // new or resolved, finding
+	ReportDiffSummary: "%d new, %d resolved, %d unchanged findings\n",                                       // counts
+	PhaseDone:         "%s done in %s, %.0f objects/s, %.1f MiB/s\n",                                        // phase, duration, objects/s, MiB/s
+	PhaseShare:        "%s took %.0f%% of the time\n",                                                       // phase, percent
+}
+
+var messages = defaults
+
+// Format returns the fmt format of the message id
+func Format(id ID) string {
+	return messages[id]
+}
+
+// Messages returns a copy of the catalog in use
+func Messages() map[ID]string {
+	copied := make(map[ID]string, len(messages))
+	for id, format := range messages {
+		copied[id] = format
+	}
+	return copied
+}
+
+// Load replaces messages with those of the JSON object in path, mapping IDs
+// to formats. Messages it leaves out keep their current text.
+func Load(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var overrides map[ID]string
+	if err := json.Unmarshal(b, &overrides); err != nil {
+		return fmt.Errorf("parse message catalog %s: %w", path, err)
+	}
+
+	loaded := Messages()
+	for id, format := range overrides {
+		if _, ok := defaults[id]; !ok {
+			return fmt.Errorf("message catalog %s: unknown message id %q", path, id)
+		}
+		loaded[id] = format
+	}
+	messages = loaded
+	return nil
+}
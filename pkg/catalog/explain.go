@@ -0,0 +1,168 @@
+package catalog
+
+import "strings"
+
+const (
+	refetch        = "fetch or copy the pack again from where it came from, then verify the new copy"
+	unpackRecover  = "to save what can be read, run git unpack-objects -r < the.pack in a scratch repository, it skips the objects it cannot read"
+	inspectFailing = "look at the failing entry with git-miner inspect <pack> <offset>"
+)
+
+// explanations are the default texts of the explanations of failures, keyed
+// by finding code, or by the code and a kind for the kinds of corrupt-pack
+// told apart. They are plain texts rather than formats; causes and steps
+// take one item per line.
+var explanations = map[string]struct {
+	class, summary string
+	causes, steps  []string
+}{
+	"pack-changed": {
+		class:   "pack changed",
+		summary: "the pack was modified or replaced while it was being read, so nothing can be concluded about its contents",
+		causes: []string{
+			"a git gc or git repack running at the same time replaced the pack",
+			"another process wrote to the file",
+		},
+		steps: []string{
+			"verify again once the repack or the writer is done",
+		},
+	},
+	"storage-corruption": {
+		class:   "storage corruption",
+		summary: "reading the same bytes of the pack twice gave different data, the pack file itself may well be fine",
+		causes: []string{
+			"a failing disk, controller or cable",
+			"faulty memory",
+			"a buggy filesystem or network filesystem cache",
+		},
+		steps: []string{
+			"check the health of the disk (e.g. smartctl) and the memory (e.g. memtest86+) of this machine",
+			"verify again on another machine to see whether the pack is really damaged",
+			"restore the repository from a backup taken on healthy hardware if the data is affected",
+		},
+	},
+	"corrupt-pack.not-pack": {
+		class:   "not a pack",
+		summary: "the file does not start like a git pack, or uses a pack version this tool does not know",
+		causes: []string{
+			"the wrong file was given, e.g. the .idx instead of the .pack",
+			"a download saved an error page or a Git LFS pointer instead of the pack",
+			"the start of the file was overwritten",
+		},
+		steps: []string{
+			"check what the file really is, e.g. with file the.pack or head -c 64 the.pack | xxd",
+			refetch,
+		},
+	},
+	"corrupt-pack.truncated": {
+		class:   "truncated",
+		summary: "the pack ends before all the objects its header promises, part of it is missing",
+		causes: []string{
+			"the download, push or copy was interrupted",
+			"the disk filled up while the pack was written",
+			"the machine crashed before the pack was flushed to disk",
+		},
+		steps: []string{
+			"compare the size of the file with the original",
+			refetch,
+			unpackRecover,
+		},
+	},
+	"corrupt-pack.checksum-mismatch": {
+		class:   "checksum mismatch",
+		summary: "every object could be read, but the checksum at the end of the pack does not match its content: some bytes changed after the pack was written",
+		causes: []string{
+			"bit rot: a few bits flipped on the disk or in memory",
+			"a bad transfer that altered bytes, e.g. a text mode FTP upload or a broken proxy",
+			"the trailer itself was damaged",
+		},
+		steps: []string{
+			refetch,
+			"check the health of the disk the pack was stored on",
+		},
+	},
+	"missing-object": {
+		class:   "missing object",
+		summary: "a delta needs a base object which the pack does not contain",
+		causes: []string{
+			"this is a thin pack, as git sends during a fetch or a push, which leaves out objects the receiver already has",
+			"the pack it depends on was deleted",
+		},
+		steps: []string{
+			"point --objects-dir at the objects directory of the repository the pack belongs to",
+			"complete the pack with --fix-thin and the same --objects-dir before storing it on its own",
+		},
+	},
+	"bad-delta": {
+		class:   "bad delta",
+		summary: "an object stored as a delta does not apply to its base object",
+		causes: []string{
+			"bit rot in the delta or in its base",
+			"a bad transfer",
+			"a bug in the tool that wrote the pack",
+		},
+		steps: []string{
+			inspectFailing,
+			refetch,
+			unpackRecover,
+		},
+	},
+	"rejected": {
+		class:   "rejected",
+		summary: "the pack is intact, but objects in it were rejected by a policy check",
+		causes: []string{
+			"the pack contains objects the configured checks do not allow",
+		},
+		steps: []string{
+			"read the reasons given for each rejected object",
+		},
+	},
+	"corrupt-pack": {
+		class:   "corrupt pack",
+		summary: "an entry of the pack cannot be decoded: its header, its compressed data or its object id is wrong",
+		causes: []string{
+			"bit rot: bits flipped on the disk or in memory",
+			"a bad transfer that altered bytes",
+			"the .idx does not belong to this pack, if the failure mentions the idx",
+			"a bug in the tool that wrote the pack",
+		},
+		steps: []string{
+			inspectFailing,
+			refetch,
+			"check the idx against the pack with git verify-pack -v the.idx, or rebuild it with git index-pack",
+			unpackRecover,
+		},
+	},
+}
+
+func init() {
+	for key, e := range explanations {
+		defaults[explainID(key, "class")] = e.class
+		defaults[explainID(key, "summary")] = e.summary
+		defaults[explainID(key, "causes")] = strings.Join(e.causes, "\n")
+		defaults[explainID(key, "steps")] = strings.Join(e.steps, "\n")
+	}
+}
+
+func explainID(key, part string) ID {
+	return ID("explain." + key + "." + part)
+}
+
+// Explanation returns the texts explaining a failure of key, a finding code
+// or a code and a kind like corrupt-pack.truncated, and false if the catalog
+// has none for it
+func Explanation(key string) (class, summary string, causes, steps []string, ok bool) {
+	class, ok = messages[explainID(key, "class")]
+	if !ok {
+		return "", "", nil, nil, false
+	}
+	return class, messages[explainID(key, "summary")],
+		lines(messages[explainID(key, "causes")]), lines(messages[explainID(key, "steps")]), true
+}
+
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
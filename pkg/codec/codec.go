@@ -0,0 +1,103 @@
+package codec
+
+import (
+	"errors"
+	"io"
+	"unsafe"
+)
+
+// ErrBadOfsDistance is an ofs-delta base distance overflowing 64 bits
+var ErrBadOfsDistance = errors.New("bad delta base object offset value")
+
+// ErrSizeOverflow is an entry size overflowing 64 bits
+var ErrSizeOverflow = errors.New("entry size does not fit in 64 bits")
+
+func MSB64(value uint64) uint8 {
+	size := unsafe.Sizeof(value) * 8
+	return uint8(value >> (size - 8))
+}
+
+// AppendEntryHeader appends the header of a pack entry to buf: the type in
+// bits 4 to 6 of the first byte, the low 4 bits of the size below it, and the
+// rest of the size 7 bits at a time while the top bit says more follow.
+func AppendEntryHeader(buf []byte, _type uint8, size uint64) []byte {
+	c := _type<<4 | byte(size&15)
+	size >>= 4
+	for size != 0 {
+		buf = append(buf, c|0x80)
+		c = byte(size & 0x7f)
+		size >>= 7
+	}
+	return append(buf, c)
+}
+
+// ReadEntryHeader reads the header of a pack entry, see AppendEntryHeader.
+// overlong is set when the size is encoded in more bytes than needed, which
+// git never writes.
+func ReadEntryHeader(r io.ByteReader) (_type uint8, size uint64, overlong bool, err error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	_type = (b >> 4) & 7
+	size = uint64(b & 15)
+	shift := uint(4)
+
+	for b&0x80 != 0 {
+		if shift >= 64 {
+			return 0, 0, false, ErrSizeOverflow
+		}
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, 0, false, err
+		}
+		// the byte at shift 60 has room for 4 bits only
+		if uint64(b&0x7f)>>(64-shift) != 0 {
+			return 0, 0, false, ErrSizeOverflow
+		}
+
+		size += (uint64(b) & 0x7f) << shift
+		shift += 7
+	}
+	return _type, size, shift > 4 && b == 0, nil
+}
+
+// AppendOfsDistance appends how far before an ofs-delta its base starts. Each
+// byte holds 7 bits, most significant first, and every continuation adds one
+// so that no distance has two encodings.
+func AppendOfsDistance(buf []byte, distance uint64) []byte {
+	var tmp [10]byte
+	pos := len(tmp) - 1
+	tmp[pos] = byte(distance & 127)
+	for distance >>= 7; distance != 0; distance >>= 7 {
+		distance--
+		pos--
+		tmp[pos] = 128 | byte(distance&127)
+	}
+	return append(buf, tmp[pos:]...)
+}
+
+// ReadOfsDistance reads an ofs-delta base distance, see AppendOfsDistance
+func ReadOfsDistance(r io.ByteReader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	distance := uint64(b & 127)
+	for b&128 != 0 {
+		distance++
+		// like git's MSB(distance, 7), the 7 bits shifted in next must fit
+		if distance == 0 || distance>>57 != 0 {
+			return 0, ErrBadOfsDistance
+		}
+
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+
+		distance = (distance << 7) + uint64(b&127)
+	}
+	return distance, nil
+}
@@ -0,0 +1,146 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestEntryHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []byte
+		_type    uint8
+		size     uint64
+		overlong bool
+		err      error
+	}{
+		{name: "zero", header: []byte{0x30}, _type: 3, size: 0},
+		{name: "4 bits", header: []byte{0x1f}, _type: 1, size: 15},
+		{name: "first continuation", header: []byte{0x90, 0x01}, _type: 1, size: 16},
+		{name: "2 bytes max", header: []byte{0xff, 0x7f}, _type: 7, size: 2047},
+		{name: "3 bytes min", header: []byte{0xa0, 0x80, 0x01}, _type: 2, size: 2048},
+		{name: "max", header: []byte{0xbf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x0f}, _type: 3, size: 1<<64 - 1},
+		{name: "overlong zero", header: []byte{0xb0, 0x00}, _type: 3, size: 0, overlong: true},
+		{name: "overlong", header: []byte{0xb5, 0x80, 0x00}, _type: 3, size: 5, overlong: true},
+		{name: "high zero byte", header: []byte{0xb0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, _type: 3, size: 0, overlong: true},
+		// the 10th byte lands at shift 60, 0x7f has bits past 64
+		{name: "overflow at shift 60", header: []byte{0xbf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, err: ErrSizeOverflow},
+		{name: "overflow by one bit", header: []byte{0xb0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x10}, err: ErrSizeOverflow},
+		{name: "continuation past 64 bits", header: []byte{0xb0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, err: ErrSizeOverflow},
+		{name: "empty", header: []byte{}, err: io.EOF},
+		{name: "truncated", header: []byte{0x90}, err: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.header)
+			_type, size, overlong, err := ReadEntryHeader(r)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("ReadEntryHeader(%x) error = %v, want %v", tt.header, err, tt.err)
+				}
+				return
+			}
+			if err != nil || _type != tt._type || size != tt.size || overlong != tt.overlong || r.Len() != 0 {
+				t.Fatalf("ReadEntryHeader(%x) = %d, %#x, %v, %v with %d bytes left, want %d, %#x, %v",
+					tt.header, _type, size, overlong, err, r.Len(), tt._type, tt.size, tt.overlong)
+			}
+			if tt.overlong {
+				return
+			}
+			if got := AppendEntryHeader(nil, tt._type, tt.size); !bytes.Equal(got, tt.header) {
+				t.Errorf("AppendEntryHeader(%d, %#x) = %x, want %x", tt._type, tt.size, got, tt.header)
+			}
+		})
+	}
+}
+
+// entryHeaderBoundaries returns the smallest size taking n header bytes for
+// every n, with the largest taking n-1 bytes, and the largest size
+func entryHeaderBoundaries() []uint64 {
+	sizes := []uint64{0, 1<<64 - 1}
+	for shift := uint(4); shift < 64; shift += 7 {
+		sizes = append(sizes, 1<<shift-1, 1<<shift)
+	}
+	return sizes
+}
+
+func TestEntryHeaderRoundTrip(t *testing.T) {
+	for _, size := range entryHeaderBoundaries() {
+		for _type := uint8(0); _type < 8; _type++ {
+			header := AppendEntryHeader([]byte("prefix"), _type, size)[len("prefix"):]
+			wantLen := 1
+			for rest := size >> 4; rest != 0; rest >>= 7 {
+				wantLen++
+			}
+			if len(header) != wantLen {
+				t.Errorf("AppendEntryHeader(%d, %#x) = %x, want %d bytes", _type, size, header, wantLen)
+			}
+			gotType, gotSize, overlong, err := ReadEntryHeader(bytes.NewReader(header))
+			if err != nil || gotType != _type || gotSize != size || overlong {
+				t.Errorf("ReadEntryHeader(%x) = %d, %#x, %v, %v, want %d, %#x", header, gotType, gotSize, overlong, err, _type, size)
+			}
+		}
+	}
+}
+
+func TestOfsDistance(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoded  []byte
+		distance uint64
+		err      error
+	}{
+		{name: "zero", encoded: []byte{0x00}, distance: 0},
+		{name: "1 byte max", encoded: []byte{0x7f}, distance: 127},
+		{name: "2 bytes min", encoded: []byte{0x80, 0x00}, distance: 128},
+		{name: "2 bytes max", encoded: []byte{0xff, 0x7f}, distance: 16511},
+		{name: "3 bytes min", encoded: []byte{0x80, 0x80, 0x00}, distance: 16512},
+		{name: "max", encoded: []byte{0x80, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0x7f}, distance: 1<<64 - 1},
+		{name: "overflow", encoded: []byte{0x81, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, err: ErrBadOfsDistance},
+		{name: "continuation past 64 bits", encoded: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}, err: ErrBadOfsDistance},
+		{name: "empty", encoded: []byte{}, err: io.EOF},
+		{name: "truncated", encoded: []byte{0x80}, err: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.encoded)
+			distance, err := ReadOfsDistance(r)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("ReadOfsDistance(%x) error = %v, want %v", tt.encoded, err, tt.err)
+				}
+				return
+			}
+			if err != nil || distance != tt.distance || r.Len() != 0 {
+				t.Fatalf("ReadOfsDistance(%x) = %#x, %v with %d bytes left, want %#x", tt.encoded, distance, err, r.Len(), tt.distance)
+			}
+			if got := AppendOfsDistance(nil, tt.distance); !bytes.Equal(got, tt.encoded) {
+				t.Errorf("AppendOfsDistance(%#x) = %x, want %x", tt.distance, got, tt.encoded)
+			}
+		})
+	}
+}
+
+func TestOfsDistanceRoundTrip(t *testing.T) {
+	// the smallest distance taking n bytes, each continuation adds one
+	distances := []uint64{0, 1<<64 - 1}
+	first := uint64(0)
+	for n := 1; n <= 10; n++ {
+		if n > 1 {
+			distances = append(distances, first-1)
+		}
+		distances = append(distances, first, first+1)
+		if n < 10 {
+			first = first<<7 + 128
+		}
+	}
+	for _, distance := range distances {
+		encoded := AppendOfsDistance([]byte("prefix"), distance)[len("prefix"):]
+		got, err := ReadOfsDistance(bytes.NewReader(encoded))
+		if err != nil || got != distance {
+			t.Errorf("ReadOfsDistance(AppendOfsDistance(%#x) = %x) = %#x, %v", distance, encoded, got, err)
+		}
+	}
+}
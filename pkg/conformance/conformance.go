@@ -0,0 +1,312 @@
+//go:build !nowriter
+
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/delta"
+	"github.com/adlternative/git-miner/pkg/oid"
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+// Config describes one round trip: which objects to generate, and how the
+// resulting pack is checked.
+type Config struct {
+	// Seed makes the generated objects reproducible
+	Seed    int64
+	Objects int
+	MaxSize int
+	// DeltaPercent is the share of objects derived from an earlier one and
+	// stored as a delta against it, half ofs-delta and half ref-delta
+	DeltaPercent int
+	// Dir keeps the written packs for inspection, a temporary directory
+	// which is removed afterwards is used when empty
+	Dir string
+	// Git also verifies the pack with the system git when it is in PATH
+	Git bool
+	// PackOptions are handed to the reader
+	PackOptions []pack.Option
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Seed:         1,
+		Objects:      200,
+		MaxSize:      4096,
+		DeltaPercent: 40,
+		Git:          true,
+	}
+}
+
+type object struct {
+	_type pack.ObjectType
+	data  []byte
+	entry *pack.WriterEntry
+}
+
+var objectTypes = []pack.ObjectType{pack.ObjBlob, pack.ObjBlob, pack.ObjBlob, pack.ObjTree, pack.ObjCommit, pack.ObjTag}
+
+func randomBytes(rng *rand.Rand, size int) []byte {
+	buf := make([]byte, size)
+	rng.Read(buf)
+	return buf
+}
+
+// mutate derives a new object from base by inserting, deleting or
+// replacing a random range.
+func mutate(rng *rand.Rand, base []byte, maxSize int) []byte {
+	pos := rng.Intn(len(base) + 1)
+	length := rng.Intn(len(base)-pos+1) / 2
+	var middle []byte
+	switch rng.Intn(3) {
+	case 0:
+		middle = randomBytes(rng, rng.Intn(64)+1)
+		length = 0
+	case 1:
+	default:
+		middle = randomBytes(rng, rng.Intn(64)+1)
+	}
+
+	target := make([]byte, 0, len(base)+len(middle))
+	target = append(target, base[:pos]...)
+	target = append(target, middle...)
+	target = append(target, base[pos+length:]...)
+	if len(target) > maxSize {
+		target = target[:maxSize]
+	}
+	return target
+}
+
+func writeFile(dir, prefix, path string, data []byte) error {
+	tmp, err := pack.CreateTempFile(dir, prefix)
+	if err != nil {
+		return err
+	}
+	defer tmp.Cleanup()
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	return tmp.Commit(path)
+}
+
+// writePack generates the objects of a round and writes them as a pack and
+// idx in dir.
+func writePack(cfg *Config, dir string) (string, []*object, error) {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	var buf bytes.Buffer
+	pw, err := pack.NewWriter(&buf, uint32(cfg.Objects))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var objects []*object
+	seen := make(map[oid.Oid]bool)
+	for len(objects) < cfg.Objects {
+		obj := &object{}
+		var base *object
+		if len(objects) > 0 && rng.Intn(100) < cfg.DeltaPercent {
+			base = objects[rng.Intn(len(objects))]
+			obj._type = base._type
+			obj.data = mutate(rng, base.data, cfg.MaxSize)
+		} else {
+			obj._type = objectTypes[rng.Intn(len(objectTypes))]
+			obj.data = randomBytes(rng, rng.Intn(cfg.MaxSize+1))
+		}
+
+		id := pack.HashObject(obj._type, obj.data)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		deltaData := []byte(nil)
+		if base != nil {
+			if deltaData, err = delta.Encode(base.data, obj.data); err != nil {
+				return "", nil, err
+			}
+		}
+		switch {
+		case len(deltaData) < 4:
+			obj.entry, err = pw.WriteObject(obj._type, obj.data)
+		case rng.Intn(2) == 0:
+			obj.entry, err = pw.WriteOfsDelta(base.entry, deltaData, id)
+		default:
+			obj.entry, err = pw.WriteRefDelta(base.entry.Oid, deltaData, id)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		objects = append(objects, obj)
+	}
+
+	checksum, err := pw.Close()
+	if err != nil {
+		return "", nil, err
+	}
+	var idx bytes.Buffer
+	if err := pw.WriteIdx(&idx); err != nil {
+		return "", nil, err
+	}
+
+	packPath := filepath.Join(dir, fmt.Sprintf("pack-%x.pack", checksum))
+	if err := writeFile(dir, pack.TmpPackPrefix, packPath, buf.Bytes()); err != nil {
+		return "", nil, err
+	}
+	if err := writeFile(dir, pack.TmpIdxPrefix, strings.TrimSuffix(packPath, ".pack")+".idx", idx.Bytes()); err != nil {
+		return "", nil, err
+	}
+	return packPath, objects, nil
+}
+
+// verifyReader reads the pack back with our reader and checks every object
+// is where the writer put it, with the same id, type and CRC32.
+func verifyReader(cfg *Config, packPath string, objects []*object) error {
+	pf, err := pack.NewPackFile(packPath, cfg.PackOptions...)
+	if err != nil {
+		return err
+	}
+	defer pf.Close()
+
+	if err := pf.ParseHeader(); err != nil {
+		return err
+	}
+	if err := pf.ParseObjects(); err != nil {
+		return err
+	}
+	if err := pf.ResolveObjects(); err != nil {
+		return err
+	}
+
+	read := pf.Objects()
+	if len(read) != len(objects) {
+		return fmt.Errorf("read %d objects, wrote %d", len(read), len(objects))
+	}
+	for i, obj := range read {
+		expect := objects[i]
+		switch {
+		case obj.Offset() != expect.entry.Offset:
+			return fmt.Errorf("object %d read at offset %d, written at %d", i, obj.Offset(), expect.entry.Offset)
+		case obj.Oid() != expect.entry.Oid:
+			return fmt.Errorf("object %d read as %x, written as %x", i, obj.Oid(), expect.entry.Oid)
+		case obj.RealType() != expect._type:
+			return fmt.Errorf("object %x read as %v, written as %v", obj.Oid(), obj.RealType(), expect._type)
+		case obj.CRC32() != expect.entry.CRC32:
+			return fmt.Errorf("object %x read with crc32 %08x, written with %08x", obj.Oid(), obj.CRC32(), expect.entry.CRC32)
+		}
+	}
+
+	buf, err := os.ReadFile(strings.TrimSuffix(packPath, ".pack") + ".idx")
+	if err != nil {
+		return err
+	}
+	idx, err := pack.ParseIdx(buf)
+	if err != nil {
+		return err
+	}
+	if idx.ObjectCount != uint32(len(objects)) {
+		return fmt.Errorf("idx holds %d objects, wrote %d", idx.ObjectCount, len(objects))
+	}
+	for _, obj := range objects {
+		pos, ok := idx.Find(obj.entry.Oid)
+		if !ok {
+			return fmt.Errorf("idx misses %x", obj.entry.Oid)
+		}
+		offset, err := idx.Offset(pos)
+		if err != nil {
+			return err
+		}
+		crc, _ := idx.CRC32(pos)
+		if offset != obj.entry.Offset || crc != obj.entry.CRC32 {
+			return fmt.Errorf("idx has %x at offset %d crc32 %08x, written at %d crc32 %08x", obj.entry.Oid, offset, crc, obj.entry.Offset, obj.entry.CRC32)
+		}
+	}
+	return nil
+}
+
+// verifyGit runs `git verify-pack -v` and checks it sees the objects where
+// the writer put them.
+func verifyGit(packPath string, objects []*object) error {
+	out, err := exec.Command("git", "verify-pack", "-v", packPath).Output()
+	if err != nil {
+		return fmt.Errorf("git verify-pack failed: %w", err)
+	}
+
+	offsets := make(map[oid.Oid]uint64)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		id, err := oid.FromHex(fields[0])
+		if err != nil {
+			continue
+		}
+		offset, err := strconv.ParseUint(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("cannot parse git verify-pack line %q", line)
+		}
+		offsets[id] = offset
+	}
+
+	for _, obj := range objects {
+		offset, ok := offsets[obj.entry.Oid]
+		if !ok {
+			return fmt.Errorf("git does not see %x", obj.entry.Oid)
+		}
+		if offset != obj.entry.Offset {
+			return fmt.Errorf("git sees %x at offset %d, written at %d", obj.entry.Oid, offset, obj.entry.Offset)
+		}
+	}
+	return nil
+}
+
+// Run generates a random object set, writes it as a pack and idx with our
+// writer and verifies it with our reader and optionally with git.
+func Run(cfg Config) error {
+	dir := cfg.Dir
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "git-miner-conformance-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+
+	packPath, objects, err := writePack(&cfg, dir)
+	if err != nil {
+		return fmt.Errorf("seed %d: write: %w", cfg.Seed, err)
+	}
+	if err := verifyReader(&cfg, packPath, objects); err != nil {
+		return fmt.Errorf("seed %d: %s: %w", cfg.Seed, packPath, err)
+	}
+	if cfg.Git {
+		if _, err := exec.LookPath("git"); err == nil {
+			if err := verifyGit(packPath, objects); err != nil {
+				return fmt.Errorf("seed %d: %s: %w", cfg.Seed, packPath, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RunSeeds runs rounds for n consecutive seeds starting at cfg.Seed, the
+// returned error names the seed that reproduces a failure.
+func RunSeeds(cfg Config, n int) error {
+	for i := 0; i < n; i++ {
+		round := cfg
+		round.Seed = cfg.Seed + int64(i)
+		if err := Run(round); err != nil {
+			return err
+		}
+	}
+	return nil
+}
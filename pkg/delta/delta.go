@@ -0,0 +1,301 @@
+package delta
+
+import (
+	"errors"
+	"fmt"
+)
+
+// deltaSizeMin is the smallest possible delta: two one-byte size headers
+// plus a single one-byte copy or insert instruction and its payload.
+const deltaSizeMin = 4
+
+// maxDeltaPrealloc caps how much Apply allocates up front, larger
+// targets grow as they are produced so a forged header cannot force a
+// huge allocation.
+const maxDeltaPrealloc = 1 << 26
+
+var ErrBadDelta = errors.New("bad delta")
+
+func headerSize(delta []byte, pos *int) (uint64, error) {
+	var size uint64
+	shift := uint(0)
+	for {
+		if *pos >= len(delta) {
+			return 0, fmt.Errorf("%w: truncated size header", ErrBadDelta)
+		}
+		b := delta[*pos]
+		*pos++
+		// the byte at shift 63 has room for one bit and no continuation
+		if shift > 63 || shift == 63 && b > 1 {
+			return 0, fmt.Errorf("%w: size header overflows 64 bits", ErrBadDelta)
+		}
+		size |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return size, nil
+		}
+	}
+}
+
+// Sizes returns the base and result sizes from the header of delta
+func Sizes(delta []byte) (uint64, uint64, error) {
+	pos := 0
+	srcSize, err := headerSize(delta, &pos)
+	if err != nil {
+		return 0, 0, err
+	}
+	dstSize, err := headerSize(delta, &pos)
+	if err != nil {
+		return 0, 0, err
+	}
+	return srcSize, dstSize, nil
+}
+
+// Apply applies a git delta instruction stream to base and returns the
+// reconstructed object.
+func Apply(base, delta []byte) ([]byte, error) {
+	if len(delta) < deltaSizeMin {
+		return nil, fmt.Errorf("%w: too short", ErrBadDelta)
+	}
+
+	pos := 0
+	srcSize, err := headerSize(delta, &pos)
+	if err != nil {
+		return nil, err
+	}
+	if srcSize != uint64(len(base)) {
+		return nil, fmt.Errorf("%w: base size %d, expect %d", ErrBadDelta, len(base), srcSize)
+	}
+	dstSize, err := headerSize(delta, &pos)
+	if err != nil {
+		return nil, err
+	}
+
+	capacity := dstSize
+	if capacity > maxDeltaPrealloc {
+		capacity = maxDeltaPrealloc
+	}
+	out := make([]byte, 0, capacity)
+
+	for pos < len(delta) {
+		cmd := delta[pos]
+		pos++
+
+		switch {
+		case cmd&0x80 != 0:
+			var offset, size uint64
+			for i := uint(0); i < 4; i++ {
+				if cmd&(1<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, fmt.Errorf("%w: truncated copy instruction", ErrBadDelta)
+					}
+					offset |= uint64(delta[pos]) << (i * 8)
+					pos++
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if cmd&(0x10<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, fmt.Errorf("%w: truncated copy instruction", ErrBadDelta)
+					}
+					size |= uint64(delta[pos]) << (i * 8)
+					pos++
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) || uint64(len(out))+size > dstSize {
+				return nil, fmt.Errorf("%w: copy %d bytes from %d out of bound", ErrBadDelta, size, offset)
+			}
+			out = append(out, base[offset:offset+size]...)
+		case cmd != 0:
+			size := uint64(cmd)
+			if uint64(pos)+size > uint64(len(delta)) || uint64(len(out))+size > dstSize {
+				return nil, fmt.Errorf("%w: insert %d bytes out of bound", ErrBadDelta, size)
+			}
+			out = append(out, delta[pos:pos+int(size)]...)
+			pos += int(size)
+		default:
+			return nil, fmt.Errorf("%w: unexpected delta opcode 0", ErrBadDelta)
+		}
+	}
+
+	if uint64(len(out)) != dstSize {
+		return nil, fmt.Errorf("%w: result size %d, expect %d", ErrBadDelta, len(out), dstSize)
+	}
+	return out, nil
+}
+
+func appendDeltaSize(delta []byte, size uint64) []byte {
+	for size >= 0x80 {
+		delta = append(delta, byte(size)|0x80)
+		size >>= 7
+	}
+	return append(delta, byte(size))
+}
+
+// maxCopyOffset is the largest base offset a copy instruction holds, in its 4
+// offset bytes
+const maxCopyOffset = 0xffffffff
+
+// appendDeltaCopy emits copy instructions, leaving out zero offset and size bytes
+func appendDeltaCopy(delta []byte, offset, size uint64) ([]byte, error) {
+	for size > 0 {
+		if offset > maxCopyOffset {
+			return nil, fmt.Errorf("%w: cannot copy from offset %d, past 4 GiB", ErrBadDelta, offset)
+		}
+		n := size
+		if n > 0xffffff {
+			n = 0xffffff
+		}
+		cmdPos := len(delta)
+		cmd := byte(0x80)
+		delta = append(delta, 0)
+		for i := uint(0); i < 4; i++ {
+			if b := byte(offset >> (i * 8)); b != 0 {
+				cmd |= 1 << i
+				delta = append(delta, b)
+			}
+		}
+		for i := uint(0); i < 3; i++ {
+			if b := byte(n >> (i * 8)); b != 0 {
+				cmd |= 0x10 << i
+				delta = append(delta, b)
+			}
+		}
+		delta[cmdPos] = cmd
+		offset += n
+		size -= n
+	}
+	return delta, nil
+}
+
+func appendDeltaInsert(delta []byte, data []byte) []byte {
+	for len(data) > 0 {
+		n := len(data)
+		if n > 0x7f {
+			n = 0x7f
+		}
+		delta = append(delta, byte(n))
+		delta = append(delta, data[:n]...)
+		data = data[n:]
+	}
+	return delta
+}
+
+// blockSize is how much of the base an index entry covers, git's RABIN_WINDOW.
+// Shorter matches are inserted, a copy would hardly be smaller.
+const blockSize = 16
+
+// maxBucket caps the base offsets kept for a block hash, like git's
+// HASH_LIMIT, so that a repetitive base does not make Encode quadratic
+const maxBucket = 64
+
+// blockPrime multiplies the rolling hash of the blocks
+const blockPrime = 16777619
+
+// blockPrimeOut takes the byte leaving the block out of the rolling hash,
+// blockPrime to the power of blockSize-1
+var blockPrimeOut = func() uint32 {
+	p := uint32(1)
+	for i := 1; i < blockSize; i++ {
+		p *= blockPrime
+	}
+	return p
+}()
+
+func hashBlock(block []byte) uint32 {
+	var h uint32
+	for _, b := range block[:blockSize] {
+		h = h*blockPrime + uint32(b)
+	}
+	return h
+}
+
+// blockIndex maps the hashes of the blocks of a base to their offsets
+type blockIndex map[uint32][]uint32
+
+// indexBlocks indexes the blocks base starts with. Copies can only start in
+// the first 4 GiB, like git the rest of a larger base is left out.
+func indexBlocks(base []byte) blockIndex {
+	indexed := uint64(len(base))
+	if indexed > maxCopyOffset {
+		indexed = maxCopyOffset
+	}
+	index := make(blockIndex, indexed/blockSize)
+	for offset := uint64(0); offset+blockSize <= indexed; offset += blockSize {
+		h := hashBlock(base[offset:])
+		if len(index[h]) < maxBucket {
+			index[h] = append(index[h], uint32(offset))
+		}
+	}
+	return index
+}
+
+// longestMatch returns where in base the longest run of target starting at
+// its block with hash h is, with its length, 0 if none is a block long
+func (index blockIndex) longestMatch(base, target []byte, h uint32) (uint64, int) {
+	var best uint64
+	bestSize := 0
+	for _, offset := range index[h] {
+		src := base[offset:]
+		n := 0
+		for n < len(src) && n < len(target) && src[n] == target[n] {
+			n++
+		}
+		if n > bestSize {
+			best, bestSize = uint64(offset), n
+		}
+	}
+	if bestSize < blockSize {
+		return 0, 0
+	}
+	return best, bestSize
+}
+
+// Encode returns a delta turning base into target. Like git's diff-delta it
+// indexes the blocks of base and looks each position of target up in it,
+// copying the longest match found, extended backwards over what was to be
+// inserted, and inserting what matches nothing.
+func Encode(base, target []byte) ([]byte, error) {
+	delta := appendDeltaSize(nil, uint64(len(base)))
+	delta = appendDeltaSize(delta, uint64(len(target)))
+	index := indexBlocks(base)
+
+	var err error
+	pending := 0
+	var h uint32
+	rolled := false
+	for i := 0; i+blockSize <= len(target); {
+		if rolled {
+			h = (h-uint32(target[i-1])*blockPrimeOut)*blockPrime + uint32(target[i+blockSize-1])
+		} else {
+			h = hashBlock(target[i:])
+		}
+		offset, size := index.longestMatch(base, target[i:], h)
+		if size == 0 {
+			i++
+			rolled = true
+			continue
+		}
+		back := 0
+		for back < i-pending && uint64(back) < offset && base[offset-uint64(back)-1] == target[i-back-1] {
+			back++
+		}
+		offset -= uint64(back)
+		size += back
+		// the instructions one copy is split into must all start in reach
+		if end := offset + uint64(size); end > maxCopyOffset+1 {
+			size -= int(end - maxCopyOffset - 1)
+		}
+		delta = appendDeltaInsert(delta, target[pending:i-back])
+		if delta, err = appendDeltaCopy(delta, offset, uint64(size)); err != nil {
+			return nil, err
+		}
+		i += size - back
+		pending = i
+		rolled = false
+	}
+	return appendDeltaInsert(delta, target[pending:]), nil
+}
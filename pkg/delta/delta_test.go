@@ -0,0 +1,161 @@
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func lines(from, to int) []byte {
+	var b bytes.Buffer
+	for i := from; i < to; i++ {
+		fmt.Fprintf(&b, "line %d of a file that is edited\n", i)
+	}
+	return b.Bytes()
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestEncode(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 5000)
+	rng.Read(random)
+
+	tests := []struct {
+		name         string
+		base, target []byte
+		// maxSize bounds the delta, 0 for no bound
+		maxSize int
+	}{
+		{name: "empty"},
+		{name: "empty base", target: []byte("hello\n")},
+		{name: "empty target", base: []byte("hello\n")},
+		{name: "same", base: lines(0, 1000), target: lines(0, 1000), maxSize: 20},
+		{name: "appended", base: lines(0, 1000), target: lines(0, 1001), maxSize: 60},
+		{name: "middle edited", base: lines(0, 1000), target: join(lines(0, 500), []byte("edited\n"), lines(501, 1000)), maxSize: 40},
+		// prefix and suffix alone would insert nearly everything
+		{name: "halves swapped", base: lines(0, 1000), target: join(lines(500, 1000), lines(0, 500)), maxSize: 40},
+		{name: "block repeated", base: lines(0, 10), target: join(lines(0, 10), lines(0, 10), lines(0, 10)), maxSize: 40},
+		{name: "unrelated", base: random[:2500], target: random[2500:]},
+		{name: "short", base: []byte("abc"), target: []byte("abcd")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta, err := Encode(tt.base, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Apply(tt.base, delta)
+			if err != nil {
+				if len(delta) >= deltaSizeMin || len(tt.target) > 0 {
+					t.Fatalf("Apply: %v", err)
+				}
+				// too short for Apply, two empty size headers
+				return
+			}
+			if !bytes.Equal(got, tt.target) {
+				t.Fatalf("Apply(Encode) = %q, want %q", got, tt.target)
+			}
+			if tt.maxSize > 0 && len(delta) > tt.maxSize {
+				t.Errorf("delta is %d bytes, want at most %d", len(delta), tt.maxSize)
+			}
+		})
+	}
+}
+
+func TestEncodeRandomEdits(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		base := make([]byte, rng.Intn(20000))
+		for j := range base {
+			// few symbols, so that blocks repeat
+			base[j] = "abcd\n"[rng.Intn(5)]
+		}
+		target := append([]byte{}, base...)
+		for edits := rng.Intn(10); edits > 0 && len(target) > 0; edits-- {
+			at := rng.Intn(len(target))
+			end := at + rng.Intn(len(target)-at)
+			switch rng.Intn(3) {
+			case 0:
+				target = append(target[:at:at], target[end:]...)
+			case 1:
+				target = join(target[:at], []byte("inserted text"), target[at:])
+			default:
+				target = join(target[at:], target[:at])
+			}
+		}
+		delta, err := Encode(base, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Apply(base, delta)
+		if err != nil && len(target) > 0 {
+			t.Fatalf("round %d: Apply: %v", i, err)
+		}
+		if err == nil && !bytes.Equal(got, target) {
+			t.Fatalf("round %d: Apply(Encode) differs from the target", i)
+		}
+	}
+}
+
+func TestAppendDeltaCopy(t *testing.T) {
+	tests := []struct {
+		offset, size uint64
+		want         []byte
+		wantErr      bool
+	}{
+		{offset: 0, size: 1, want: []byte{0x90, 0x01}},
+		{offset: 0x10, size: 0x10000, want: []byte{0xc1, 0x10, 0x01}},
+		{offset: 0xffffffff, size: 0xffffff, want: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		// the second instruction would start past 4 GiB
+		{offset: 0xffffffff, size: 0x1000000, wantErr: true},
+		{offset: 1 << 32, size: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := appendDeltaCopy(nil, tt.offset, tt.size)
+		if tt.wantErr {
+			if !errors.Is(err, ErrBadDelta) {
+				t.Errorf("appendDeltaCopy(%#x, %#x) error = %v, want ErrBadDelta", tt.offset, tt.size, err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("appendDeltaCopy(%#x, %#x) = %x, %v, want %x", tt.offset, tt.size, got, err, tt.want)
+		}
+	}
+}
+
+func TestHeaderSize(t *testing.T) {
+	tests := []struct {
+		header  []byte
+		want    uint64
+		wantErr bool
+	}{
+		{header: []byte{0x00}, want: 0},
+		{header: []byte{0x7f}, want: 0x7f},
+		{header: []byte{0x80, 0x01}, want: 0x80},
+		{header: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, want: 1<<64 - 1},
+		// bits past 64 at shift 63
+		{header: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}, wantErr: true},
+		{header: []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x81, 0x00}, wantErr: true},
+		{header: []byte{0x80}, wantErr: true},
+		{header: []byte{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		pos := 0
+		got, err := headerSize(tt.header, &pos)
+		if tt.wantErr {
+			if !errors.Is(err, ErrBadDelta) {
+				t.Errorf("headerSize(%x) error = %v, want ErrBadDelta", tt.header, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want || pos != len(tt.header) {
+			t.Errorf("headerSize(%x) = %#x at %d, %v, want %#x at %d", tt.header, got, pos, err, tt.want, len(tt.header))
+		}
+	}
+}
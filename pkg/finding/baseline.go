@@ -0,0 +1,86 @@
+package finding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type baselineKey struct {
+	code   string
+	oid    string
+	offset uint64
+}
+
+func keyOf(f *Finding) baselineKey {
+	key := baselineKey{
+		code: f.Code,
+		oid:  f.Oid,
+	}
+	// without an oid the offset is all that tells findings of a code apart
+	if f.Oid == "" {
+		key.offset = f.Offset
+	}
+	return key
+}
+
+// Baseline is a set of findings acknowledged earlier. Findings in it are
+// marked Known and no longer make a check fail.
+type Baseline struct {
+	known map[baselineKey]bool
+}
+
+// LoadFindings reads findings from path, either a JSON array of them or a
+// JSON report with a "findings" array, like the pack command prints
+func LoadFindings(path string) ([]*Finding, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []*Finding
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		err = json.Unmarshal(b, &findings)
+	} else {
+		var report struct {
+			Findings []*Finding `json:"findings"`
+		}
+		err = json.Unmarshal(b, &report)
+		findings = report.Findings
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse findings %s: %w", path, err)
+	}
+	return findings, nil
+}
+
+// LoadBaseline reads a baseline from path, see LoadFindings for the format.
+// Only the code, oid and offset of each finding matter.
+func LoadBaseline(path string) (*Baseline, error) {
+	findings, err := LoadFindings(path)
+	if err != nil {
+		return nil, err
+	}
+
+	baseline := &Baseline{
+		known: make(map[baselineKey]bool),
+	}
+	for _, f := range findings {
+		baseline.known[keyOf(f)] = true
+	}
+	return baseline, nil
+}
+
+// Mark sets Known on the findings in the baseline, a nil Baseline knows
+// nothing
+func (b *Baseline) Mark(findings ...*Finding) {
+	if b == nil {
+		return
+	}
+	for _, f := range findings {
+		if b.known[keyOf(f)] {
+			f.Known = true
+		}
+	}
+}
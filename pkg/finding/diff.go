@@ -0,0 +1,41 @@
+package finding
+
+// Diff sorts the findings of two runs of a check. Findings are the same when
+// their code and oid, or offset without an oid, are, like in a Baseline.
+type Diff struct {
+	// New are the findings of the new run the old one did not have
+	New []*Finding `json:"new"`
+	// Resolved are the findings of the old run gone from the new one
+	Resolved []*Finding `json:"resolved"`
+	// Unchanged are the findings of the new run the old one had too
+	Unchanged []*Finding `json:"unchanged"`
+}
+
+// Compare diffs the findings of an old and a new run, keeping their order
+func Compare(old, new []*Finding) *Diff {
+	d := &Diff{
+		New:       []*Finding{},
+		Resolved:  []*Finding{},
+		Unchanged: []*Finding{},
+	}
+	inOld := make(map[baselineKey]bool)
+	for _, f := range old {
+		inOld[keyOf(f)] = true
+	}
+	inNew := make(map[baselineKey]bool)
+	for _, f := range new {
+		key := keyOf(f)
+		inNew[key] = true
+		if inOld[key] {
+			d.Unchanged = append(d.Unchanged, f)
+		} else {
+			d.New = append(d.New, f)
+		}
+	}
+	for _, f := range old {
+		if !inNew[keyOf(f)] {
+			d.Resolved = append(d.Resolved, f)
+		}
+	}
+	return d
+}
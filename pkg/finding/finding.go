@@ -0,0 +1,134 @@
+package finding
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if name == string(text) {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Finding is something a check found, from a harmless oddity to corruption.
+// Code is a stable identifier of the kind of finding, Message is for humans.
+type Finding struct {
+	Severity Severity               `json:"severity"`
+	Code     string                 `json:"code"`
+	Oid      string                 `json:"oid,omitempty"`
+	Offset   uint64                 `json:"offset,omitempty"`
+	Message  string                 `json:"message"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	// Known is set for findings acknowledged in a Baseline
+	Known bool `json:"known,omitempty"`
+
+	err error
+}
+
+func New(severity Severity, code string, format string, a ...interface{}) *Finding {
+	return &Finding{
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+	}
+}
+
+// Wrap turns err into an error finding, errors.Is and errors.As still see err
+func Wrap(code string, err error) *Finding {
+	return &Finding{
+		Severity: Error,
+		Code:     code,
+		Message:  err.Error(),
+		err:      err,
+	}
+}
+
+// As returns the finding in err's chain, or wraps err with code if there is
+// none
+func As(err error, code string) *Finding {
+	var f *Finding
+	if errors.As(err, &f) {
+		return f
+	}
+	return Wrap(code, err)
+}
+
+func (f *Finding) WithOid(id oid.Oid) *Finding {
+	f.Oid = id.String()
+	return f
+}
+
+func (f *Finding) WithOffset(offset uint64) *Finding {
+	f.Offset = offset
+	return f
+}
+
+func (f *Finding) With(key string, value interface{}) *Finding {
+	if f.Data == nil {
+		f.Data = make(map[string]interface{})
+	}
+	f.Data[key] = value
+	return f
+}
+
+func (f *Finding) String() string {
+	s := fmt.Sprintf("%s [%s]", f.Severity, f.Code)
+	if f.Oid != "" {
+		s += " oid=" + f.Oid
+	}
+	if f.Offset != 0 {
+		s += fmt.Sprintf(" offset=%d", f.Offset)
+	}
+	if f.Known {
+		s += " (known)"
+	}
+	return s + ": " + f.Message
+}
+
+// Error makes a finding usable as an error, it is just the message so that
+// wrapping an error in a finding does not change its text
+func (f *Finding) Error() string {
+	return f.Message
+}
+
+func (f *Finding) Unwrap() error {
+	return f.err
+}
+
+// Failed returns whether any of findings is an error not in the baseline
+func Failed(findings []*Finding) bool {
+	for _, f := range findings {
+		if f.Severity >= Error && !f.Known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package finding
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SeverityMap overrides the severity of findings by code, like the
+// fsck.<msg-id> settings of git do for its messages. Findings whose code is
+// ignored are dropped.
+type SeverityMap struct {
+	severities map[string]Severity
+	ignored    map[string]bool
+}
+
+// ParseSeverityMap parses comma separated code=severity pairs, severity being
+// one of info, warning (or warn), error or ignore. A later pair for a code
+// wins.
+func ParseSeverityMap(spec string) (*SeverityMap, error) {
+	m := &SeverityMap{
+		severities: make(map[string]Severity),
+		ignored:    make(map[string]bool),
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		code, name, ok := strings.Cut(pair, "=")
+		if !ok || code == "" {
+			return nil, fmt.Errorf("bad severity %q, want code=severity", pair)
+		}
+		switch name {
+		case "ignore":
+			m.ignored[code] = true
+			delete(m.severities, code)
+			continue
+		case "warn":
+			name = "warning"
+		}
+		var severity Severity
+		if err := severity.UnmarshalText([]byte(name)); err != nil {
+			return nil, fmt.Errorf("bad severity %q: %w", pair, err)
+		}
+		m.severities[code] = severity
+		delete(m.ignored, code)
+	}
+	return m, nil
+}
+
+// Apply overrides the severities of findings and returns those not ignored,
+// a nil SeverityMap leaves them as they are
+func (m *SeverityMap) Apply(findings []*Finding) []*Finding {
+	if m == nil {
+		return findings
+	}
+	kept := make([]*Finding, 0, len(findings))
+	for _, f := range findings {
+		if m.ignored[f.Code] {
+			continue
+		}
+		if severity, ok := m.severities[f.Code]; ok {
+			f.Severity = severity
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
@@ -0,0 +1,135 @@
+//go:build !nowriter
+
+package fuzz
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/adlternative/git-miner/pkg/delta"
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+// Seed corpus layout, one directory per fuzz function
+const (
+	EntryHeaderDir = "entryheader"
+	ApplyDeltaDir  = "applydelta"
+	IdxDir         = "idx"
+)
+
+type seedPack struct {
+	pack    []byte
+	idx     []byte
+	entries []*pack.WriterEntry
+	deltas  [][]byte
+}
+
+// buildSeedPack writes a small pack holding every entry kind
+func buildSeedPack() (*seedPack, error) {
+	base := []byte("hello world\n")
+	target := []byte("hello world\nand goodbye\n")
+	third := []byte("hello world\nand goodbye again\n")
+	large := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	tree := []byte("100644 hello\x00" + string(make([]byte, 20)))
+
+	seed := &seedPack{}
+	var buf bytes.Buffer
+	pw, err := pack.NewWriter(&buf, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := pw.WriteObject(pack.ObjBlob, base)
+	if err != nil {
+		return nil, err
+	}
+	seed.entries = append(seed.entries, blob)
+
+	for _, obj := range []struct {
+		_type pack.ObjectType
+		data  []byte
+	}{
+		{pack.ObjBlob, large},
+		{pack.ObjTree, tree},
+		{pack.ObjBlob, nil},
+	} {
+		entry, err := pw.WriteObject(obj._type, obj.data)
+		if err != nil {
+			return nil, err
+		}
+		seed.entries = append(seed.entries, entry)
+	}
+
+	deltaData, err := delta.Encode(base, target)
+	if err != nil {
+		return nil, err
+	}
+	seed.deltas = append(seed.deltas, joinDeltaInput(base, deltaData))
+	targetOid := pack.HashObject(pack.ObjBlob, target)
+	entry, err := pw.WriteOfsDelta(blob, deltaData, targetOid)
+	if err != nil {
+		return nil, err
+	}
+	seed.entries = append(seed.entries, entry)
+
+	if deltaData, err = delta.Encode(target, third); err != nil {
+		return nil, err
+	}
+	seed.deltas = append(seed.deltas, joinDeltaInput(target, deltaData))
+	entry, err = pw.WriteRefDelta(targetOid, deltaData, pack.HashObject(pack.ObjBlob, third))
+	if err != nil {
+		return nil, err
+	}
+	seed.entries = append(seed.entries, entry)
+
+	if _, err := pw.Close(); err != nil {
+		return nil, err
+	}
+	seed.pack = buf.Bytes()
+
+	var idx bytes.Buffer
+	if err := pw.WriteIdx(&idx); err != nil {
+		return nil, err
+	}
+	seed.idx = idx.Bytes()
+	return seed, nil
+}
+
+func writeSeed(dir string, data []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%x", sha1.Sum(data))
+	return os.WriteFile(filepath.Join(dir, name), data, 0644)
+}
+
+// WriteSeedCorpus writes seeds for every Fuzz function into a sub directory
+// of dir named after it. Seeds are named by their sha1 so that rerunning it
+// is idempotent.
+func WriteSeedCorpus(dir string) error {
+	seed, err := buildSeedPack()
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range seed.entries {
+		end := uint64(len(seed.pack) - pack.GitSha1Rawsz)
+		if i+1 < len(seed.entries) {
+			end = seed.entries[i+1].Offset
+		}
+		if err := writeSeed(filepath.Join(dir, EntryHeaderDir), seed.pack[entry.Offset:end]); err != nil {
+			return err
+		}
+	}
+
+	for _, delta := range seed.deltas {
+		if err := writeSeed(filepath.Join(dir, ApplyDeltaDir), delta); err != nil {
+			return err
+		}
+	}
+
+	return writeSeed(filepath.Join(dir, IdxDir), seed.idx)
+}
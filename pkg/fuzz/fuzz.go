@@ -0,0 +1,74 @@
+package fuzz
+
+import (
+	"encoding/binary"
+
+	"github.com/adlternative/git-miner/pkg/delta"
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+// The Fuzz* functions follow the go-fuzz/libFuzzer convention: they return 1
+// when the input parsed and should be given priority in the corpus, 0
+// otherwise. They are deterministic and only panic on real bugs. Build them
+// with e.g. `go-fuzz-build -func FuzzApplyDelta` or `go114-fuzz-build`.
+
+// FuzzEntryHeader feeds data to pack.ParseEntryHeader
+func FuzzEntryHeader(data []byte) int {
+	header, n, err := pack.ParseEntryHeader(data)
+	if err != nil {
+		return 0
+	}
+	if n <= 0 || n > len(data) {
+		panic("entry header consumed an impossible number of bytes")
+	}
+	if !header.Type().IsValidInPack() {
+		panic("entry header accepted a bad type")
+	}
+	return 1
+}
+
+// FuzzApplyDelta splits data into a base and a delta and feeds them to
+// delta.Apply. The first two bytes hold the base length.
+func FuzzApplyDelta(data []byte) int {
+	base, deltaData, ok := splitDeltaInput(data)
+	if !ok {
+		return 0
+	}
+	if _, err := delta.Apply(base, deltaData); err != nil {
+		return 0
+	}
+	return 1
+}
+
+func splitDeltaInput(data []byte) ([]byte, []byte, bool) {
+	if len(data) < 2 {
+		return nil, nil, false
+	}
+	baseLen := int(binary.BigEndian.Uint16(data[0:2]))
+	if 2+baseLen > len(data) {
+		return nil, nil, false
+	}
+	return data[2 : 2+baseLen], data[2+baseLen:], true
+}
+
+func joinDeltaInput(base, delta []byte) []byte {
+	data := make([]byte, 2, 2+len(base)+len(delta))
+	binary.BigEndian.PutUint16(data, uint16(len(base)))
+	data = append(data, base...)
+	return append(data, delta...)
+}
+
+// FuzzIdx feeds data to pack.ParseIdx and walks every entry it accepted
+func FuzzIdx(data []byte) int {
+	idx, err := pack.ParseIdx(data)
+	if err != nil {
+		return 0
+	}
+	for i := uint32(0); i < idx.ObjectCount; i++ {
+		pos, ok := idx.Find(idx.Oid(i))
+		if !ok || pos != i {
+			panic("idx cannot find its own object")
+		}
+	}
+	return 1
+}
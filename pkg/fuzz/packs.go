@@ -0,0 +1,393 @@
+//go:build !nowriter
+
+package fuzz
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/codec"
+	"github.com/adlternative/git-miner/pkg/delta"
+	"github.com/adlternative/git-miner/pkg/oid"
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+// PacksDir is the sub directory of the corpus holding whole packs
+const PacksDir = "packs"
+
+// ManifestName lists the corpus packs, whether they should verify and what
+// they exercise
+const ManifestName = "MANIFEST"
+
+type corpusObject struct {
+	_type pack.ObjectType
+	data  []byte
+}
+
+// corpusPack is a pack of the corpus. Bad packs are wrong as built or start
+// out as a good pack and are damaged by corrupt.
+type corpusPack struct {
+	name    string
+	desc    string
+	bad     bool
+	build   func(pw *packBuilder) error
+	corrupt func(p []byte) []byte
+}
+
+// packBuilder collects the entries of a corpus pack, the count goes into the
+// pack header so it has to be known up front
+type packBuilder struct {
+	steps []func(pw *pack.Writer) error
+	// entries are those written so far, for deltas to refer to
+	entries []*pack.WriterEntry
+}
+
+func (b *packBuilder) object(_type pack.ObjectType, data []byte) int {
+	i := len(b.steps)
+	b.steps = append(b.steps, func(pw *pack.Writer) error {
+		entry, err := pw.WriteObject(_type, data)
+		b.entries = append(b.entries, entry)
+		return err
+	})
+	return i
+}
+
+func (b *packBuilder) ofsDelta(base int, baseData []byte, data []byte) int {
+	i := len(b.steps)
+	b.steps = append(b.steps, func(pw *pack.Writer) error {
+		deltaData, err := delta.Encode(baseData, data)
+		if err != nil {
+			return err
+		}
+		entry, err := pw.WriteOfsDelta(b.entries[base], deltaData, pack.HashObject(pack.ObjBlob, data))
+		b.entries = append(b.entries, entry)
+		return err
+	})
+	return i
+}
+
+func (b *packBuilder) refDelta(baseOid oid.Oid, baseData []byte, data []byte) int {
+	i := len(b.steps)
+	b.steps = append(b.steps, func(pw *pack.Writer) error {
+		deltaData, err := delta.Encode(baseData, data)
+		if err != nil {
+			return err
+		}
+		entry, err := pw.WriteRefDelta(baseOid, deltaData, pack.HashObject(pack.ObjBlob, data))
+		b.entries = append(b.entries, entry)
+		return err
+	})
+	return i
+}
+
+func (b *packBuilder) raw(raw []byte, id oid.Oid) int {
+	i := len(b.steps)
+	b.steps = append(b.steps, func(pw *pack.Writer) error {
+		entry, err := pw.WriteRawEntry(raw, id)
+		b.entries = append(b.entries, entry)
+		return err
+	})
+	return i
+}
+
+func (b *packBuilder) write() ([]byte, []byte, error) {
+	var buf bytes.Buffer
+	pw, err := pack.NewWriter(&buf, uint32(len(b.steps)))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, step := range b.steps {
+		if err := step(pw); err != nil {
+			return nil, nil, err
+		}
+	}
+	if _, err := pw.Close(); err != nil {
+		return nil, nil, err
+	}
+	var idx bytes.Buffer
+	if err := pw.WriteIdx(&idx); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), idx.Bytes(), nil
+}
+
+func zlibBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// zlibChunks compresses data like writers deflating it in chunks do, with a
+// sync flush after each chunk
+func zlibChunks(data []byte, chunk int, level int) []byte {
+	var buf bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&buf, level)
+	for len(data) > chunk {
+		zw.Write(data[:chunk])
+		zw.Flush()
+		data = data[chunk:]
+	}
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// fixTrailer recomputes the checksum of a damaged pack, so that only the
+// damage itself is wrong
+func fixTrailer(p []byte) []byte {
+	sum := sha1.Sum(p[:len(p)-pack.GitSha1Rawsz])
+	copy(p[len(p)-pack.GitSha1Rawsz:], sum[:])
+	return p
+}
+
+var (
+	corpusTree   = []byte("100644 hello\x00" + strings.Repeat("\x11", 20) + "40000 dir\x00" + strings.Repeat("\x22", 20))
+	corpusCommit = []byte("tree " + strings.Repeat("1", 40) + "\n" +
+		"author A U Thor <author@example.com> 1112911993 -0700\n" +
+		"committer C O Mitter <committer@example.com> 1112911993 -0700\n\ninitial\n")
+	corpusTag = []byte("object " + strings.Repeat("2", 40) + "\ntype commit\ntag v1.0\n" +
+		"tagger C O Mitter <committer@example.com> 1112911993 -0700\n\nv1.0\n")
+)
+
+// chain returns n versions of a file, each one line longer
+func chain(n int) [][]byte {
+	var versions [][]byte
+	var data []byte
+	for i := 0; i < n; i++ {
+		data = append(append([]byte{}, data...), fmt.Sprintf("line %d of a long file\n", i)...)
+		versions = append(versions, data)
+	}
+	return versions
+}
+
+func allTypes(b *packBuilder) error {
+	b.object(pack.ObjCommit, corpusCommit)
+	b.object(pack.ObjTree, corpusTree)
+	b.object(pack.ObjBlob, []byte("hello\n"))
+	b.object(pack.ObjTag, corpusTag)
+	return nil
+}
+
+func bothDeltas(b *packBuilder) error {
+	versions := chain(3)
+	base := b.object(pack.ObjBlob, versions[0])
+	b.ofsDelta(base, versions[0], versions[1])
+	b.refDelta(pack.HashObject(pack.ObjBlob, versions[1]), versions[1], versions[2])
+	return nil
+}
+
+var corpusPacks = []*corpusPack{
+	{name: "all-types", desc: "one commit, tree, blob and tag", build: allTypes},
+	{name: "deltas", desc: "an ofs-delta and a ref-delta", build: bothDeltas},
+	{
+		name: "deep-ofs-chain",
+		desc: "a chain of 60 ofs-deltas",
+		build: func(b *packBuilder) error {
+			versions := chain(61)
+			prev := b.object(pack.ObjBlob, versions[0])
+			for i := 1; i < len(versions); i++ {
+				prev = b.ofsDelta(prev, versions[i-1], versions[i])
+			}
+			return nil
+		},
+	},
+	{
+		name: "deep-ref-chain",
+		desc: "a chain of 20 ref-deltas",
+		build: func(b *packBuilder) error {
+			versions := chain(21)
+			b.object(pack.ObjBlob, versions[0])
+			for i := 1; i < len(versions); i++ {
+				b.refDelta(pack.HashObject(pack.ObjBlob, versions[i-1]), versions[i-1], versions[i])
+			}
+			return nil
+		},
+	},
+	{
+		name: "sizes",
+		desc: "blobs at the boundaries of the entry header size varint",
+		build: func(b *packBuilder) error {
+			for _, size := range []int{0, 1, 15, 16, 2047, 2048, 262143, 262144} {
+				b.object(pack.ObjBlob, bytes.Repeat([]byte{'x'}, size))
+			}
+			return nil
+		},
+	},
+	{
+		name: "ref-before-base",
+		desc: "a ref-delta written before its base",
+		build: func(b *packBuilder) error {
+			versions := chain(2)
+			b.refDelta(pack.HashObject(pack.ObjBlob, versions[0]), versions[0], versions[1])
+			b.object(pack.ObjBlob, versions[0])
+			return nil
+		},
+	},
+	{
+		name: "sync-flush",
+		desc: "entries deflated in chunks with a sync flush after each",
+		build: func(b *packBuilder) error {
+			data := []byte(strings.Repeat("a file deflated in chunks\n", 100))
+			b.raw(append(codec.AppendEntryHeader(nil, uint8(pack.ObjBlob), uint64(len(data))), zlibChunks(data, 64, zlib.DefaultCompression)...), pack.HashObject(pack.ObjBlob, data))
+			empty := []byte{}
+			b.raw(append(codec.AppendEntryHeader(nil, uint8(pack.ObjBlob), 0), zlibChunks(empty, 64, zlib.DefaultCompression)...), pack.HashObject(pack.ObjBlob, empty))
+			return nil
+		},
+	},
+	{
+		name: "levels",
+		desc: "entries deflated at every zlib compression level",
+		build: func(b *packBuilder) error {
+			for level := zlib.NoCompression; level <= zlib.BestCompression; level++ {
+				data := []byte(strings.Repeat(fmt.Sprintf("compression level %d\n", level), 20))
+				b.raw(append(codec.AppendEntryHeader(nil, uint8(pack.ObjBlob), uint64(len(data))), zlibChunks(data, len(data), level)...), pack.HashObject(pack.ObjBlob, data))
+			}
+			return nil
+		},
+	},
+	{
+		name:  "signature",
+		bad:   true,
+		desc:  "PACK signature damaged",
+		build: allTypes,
+		corrupt: func(p []byte) []byte {
+			p[0] ^= 0xff
+			return fixTrailer(p)
+		},
+	},
+	{
+		name:  "version",
+		bad:   true,
+		desc:  "pack version 9",
+		build: allTypes,
+		corrupt: func(p []byte) []byte {
+			binary.BigEndian.PutUint32(p[4:8], 9)
+			return fixTrailer(p)
+		},
+	},
+	{
+		name:  "too-many-objects",
+		bad:   true,
+		desc:  "header promises one object more than the pack holds",
+		build: allTypes,
+		corrupt: func(p []byte) []byte {
+			binary.BigEndian.PutUint32(p[8:12], binary.BigEndian.Uint32(p[8:12])+1)
+			return fixTrailer(p)
+		},
+	},
+	{
+		name:  "truncated",
+		bad:   true,
+		desc:  "pack cut in the middle of an entry",
+		build: allTypes,
+		corrupt: func(p []byte) []byte {
+			return p[:len(p)/2]
+		},
+	},
+	{
+		name:  "zlib",
+		bad:   true,
+		desc:  "a byte of compressed data flipped",
+		build: allTypes,
+		corrupt: func(p []byte) []byte {
+			// inside the zlib stream of the first entry, after its 2 byte
+			// header and the zlib header
+			p[12+2+2+4] ^= 0xff
+			return fixTrailer(p)
+		},
+	},
+	{
+		name:  "trailer",
+		bad:   true,
+		desc:  "trailing checksum damaged",
+		build: allTypes,
+		corrupt: func(p []byte) []byte {
+			p[len(p)-1] ^= 0xff
+			return p
+		},
+	},
+	{
+		name: "ofs-base",
+		bad:  true,
+		desc: "an ofs-delta whose base offset is not an entry",
+		build: func(b *packBuilder) error {
+			versions := chain(2)
+			b.object(pack.ObjBlob, versions[0])
+			deltaData, err := delta.Encode(versions[0], versions[1])
+			if err != nil {
+				return err
+			}
+			header := codec.AppendEntryHeader(nil, uint8(pack.ObjOfsDelta), uint64(len(deltaData)))
+			header = codec.AppendOfsDistance(header, 1)
+			b.raw(append(header, zlibBytes(deltaData)...), pack.HashObject(pack.ObjBlob, versions[1]))
+			return nil
+		},
+	},
+	{
+		name: "delta-base-size",
+		bad:  true,
+		desc: "a delta expecting a base one byte longer than its base",
+		build: func(b *packBuilder) error {
+			versions := chain(2)
+			base := b.object(pack.ObjBlob, versions[0])
+			b.ofsDelta(base, append(append([]byte{}, versions[0]...), '!'), versions[1])
+			return nil
+		},
+	},
+	{
+		name: "thin",
+		bad:  true,
+		desc: "a ref-delta against a base the pack lacks",
+		build: func(b *packBuilder) error {
+			versions := chain(2)
+			b.object(pack.ObjBlob, []byte("unrelated\n"))
+			b.refDelta(pack.HashObject(pack.ObjBlob, versions[0]), versions[0], versions[1])
+			return nil
+		},
+	},
+}
+
+// WritePackCorpus writes the corpus packs, with their idx, into dir and
+// lists them in dir/MANIFEST. The packs are the same on every run. Good
+// packs are named ok-*, damaged ones bad-*; the idx of a damaged pack is that
+// of the pack before the damage.
+func WritePackCorpus(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var manifest strings.Builder
+	for _, cp := range corpusPacks {
+		b := &packBuilder{}
+		if err := cp.build(b); err != nil {
+			return fmt.Errorf("%s: %w", cp.name, err)
+		}
+		p, idx, err := b.write()
+		if err != nil {
+			return fmt.Errorf("%s: %w", cp.name, err)
+		}
+
+		name, verdict := "ok-"+cp.name, "ok"
+		if cp.bad {
+			name, verdict = "bad-"+cp.name, "bad"
+		}
+		if cp.corrupt != nil {
+			p = cp.corrupt(p)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".pack"), p, 0644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".idx"), idx, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(&manifest, "%s.pack\t%s\t%s\n", name, verdict, cp.desc)
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestName), []byte(manifest.String()), 0644)
+}
@@ -0,0 +1,207 @@
+package midx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/bitmap"
+	"github.com/adlternative/git-miner/pkg/finding"
+)
+
+const revSignature = 0x52494458
+const revHeaderSize = 12
+
+// newInconsistency reports a disagreement between a MIDX bitmap and its
+// MIDX, chunk names the part of the bitmap or MIDX it was found in.
+func newInconsistency(chunk string, format string, a ...interface{}) *finding.Finding {
+	return finding.New(finding.Error, "bitmap-"+strings.ToLower(chunk), format, a...).With("chunk", chunk)
+}
+
+// BitmapPath returns where git writes the bitmap of this MIDX
+func (f *File) BitmapPath() string {
+	return filepath.Join(filepath.Dir(f.fileName), fmt.Sprintf("multi-pack-index-%x.bitmap", f.Checksum()))
+}
+
+func (f *File) revPath() string {
+	return filepath.Join(filepath.Dir(f.fileName), fmt.Sprintf("multi-pack-index-%x.rev", f.Checksum()))
+}
+
+// loadRevIndex returns the pseudo-pack order of the MIDX, either from its
+// RIDX chunk or from the .rev file older git versions write next to it.
+func (f *File) loadRevIndex() ([]byte, error) {
+	if f.revIndex != nil {
+		return f.revIndex, nil
+	}
+
+	buf, err := os.ReadFile(f.revPath())
+	if err != nil {
+		return nil, fmt.Errorf("no RIDX chunk and %w", err)
+	}
+	if uint64(len(buf)) != revHeaderSize+uint64(f.ObjectCount)*4+2*HashSize {
+		return nil, fmt.Errorf("%s has wrong size %d", f.revPath(), len(buf))
+	}
+	if binary.BigEndian.Uint32(buf[0:4]) != revSignature {
+		return nil, fmt.Errorf("%s has bad signature", f.revPath())
+	}
+	entriesEnd := revHeaderSize + f.ObjectCount*4
+	if !bytes.Equal(buf[entriesEnd:entriesEnd+HashSize], f.Checksum()) {
+		return nil, fmt.Errorf("%s does not belong to this multi-pack-index", f.revPath())
+	}
+	return buf[revHeaderSize:entriesEnd], nil
+}
+
+// verifyRevIndex checks that the reverse index is a permutation in
+// pseudo-pack order and returns the MIDX position -> bitmap position map.
+func (f *File) verifyRevIndex(revIndex []byte) ([]uint32, []*finding.Finding) {
+	var problems []*finding.Finding
+	n := f.ObjectCount
+	bitmapPos := make([]uint32, n)
+	seen := make([]bool, n)
+
+	var preferred uint32
+	var prevPack uint32
+	var prevOffset uint64
+	for pos := uint32(0); pos < n; pos++ {
+		midxPos := binary.BigEndian.Uint32(revIndex[pos*4:])
+		if midxPos >= n {
+			problems = append(problems, newInconsistency("RIDX", "bitmap position %d maps to object %d out of %d", pos, midxPos, n))
+			return nil, problems
+		}
+		if seen[midxPos] {
+			problems = append(problems, newInconsistency("RIDX", "object %x appears twice in pseudo-pack order", f.Oid(midxPos)))
+			return nil, problems
+		}
+		seen[midxPos] = true
+		bitmapPos[midxPos] = pos
+
+		pack := f.Pack(midxPos)
+		offset, _ := f.Offset(midxPos)
+		if pos == 0 {
+			preferred = pack
+		} else if !pseudoPackLess(preferred, prevPack, prevOffset, pack, offset) {
+			problems = append(problems, newInconsistency("RIDX", "bitmap position %d (pack %d offset %d) is out of pseudo-pack order", pos, pack, offset))
+		}
+		prevPack, prevOffset = pack, offset
+	}
+	return bitmapPos, problems
+}
+
+// pseudoPackLess orders objects the way git lays them out for MIDX bitmaps:
+// the preferred pack first, then by pack id, then by offset.
+func pseudoPackLess(preferred, packA uint32, offsetA uint64, packB uint32, offsetB uint64) bool {
+	if packA != packB {
+		if packA == preferred {
+			return true
+		}
+		if packB == preferred {
+			return false
+		}
+		return packA < packB
+	}
+	return offsetA < offsetB
+}
+
+func (f *File) verifyTypeBitmaps(b *bitmap.File) []*finding.Finding {
+	var problems []*finding.Finding
+	n := f.ObjectCount
+	types := []struct {
+		name   string
+		bitmap *bitmap.Bitmap
+	}{
+		{"commits", b.Commits},
+		{"trees", b.Trees},
+		{"blobs", b.Blobs},
+		{"tags", b.Tags},
+	}
+
+	all := &bitmap.Bitmap{}
+	for i, t := range types {
+		if max, ok := t.bitmap.Max(); ok && max >= n {
+			problems = append(problems, newInconsistency("type-bitmaps", "%s bitmap has bit %d beyond %d objects", t.name, max, n))
+		}
+		for _, other := range types[i+1:] {
+			if overlap := t.bitmap.And(other.bitmap); overlap.Count() > 0 {
+				first, _ := overlap.Max()
+				problems = append(problems, newInconsistency("type-bitmaps", "%s and %s bitmaps overlap in %d objects (e.g. position %d)", t.name, other.name, overlap.Count(), first))
+			}
+		}
+		all = all.Or(t.bitmap)
+	}
+
+	missing := 0
+	for pos := uint32(0); pos < n; pos++ {
+		if !all.Get(pos) {
+			if missing == 0 {
+				problems = append(problems, newInconsistency("type-bitmaps", "object at bitmap position %d has no type", pos))
+			}
+			missing++
+		}
+	}
+	if missing > 1 {
+		problems = append(problems, newInconsistency("type-bitmaps", "%d objects in total have no type", missing))
+	}
+	return problems
+}
+
+func (f *File) verifyBitmapEntries(b *bitmap.File, bitmapPos []uint32) []*finding.Finding {
+	var problems []*finding.Finding
+	n := f.ObjectCount
+	selected := make(map[uint32]bool)
+
+	for i, entry := range b.Entries {
+		if entry.ObjectPos >= n {
+			problems = append(problems, newInconsistency("entries", "entry %d selects object %d out of %d", i, entry.ObjectPos, n))
+			continue
+		}
+		oid := f.Oid(entry.ObjectPos)
+		if selected[entry.ObjectPos] {
+			problems = append(problems, newInconsistency("entries", "entry %d selects commit %x again", i, oid))
+		}
+		selected[entry.ObjectPos] = true
+
+		pos := bitmapPos[entry.ObjectPos]
+		if !b.Commits.Get(pos) {
+			problems = append(problems, newInconsistency("entries", "entry %d selects %x which is not a commit", i, oid))
+		}
+		if !entry.Bitmap.Get(pos) {
+			problems = append(problems, newInconsistency("entries", "entry %d bitmap for %x does not contain the commit itself", i, oid))
+		}
+		if max, ok := entry.Bitmap.Max(); ok && max >= n {
+			problems = append(problems, newInconsistency("entries", "entry %d bitmap for %x has bit %d beyond %d objects", i, oid, max, n))
+		}
+	}
+	return problems
+}
+
+// VerifyBitmap cross-checks a bitmap against the MIDX it was written for
+func (f *File) VerifyBitmap(b *bitmap.File) []*finding.Finding {
+	var problems []*finding.Finding
+
+	if !bytes.Equal(b.Checksum, f.Checksum()) {
+		problems = append(problems, newInconsistency("header", "bitmap checksum %x does not match multi-pack-index %x", b.Checksum, f.Checksum()))
+		return problems
+	}
+
+	revIndex, err := f.loadRevIndex()
+	if err != nil {
+		problems = append(problems, newInconsistency("RIDX", "cannot map bitmap positions: %v", err))
+		return problems
+	}
+	bitmapPos, revProblems := f.verifyRevIndex(revIndex)
+	problems = append(problems, revProblems...)
+	if bitmapPos == nil {
+		return problems
+	}
+
+	problems = append(problems, f.verifyTypeBitmaps(b)...)
+	problems = append(problems, f.verifyBitmapEntries(b, bitmapPos)...)
+
+	if expect := b.ExpectedTrailerLen(f.ObjectCount); b.TrailerLen != expect {
+		problems = append(problems, newInconsistency("trailer", "hash cache and lookup table take %d bytes, expect %d", b.TrailerLen, expect))
+	}
+	return problems
+}
@@ -0,0 +1,331 @@
+package midx
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/adlternative/git-miner/pkg/mmap"
+	"github.com/adlternative/git-miner/pkg/oid"
+	log "github.com/sirupsen/logrus"
+)
+
+const Signature = 0x4d494458
+const headerSize = 12
+const chunkLookupEntrySize = 12
+const HashSize = 20
+const fanoutSize = 256 * 4
+
+const (
+	ChunkPackNames     = 0x504e414d // PNAM
+	ChunkOidFanout     = 0x4f494446 // OIDF
+	ChunkOidLookup     = 0x4f49444c // OIDL
+	ChunkObjectOffsets = 0x4f4f4646 // OOFF
+	ChunkLargeOffsets  = 0x4c4f4646 // LOFF
+	ChunkRevIndex      = 0x52494458 // RIDX
+)
+
+const largeOffsetNeeded = 0x80000000
+
+type Chunk struct {
+	ID     uint32
+	Offset uint64
+	Size   uint64
+}
+
+func (c *Chunk) Name() string {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, c.ID)
+	return string(buf)
+}
+
+type File struct {
+	fileName string
+	buf      []byte
+
+	Version     uint8
+	HashVersion uint8
+	PackCount   uint32
+	ObjectCount uint32
+	PackNames   []string
+
+	chunks map[uint32]*Chunk
+	order  []*Chunk
+
+	oidLookup     []byte
+	objectOffsets []byte
+	largeOffsets  []byte
+	revIndex      []byte
+}
+
+// NewFile maps the multi-pack-index at fileName rather than reading it into
+// the heap, Close unmaps it
+func NewFile(fileName string) (*File, error) {
+	buf, err := mmap.Map(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &File{
+		fileName: fileName,
+		buf:      buf,
+		chunks:   make(map[uint32]*Chunk),
+	}, nil
+}
+
+// Close unmaps the file, nothing read from it may be used after
+func (f *File) Close() error {
+	buf := f.buf
+	f.buf = nil
+	return mmap.Unmap(buf)
+}
+
+// Checksum returns the trailing checksum, which is also the checksum
+// recorded by the MIDX's bitmap and reverse index.
+func (f *File) Checksum() []byte {
+	return f.buf[len(f.buf)-HashSize:]
+}
+
+// Parse parses and validates the whole multi-pack-index
+func (f *File) Parse() error {
+	if err := f.ParseLayout(); err != nil {
+		return err
+	}
+	return f.Check()
+}
+
+// ParseLayout parses the header, the chunk lookup table, the fanout and the
+// pack names, and checks that the chunks have the sizes they need. The
+// checksum, the order of the object ids and the offsets are left to Check, so
+// that lookups only read the pages of the chunks they touch.
+func (f *File) ParseLayout() error {
+	if len(f.buf) < headerSize+HashSize {
+		return fmt.Errorf("multi-pack-index is too short")
+	}
+	if signature := binary.BigEndian.Uint32(f.buf[0:4]); signature != Signature {
+		return fmt.Errorf("bad multi-pack-index signature %x", signature)
+	}
+	f.Version = f.buf[4]
+	if f.Version != 1 {
+		return fmt.Errorf("unsupported multi-pack-index version %d", f.Version)
+	}
+	f.HashVersion = f.buf[5]
+	if f.HashVersion != 1 {
+		return fmt.Errorf("unsupported multi-pack-index hash version %d", f.HashVersion)
+	}
+	chunkCount := uint64(f.buf[6])
+	if baseCount := f.buf[7]; baseCount != 0 {
+		return fmt.Errorf("incremental multi-pack-index is not supported")
+	}
+	f.PackCount = binary.BigEndian.Uint32(f.buf[8:12])
+
+	trailerOffset := uint64(len(f.buf) - HashSize)
+	if err := f.parseChunkLookup(chunkCount, trailerOffset); err != nil {
+		return err
+	}
+	if err := f.parseOidFanout(); err != nil {
+		return err
+	}
+	if err := f.parseOidLookup(); err != nil {
+		return err
+	}
+	if err := f.parsePackNames(); err != nil {
+		return err
+	}
+	if err := f.parseObjectOffsets(); err != nil {
+		return err
+	}
+	if chunk, ok := f.chunks[ChunkRevIndex]; ok {
+		if chunk.Size != uint64(f.ObjectCount)*4 {
+			return fmt.Errorf("RIDX chunk has wrong size %d", chunk.Size)
+		}
+		f.revIndex = f.chunkData(chunk)
+	}
+
+	return nil
+}
+
+// Check validates what ParseLayout leaves out
+func (f *File) Check() error {
+	trailerOffset := len(f.buf) - HashSize
+	sum := sha1.Sum(f.buf[:trailerOffset])
+	if !bytes.Equal(sum[:], f.buf[trailerOffset:]) {
+		return fmt.Errorf("multi-pack-index checksum mismatch")
+	}
+	if err := f.checkOidLookup(); err != nil {
+		return err
+	}
+	return f.checkObjectOffsets()
+}
+
+func (f *File) parseChunkLookup(chunkCount, trailerOffset uint64) error {
+	tableEnd := headerSize + (chunkCount+1)*chunkLookupEntrySize
+	if tableEnd > trailerOffset {
+		return fmt.Errorf("too short chunk lookup table")
+	}
+
+	var prev *Chunk
+	for i := uint64(0); i <= chunkCount; i++ {
+		entry := f.buf[headerSize+i*chunkLookupEntrySize:]
+		id := binary.BigEndian.Uint32(entry[0:4])
+		offset := binary.BigEndian.Uint64(entry[4:12])
+		if offset < tableEnd || offset > trailerOffset {
+			return fmt.Errorf("chunk %d offset %d out of bound", i, offset)
+		}
+		if prev != nil {
+			if offset < prev.Offset {
+				return fmt.Errorf("chunk %s offsets out of order", prev.Name())
+			}
+			prev.Size = offset - prev.Offset
+		}
+		if i == chunkCount {
+			if id != 0 {
+				return fmt.Errorf("chunk lookup table is not terminated")
+			}
+			break
+		}
+
+		chunk := &Chunk{ID: id, Offset: offset}
+		if _, ok := f.chunks[id]; ok {
+			return fmt.Errorf("duplicate %s chunk", chunk.Name())
+		}
+		f.chunks[id] = chunk
+		f.order = append(f.order, chunk)
+		prev = chunk
+	}
+
+	for _, id := range []uint32{ChunkPackNames, ChunkOidFanout, ChunkOidLookup, ChunkObjectOffsets} {
+		if _, ok := f.chunks[id]; !ok {
+			return fmt.Errorf("missing required %s chunk", (&Chunk{ID: id}).Name())
+		}
+	}
+	return nil
+}
+
+func (f *File) chunkData(chunk *Chunk) []byte {
+	return f.buf[chunk.Offset : chunk.Offset+chunk.Size]
+}
+
+func (f *File) parseOidFanout() error {
+	chunk := f.chunks[ChunkOidFanout]
+	if chunk.Size != fanoutSize {
+		return fmt.Errorf("OIDF chunk has wrong size %d", chunk.Size)
+	}
+	data := f.chunkData(chunk)
+
+	var prev uint32
+	for i := 0; i < 256; i++ {
+		count := binary.BigEndian.Uint32(data[i*4 : i*4+4])
+		if count < prev {
+			return fmt.Errorf("OIDF fanout out of order at %d", i)
+		}
+		prev = count
+	}
+	f.ObjectCount = prev
+	return nil
+}
+
+func (f *File) parseOidLookup() error {
+	chunk := f.chunks[ChunkOidLookup]
+	if chunk.Size != uint64(f.ObjectCount)*HashSize {
+		return fmt.Errorf("OIDL chunk has wrong size %d", chunk.Size)
+	}
+	f.oidLookup = f.chunkData(chunk)
+	return nil
+}
+
+func (f *File) checkOidLookup() error {
+	fanout := f.chunkData(f.chunks[ChunkOidFanout])
+	for i := uint32(0); i < f.ObjectCount; i++ {
+		raw := f.rawOid(i)
+		if i > 0 && bytes.Compare(f.rawOid(i-1), raw) >= 0 {
+			return fmt.Errorf("OIDL out of order at %d: %x", i, raw)
+		}
+		if i >= binary.BigEndian.Uint32(fanout[int(raw[0])*4:]) {
+			return fmt.Errorf("OIDL entry %x disagrees with OIDF", raw)
+		}
+	}
+	return nil
+}
+
+func (f *File) parsePackNames() error {
+	data := f.chunkData(f.chunks[ChunkPackNames])
+	for i := uint32(0); i < f.PackCount; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			return fmt.Errorf("PNAM chunk is too short for %d packs", f.PackCount)
+		}
+		name := string(data[:end])
+		if i > 0 && f.PackNames[i-1] >= name {
+			return fmt.Errorf("PNAM pack names out of order: %s, %s", f.PackNames[i-1], name)
+		}
+		f.PackNames = append(f.PackNames, name)
+		data = data[end+1:]
+	}
+	return nil
+}
+
+func (f *File) parseObjectOffsets() error {
+	chunk := f.chunks[ChunkObjectOffsets]
+	if chunk.Size != uint64(f.ObjectCount)*8 {
+		return fmt.Errorf("OOFF chunk has wrong size %d", chunk.Size)
+	}
+	f.objectOffsets = f.chunkData(chunk)
+	if chunk, ok := f.chunks[ChunkLargeOffsets]; ok {
+		if chunk.Size%8 != 0 {
+			return fmt.Errorf("LOFF chunk has wrong size %d", chunk.Size)
+		}
+		f.largeOffsets = f.chunkData(chunk)
+	}
+	return nil
+}
+
+func (f *File) checkObjectOffsets() error {
+	for i := uint32(0); i < f.ObjectCount; i++ {
+		if pack := f.Pack(i); pack >= f.PackCount {
+			return fmt.Errorf("OOFF object %d refers to pack %d out of %d", i, pack, f.PackCount)
+		}
+		if _, err := f.Offset(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Oid returns the object id at MIDX (lexicographic) position pos
+func (f *File) Oid(pos uint32) oid.Oid {
+	return oid.MustNew(oid.SHA1, f.rawOid(pos))
+}
+
+func (f *File) rawOid(pos uint32) []byte {
+	return f.oidLookup[pos*HashSize : (pos+1)*HashSize]
+}
+
+// Pack returns the pack int id the object at pos is taken from
+func (f *File) Pack(pos uint32) uint32 {
+	return binary.BigEndian.Uint32(f.objectOffsets[pos*8 : pos*8+4])
+}
+
+// Offset returns the offset of the object at pos in its pack
+func (f *File) Offset(pos uint32) (uint64, error) {
+	offset := binary.BigEndian.Uint32(f.objectOffsets[pos*8+4 : pos*8+8])
+	if offset&largeOffsetNeeded == 0 {
+		return uint64(offset), nil
+	}
+
+	index := uint64(offset ^ largeOffsetNeeded)
+	if (index+1)*8 > uint64(len(f.largeOffsets)) {
+		return 0, fmt.Errorf("OOFF object %d refers to missing LOFF entry %d", pos, index)
+	}
+	return binary.BigEndian.Uint64(f.largeOffsets[index*8:]), nil
+}
+
+func (f *File) Show() {
+	log.Printf("[midx] version:%d, hashVersion:%d, packs:%d, objects:%d, checksum:%x\n", f.Version, f.HashVersion, f.PackCount, f.ObjectCount, f.Checksum())
+	for _, chunk := range f.order {
+		log.Printf("[chunk] %s offset:%d size:%d\n", chunk.Name(), chunk.Offset, chunk.Size)
+	}
+	for i, name := range f.PackNames {
+		log.Printf("[pack] %d %s\n", i, name)
+	}
+}
@@ -0,0 +1,83 @@
+package midx
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/finding"
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+// CodePackMismatch is the code of disagreements between a MIDX and the packs
+// it covers
+const CodePackMismatch = "midx-pack"
+
+func newPackMismatch(packName string, format string, a ...interface{}) *finding.Finding {
+	return finding.New(finding.Error, CodePackMismatch, format, a...).With("pack", packName)
+}
+
+// VerifyPacks cross-checks the MIDX against its packs, like git
+// multi-pack-index verify: every pack must open with its idx, and every
+// object must be in the idx of its pack at the offset the MIDX gives, where
+// the entry headers of the pack must read. The objects go in MIDX order, so
+// the packs stay open as they interleave; they share budget, nil for half of
+// the open file limit, so that thousands of packs stay within it.
+func (f *File) VerifyPacks(budget *pack.FileBudget, opts ...pack.Option) []*finding.Finding {
+	if budget == nil {
+		budget = pack.NewFileBudget(0)
+	}
+	opts = append([]pack.Option{pack.WithFileBudget(budget)}, opts...)
+
+	var problems []*finding.Finding
+	sources := make([]*pack.PackObjectSource, f.PackCount)
+	broken := make([]bool, f.PackCount)
+	defer func() {
+		for _, source := range sources {
+			if source != nil {
+				source.Close()
+			}
+		}
+	}()
+	for pos := uint32(0); pos < f.ObjectCount; pos++ {
+		packID := f.Pack(pos)
+		if broken[packID] {
+			continue
+		}
+		name := f.PackNames[packID]
+		if sources[packID] == nil {
+			packPath := filepath.Join(filepath.Dir(f.fileName), strings.TrimSuffix(name, ".idx")+".pack")
+			source, err := pack.NewPackObjectSource(packPath, opts...)
+			if err != nil {
+				problems = append(problems, newPackMismatch(name, "cannot open pack %d: %v", packID, err))
+				broken[packID] = true
+				continue
+			}
+			sources[packID] = source
+		}
+		source := sources[packID]
+
+		id := f.Oid(pos)
+		want, err := f.Offset(pos)
+		if err != nil {
+			problems = append(problems, newPackMismatch(name, "%v", err).WithOid(id))
+			continue
+		}
+		got, err := source.Offset(id)
+		switch {
+		case errors.Is(err, pack.ErrObjectNotFound):
+			problems = append(problems, newPackMismatch(name, "object %s is not in pack %d", id, packID).WithOid(id))
+			continue
+		case err != nil:
+			problems = append(problems, newPackMismatch(name, "object %s: %v", id, err).WithOid(id))
+			continue
+		case got != want:
+			problems = append(problems, newPackMismatch(name, "object %s is at offset %d of pack %d, not %d", id, got, packID, want).WithOid(id).WithOffset(want))
+			continue
+		}
+		if _, err := source.TypeOf(id); err != nil {
+			problems = append(problems, newPackMismatch(name, "object %s at offset %d of pack %d: %v", id, want, packID, err).WithOid(id).WithOffset(want))
+		}
+	}
+	return problems
+}
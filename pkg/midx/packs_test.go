@@ -0,0 +1,62 @@
+package midx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+// testMidx is git multi-pack-index write over four packs of one commit each
+const testMidx = "testdata/multi-pack-index"
+
+func openTestMidx(t *testing.T, path string) *File {
+	f, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if err := f.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestVerifyPacks(t *testing.T) {
+	f := openTestMidx(t, testMidx)
+	if f.PackCount != 4 {
+		t.Fatalf("MIDX has %d packs, want 4", f.PackCount)
+	}
+	// one open pack at a time, evicted as the objects interleave
+	if problems := f.VerifyPacks(pack.NewFileBudget(1)); len(problems) != 0 {
+		t.Errorf("VerifyPacks = %v, want none", problems)
+	}
+}
+
+func TestVerifyPacksMissing(t *testing.T) {
+	dir := t.TempDir()
+	entries, err := os.ReadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join("testdata", entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, entry.Name()), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := openTestMidx(t, filepath.Join(dir, "multi-pack-index"))
+	missing := f.PackNames[1]
+	if err := os.Remove(filepath.Join(dir, missing[:len(missing)-len(".idx")]+".pack")); err != nil {
+		t.Fatal(err)
+	}
+
+	problems := f.VerifyPacks(nil)
+	if len(problems) != 1 || problems[0].Code != CodePackMismatch || problems[0].Data["pack"] != missing {
+		t.Errorf("VerifyPacks = %v, want one %s finding about %s", problems, CodePackMismatch, missing)
+	}
+}
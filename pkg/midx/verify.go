@@ -0,0 +1,75 @@
+package midx
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/adlternative/git-miner/pkg/bitmap"
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/finding"
+	"github.com/adlternative/git-miner/pkg/pack"
+	log "github.com/sirupsen/logrus"
+)
+
+// Verify checks a multi-pack-index, its packs, see VerifyPacks, which share
+// budget, and, if one exists, its bitmap. An empty bitmapPath means the
+// bitmap git would write next to the MIDX. Inconsistencies in baseline,
+// which may be nil, do not fail the check.
+func Verify(fileName string, bitmapPath string, baseline *finding.Baseline, budget *pack.FileBudget) error {
+	file, err := NewFile(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = file.Parse()
+	if err != nil {
+		return err
+	}
+	file.Show()
+
+	if failed := report(file.VerifyPacks(budget), baseline); failed > 0 {
+		return fmt.Errorf("%s has %d new inconsistencies with its packs", fileName, failed)
+	}
+
+	if bitmapPath == "" {
+		bitmapPath = file.BitmapPath()
+		if _, err := os.Stat(bitmapPath); os.IsNotExist(err) {
+			return nil
+		}
+	}
+
+	bitmapFile, err := bitmap.NewFile(bitmapPath)
+	if err != nil {
+		return err
+	}
+	err = bitmapFile.Parse()
+	if err != nil {
+		return fmt.Errorf("parse %s failed: %w", bitmapPath, err)
+	}
+	bitmapFile.Show()
+
+	if failed := report(file.VerifyBitmap(bitmapFile), baseline); failed > 0 {
+		return fmt.Errorf("%s has %d new inconsistencies with its multi-pack-index", bitmapPath, failed)
+	}
+	return nil
+}
+
+// report logs problems, marking those in baseline, and returns how many new
+// ones there are if they fail the check, else 0
+func report(problems []*finding.Finding, baseline *finding.Baseline) int {
+	baseline.Mark(problems...)
+	for _, problem := range problems {
+		log.Printf(catalog.Format(catalog.Finding), problem)
+	}
+	if !finding.Failed(problems) {
+		return 0
+	}
+	known := 0
+	for _, problem := range problems {
+		if problem.Known {
+			known++
+		}
+	}
+	return len(problems) - known
+}
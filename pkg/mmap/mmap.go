@@ -0,0 +1,14 @@
+package mmap
+
+// Map maps the file at path read-only into memory, so that large index files
+// cost page cache the kernel can reclaim rather than heap, and only the pages
+// that are looked at are read. The file must not be truncated while mapped,
+// git writes new index files instead of changing them. Unmap releases the
+// mapping, the bytes must not be used after.
+func Map(path string) ([]byte, error) {
+	return mapFile(path)
+}
+
+func Unmap(b []byte) error {
+	return unmapFile(b)
+}
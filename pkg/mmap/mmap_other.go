@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package mmap
+
+import "os"
+
+func mapFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func unmapFile(b []byte) error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// DiffTrees lists the entries only in a ("-"), only in b ("+") and those
+// whose mode or object changed ("~"), by name
+func DiffTrees(a, b []*TreeEntry) []string {
+	var lines []string
+	byName := make(map[string]*TreeEntry, len(b))
+	for _, entry := range b {
+		byName[entry.Name] = entry
+	}
+	seen := make(map[string]bool, len(a))
+	for _, old := range a {
+		seen[old.Name] = true
+		entry, ok := byName[old.Name]
+		switch {
+		case !ok:
+			lines = append(lines, "- "+old.String())
+		case old.Mode != entry.Mode || old.Oid != entry.Oid:
+			lines = append(lines, fmt.Sprintf("~ %s: %06o %s -> %06o %s", old.Name,
+				old.Mode, old.Oid, entry.Mode, entry.Oid))
+		}
+	}
+	for _, entry := range b {
+		if !seen[entry.Name] {
+			lines = append(lines, "+ "+entry.String())
+		}
+	}
+	return lines
+}
+
+// DiffCommits compares the headers of two commits or tags key by key, and
+// their messages
+func DiffCommits(a, b *Commit) []string {
+	var lines []string
+	var keys []string
+	seen := make(map[string]bool)
+	for _, header := range append(append([]Header{}, a.Headers...), b.Headers...) {
+		if !seen[header.Key] {
+			seen[header.Key] = true
+			keys = append(keys, header.Key)
+		}
+	}
+	for _, key := range keys {
+		values, others := a.Get(key), b.Get(key)
+		for i := 0; i < len(values) || i < len(others); i++ {
+			switch {
+			case i >= len(others):
+				lines = append(lines, fmt.Sprintf("- %s %s", key, values[i]))
+			case i >= len(values):
+				lines = append(lines, fmt.Sprintf("+ %s %s", key, others[i]))
+			case values[i] != others[i]:
+				lines = append(lines, fmt.Sprintf("~ %s: %q -> %q", key, values[i], others[i]))
+			}
+		}
+	}
+	if !bytes.Equal(a.Message, b.Message) {
+		lines = append(lines, "~ message: "+DiffBlobs(a.Message, b.Message)[0])
+	}
+	return lines
+}
+
+// DiffBlobs summarizes where two blobs differ
+func DiffBlobs(a, b []byte) []string {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	line := fmt.Sprintf("%d -> %d bytes, first difference at byte %d, %d bytes replaced by %d, %d common trailing bytes",
+		len(a), len(b), prefix, len(a)-prefix-suffix, len(b)-prefix-suffix, suffix)
+	if len(a) == len(b) {
+		differ := 0
+		for i := range a {
+			if a[i] != b[i] {
+				differ++
+			}
+		}
+		line += fmt.Sprintf(", %d bytes differ", differ)
+	}
+	return []string{line}
+}
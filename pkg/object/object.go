@@ -0,0 +1,112 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+// treeOidAlgorithm is the hash of the object ids trees refer to
+const treeOidAlgorithm = oid.SHA1
+
+// Header is a header line of a commit or tag, continuation lines of
+// multi-line headers such as gpgsig are joined with "\n"
+type Header struct {
+	Key   string
+	Value string
+}
+
+// Commit is a parsed commit object, tags share its layout
+type Commit struct {
+	Headers []Header
+	Message []byte
+}
+
+// Get returns the values of the headers named key in order
+func (c *Commit) Get(key string) []string {
+	var values []string
+	for _, header := range c.Headers {
+		if header.Key == key {
+			values = append(values, header.Value)
+		}
+	}
+	return values
+}
+
+// ParseCommit parses a commit or a tag
+func ParseCommit(data []byte) (*Commit, error) {
+	c := &Commit{}
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			return nil, fmt.Errorf("header line %d is not terminated", len(c.Headers)+1)
+		}
+		line := data[:end]
+		data = data[end+1:]
+		if len(line) == 0 {
+			c.Message = data
+			return c, nil
+		}
+		if line[0] == ' ' {
+			if len(c.Headers) == 0 {
+				return nil, fmt.Errorf("continuation line before the first header")
+			}
+			last := &c.Headers[len(c.Headers)-1]
+			last.Value += "\n" + string(line[1:])
+			continue
+		}
+		key, value, ok := bytes.Cut(line, []byte{' '})
+		if !ok {
+			return nil, fmt.Errorf("header line %q has no value", line)
+		}
+		c.Headers = append(c.Headers, Header{Key: string(key), Value: string(value)})
+	}
+	// a commit without a message has no blank line either
+	return c, nil
+}
+
+// TreeEntry is an entry of a tree object
+type TreeEntry struct {
+	Mode uint32
+	Name string
+	Oid  oid.Oid
+}
+
+func (e *TreeEntry) String() string {
+	return fmt.Sprintf("%06o %s %s", e.Mode, e.Oid, e.Name)
+}
+
+// ParseTree parses a tree object
+func ParseTree(data []byte) ([]*TreeEntry, error) {
+	var entries []*TreeEntry
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		if space <= 0 {
+			return nil, fmt.Errorf("tree entry %d has no mode", len(entries))
+		}
+		mode, err := strconv.ParseUint(string(data[:space]), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("tree entry %d has a bad mode %q", len(entries), data[:space])
+		}
+		data = data[space+1:]
+		nul := bytes.IndexByte(data, 0)
+		if nul <= 0 {
+			return nil, fmt.Errorf("tree entry %d has no name", len(entries))
+		}
+		name := string(data[:nul])
+		data = data[nul+1:]
+		size := treeOidAlgorithm.Size()
+		if len(data) < size {
+			return nil, fmt.Errorf("tree entry %q is truncated", name)
+		}
+		entries = append(entries, &TreeEntry{
+			Mode: uint32(mode),
+			Name: name,
+			Oid:  oid.MustNew(treeOidAlgorithm, data[:size]),
+		})
+		data = data[size:]
+	}
+	return entries, nil
+}
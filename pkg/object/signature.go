@@ -0,0 +1,186 @@
+package object
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+var ErrBadSignature = errors.New("malformed signature")
+
+// signatureFormats are the armors git knows, by the gpg.format they belong to
+var signatureFormats = []struct {
+	format string
+	begin  string
+	end    string
+}{
+	{"openpgp", "-----BEGIN PGP SIGNATURE-----", "-----END PGP SIGNATURE-----"},
+	{"openpgp", "-----BEGIN PGP MESSAGE-----", "-----END PGP MESSAGE-----"},
+	{"x509", "-----BEGIN SIGNED MESSAGE-----", "-----END SIGNED MESSAGE-----"},
+	{"ssh", "-----BEGIN SSH SIGNATURE-----", "-----END SSH SIGNATURE-----"},
+}
+
+// Signature is a signature of a commit or tag. Only its framing is checked,
+// nothing here tells whether it is valid.
+type Signature struct {
+	// Format is "openpgp", "x509" or "ssh" like git's gpg.format, "" when
+	// the armor is not one git knows
+	Format string
+	// Header is the header holding the signature, "" for the signature at
+	// the end of a tag message
+	Header string
+	// Armor is the signature as written, without continuation spaces
+	Armor string
+
+	end string
+}
+
+func newSignature(header string, armor string) *Signature {
+	s := &Signature{Header: header, Armor: armor}
+	for _, f := range signatureFormats {
+		if strings.HasPrefix(armor, f.begin) {
+			s.Format, s.end = f.format, f.end
+			break
+		}
+	}
+	return s
+}
+
+// Signatures returns the signatures in the gpgsig and gpgsig-sha256 headers
+func (c *Commit) Signatures() []*Signature {
+	var signatures []*Signature
+	for _, header := range c.Headers {
+		if header.Key == "gpgsig" || header.Key == "gpgsig-sha256" {
+			signatures = append(signatures, newSignature(header.Key, header.Value))
+		}
+	}
+	return signatures
+}
+
+// SignatureHeader returns the header git signs commits in for object ids of
+// algo: gpgsig for SHA-1, gpgsig-sha256 for SHA-256. The other one holds the
+// signature of the object converted to the other hash.
+func SignatureHeader(algo oid.Algorithm) string {
+	if algo == oid.SHA256 {
+		return "gpgsig-sha256"
+	}
+	return "gpgsig"
+}
+
+// MessageSignature returns the signature git appends to the message of a
+// signed tag: the message from the last line starting an armor it knows, nil
+// if there is none
+func (c *Commit) MessageSignature() *Signature {
+	start := -1
+	for pos := 0; pos < len(c.Message); {
+		for _, f := range signatureFormats {
+			if bytes.HasPrefix(c.Message[pos:], []byte(f.begin)) {
+				start = pos
+			}
+		}
+		end := bytes.IndexByte(c.Message[pos:], '\n')
+		if end < 0 {
+			break
+		}
+		pos += end + 1
+	}
+	if start < 0 {
+		return nil
+	}
+	return newSignature("", string(c.Message[start:]))
+}
+
+// Check checks the framing of the signature: the armor lines, the openpgp
+// armor headers and checksum, the base64 and the start of the decoded data
+func (s *Signature) Check() error {
+	if s.Format == "" {
+		return fmt.Errorf("%w: does not start with an armor git knows", ErrBadSignature)
+	}
+	lines := strings.Split(strings.TrimSuffix(s.Armor, "\n"), "\n")
+	for len(lines) > 1 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) < 2 || lines[len(lines)-1] != s.end {
+		return fmt.Errorf("%w: does not end with %q", ErrBadSignature, s.end)
+	}
+	body := lines[1 : len(lines)-1]
+
+	if s.Format == "openpgp" {
+		blank := -1
+		for i, line := range body {
+			if line == "" {
+				blank = i
+				break
+			}
+		}
+		if blank < 0 {
+			return fmt.Errorf("%w: no blank line after the armor headers", ErrBadSignature)
+		}
+		for _, line := range body[:blank] {
+			if !strings.Contains(line, ": ") {
+				return fmt.Errorf("%w: bad armor header %q", ErrBadSignature, line)
+			}
+		}
+		body = body[blank+1:]
+		if n := len(body); n > 0 && strings.HasPrefix(body[n-1], "=") {
+			if crc, err := base64.StdEncoding.DecodeString(body[n-1][1:]); err != nil || len(crc) != 3 {
+				return fmt.Errorf("%w: bad armor checksum %q", ErrBadSignature, body[n-1])
+			}
+			body = body[:n-1]
+		}
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.Join(body, ""))
+	if err != nil {
+		return fmt.Errorf("%w: bad base64: %v", ErrBadSignature, err)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("%w: no signature data", ErrBadSignature)
+	}
+	switch {
+	case s.Format == "openpgp" && data[0]&0x80 == 0:
+		return fmt.Errorf("%w: data is no openpgp packet", ErrBadSignature)
+	case s.Format == "x509" && data[0] != 0x30:
+		return fmt.Errorf("%w: data is no DER sequence", ErrBadSignature)
+	case s.Format == "ssh" && !bytes.HasPrefix(data, []byte("SSHSIG")):
+		return fmt.Errorf("%w: data does not start with SSHSIG", ErrBadSignature)
+	}
+	return nil
+}
+
+// Payload returns what the signature signs, given the object data it was
+// found in: the object without its signature headers, or the tag up to the
+// signature at the end of its message
+func (s *Signature) Payload(data []byte) []byte {
+	if s.Header == "" {
+		return data[:len(data)-len(s.Armor)]
+	}
+
+	payload := make([]byte, 0, len(data))
+	inSignature := false
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		line := data[:end]
+		data = data[end:]
+		if len(line) == 1 {
+			// the blank line, the message follows
+			payload = append(payload, line...)
+			return append(payload, data...)
+		}
+		if line[0] != ' ' {
+			key, _, _ := bytes.Cut(line, []byte{' '})
+			inSignature = string(key) == "gpgsig" || string(key) == "gpgsig-sha256"
+		}
+		if !inSignature {
+			payload = append(payload, line...)
+		}
+	}
+	return payload
+}
@@ -0,0 +1,160 @@
+package oid
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+)
+
+// Algorithm is the hash function object ids are computed with
+type Algorithm uint8
+
+const (
+	SHA1 Algorithm = iota + 1
+	SHA256
+)
+
+// MaxSize is the size of the longest object id
+const MaxSize = sha256.Size
+
+var algorithms = map[Algorithm]struct {
+	name string
+	size int
+	new  func() hash.Hash
+}{
+	SHA1:   {"sha1", sha1.Size, sha1.New},
+	SHA256: {"sha256", sha256.Size, sha256.New},
+}
+
+func (a Algorithm) String() string {
+	if algo, ok := algorithms[a]; ok {
+		return algo.name
+	}
+	return fmt.Sprintf("Algorithm(%d)", uint8(a))
+}
+
+// Size is the length of the ids of a in bytes, zero for an unknown algorithm
+func (a Algorithm) Size() int {
+	return algorithms[a].size
+}
+
+// New returns a hash computing ids of a
+func (a Algorithm) New() hash.Hash {
+	return algorithms[a].new()
+}
+
+// Oid is an object id of any algorithm. It is a comparable value, usable as a
+// map key, and the zero Oid stands for no object.
+type Oid struct {
+	algo Algorithm
+	raw  [MaxSize]byte
+}
+
+// New returns the id of algo held in b
+func New(algo Algorithm, b []byte) (Oid, error) {
+	size := algo.Size()
+	if size == 0 {
+		return Oid{}, fmt.Errorf("unknown hash algorithm %v", algo)
+	}
+	if len(b) != size {
+		return Oid{}, fmt.Errorf("%s object id has %d bytes, expect %d", algo, len(b), size)
+	}
+	o := Oid{algo: algo}
+	copy(o.raw[:], b)
+	return o, nil
+}
+
+// MustNew is New for bytes known to be of the right length, it panics
+// otherwise
+func MustNew(algo Algorithm, b []byte) Oid {
+	o, err := New(algo, b)
+	if err != nil {
+		panic(err)
+	}
+	return o
+}
+
+// Sum returns the digest of h, a hash returned by Algorithm.New, as an id
+func Sum(h hash.Hash) Oid {
+	for algo, a := range algorithms {
+		if a.size == h.Size() {
+			return MustNew(algo, h.Sum(nil))
+		}
+	}
+	panic(fmt.Sprintf("no hash algorithm has %d byte ids", h.Size()))
+}
+
+// FromHex parses a hex object id, its length tells the algorithm
+func FromHex(s string) (Oid, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return Oid{}, fmt.Errorf("invalid object id %q: %w", s, err)
+	}
+	for algo, a := range algorithms {
+		if a.size == len(b) {
+			return MustNew(algo, b), nil
+		}
+	}
+	return Oid{}, fmt.Errorf("invalid object id %q: no hash algorithm has %d byte ids", s, len(b))
+}
+
+func (o Oid) Algorithm() Algorithm {
+	return o.algo
+}
+
+// Bytes returns the raw id, empty for the zero Oid
+func (o Oid) Bytes() []byte {
+	return o.raw[:o.algo.Size()]
+}
+
+func (o Oid) IsZero() bool {
+	return o.algo == 0
+}
+
+// Compare orders ids by algorithm, then bytewise
+func (o Oid) Compare(other Oid) int {
+	if o.algo != other.algo {
+		if o.algo < other.algo {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(o.raw[:], other.raw[:])
+}
+
+// String returns the id in hex, empty for the zero Oid
+func (o Oid) String() string {
+	return hex.EncodeToString(o.Bytes())
+}
+
+// Format prints the id in hex for the verbs of strings and byte slices
+func (o Oid) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 'X':
+		fmt.Fprintf(f, "%X", o.Bytes())
+	case 'q':
+		fmt.Fprintf(f, "%q", o.String())
+	default:
+		fmt.Fprint(f, o.String())
+	}
+}
+
+func (o Oid) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *Oid) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*o = Oid{}
+		return nil
+	}
+	parsed, err := FromHex(string(text))
+	if err != nil {
+		return err
+	}
+	*o = parsed
+	return nil
+}
@@ -0,0 +1,188 @@
+//go:build !noarchive
+
+package pack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/catalog"
+	log "github.com/sirupsen/logrus"
+)
+
+// archivePack is a pack found in an archive. Packs stored uncompressed are
+// read in place at offset, others are copied out to a temporary file first.
+type archivePack struct {
+	name   string
+	offset int64
+	size   int64
+	tmp    *TempFile
+}
+
+func isPackName(name string) bool {
+	base := path.Base(name)
+	return strings.HasPrefix(base, "pack-") && strings.HasSuffix(base, ".pack")
+}
+
+// spool copies a compressed pack out of the archive, next to the temporary
+// files of our writers
+func spool(name string, r io.Reader) (*archivePack, error) {
+	tmp, err := CreateTempFile("", TmpPackPrefix)
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Cleanup()
+		return nil, fmt.Errorf("copy %s out of the archive: %w", name, err)
+	}
+	return &archivePack{name: name, size: size, tmp: tmp}, nil
+}
+
+// countingReader tells where in a plain tar the data of a member starts
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func findTarPacks(archivePath string) ([]*archivePack, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	compressed := !strings.HasSuffix(archivePath, ".tar")
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	counter := &countingReader{r: r}
+	tr := tar.NewReader(counter)
+
+	var packs []*archivePack
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return packs, nil
+		} else if err != nil {
+			return packs, err
+		}
+		if header.Typeflag != tar.TypeReg || !isPackName(header.Name) {
+			continue
+		}
+		if compressed {
+			pack, err := spool(header.Name, tr)
+			if err != nil {
+				return packs, err
+			}
+			packs = append(packs, pack)
+			continue
+		}
+		// tar reads whole 512 byte blocks, so the data starts right here
+		packs = append(packs, &archivePack{
+			name:   header.Name,
+			offset: counter.n,
+			size:   header.Size,
+		})
+	}
+}
+
+func findZipPacks(archivePath string) ([]*archivePack, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var packs []*archivePack
+	for _, f := range zr.File {
+		if f.Mode().IsDir() || !isPackName(f.Name) {
+			continue
+		}
+		if f.Method == zip.Store {
+			offset, err := f.DataOffset()
+			if err != nil {
+				return packs, err
+			}
+			packs = append(packs, &archivePack{
+				name:   f.Name,
+				offset: offset,
+				size:   int64(f.UncompressedSize64),
+			})
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return packs, err
+		}
+		pack, err := spool(f.Name, r)
+		r.Close()
+		if err != nil {
+			return packs, err
+		}
+		packs = append(packs, pack)
+	}
+	return packs, nil
+}
+
+// VerifyArchive verifies every pack-*.pack in a tar, tar.gz or zip archive
+// such as a backup of a repository, without extracting the archive.
+func VerifyArchive(archivePath string, opts ...Option) error {
+	var packs []*archivePack
+	var err error
+	if strings.HasSuffix(archivePath, ".zip") {
+		packs, err = findZipPacks(archivePath)
+	} else {
+		packs, err = findTarPacks(archivePath)
+	}
+	defer func() {
+		for _, pack := range packs {
+			if pack.tmp != nil {
+				pack.tmp.Cleanup()
+			}
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	if len(packs) == 0 {
+		return fmt.Errorf("no packs in %s", archivePath)
+	}
+
+	for _, pack := range packs {
+		name := archivePath + ":" + pack.name
+		log.Printf(catalog.Format(catalog.ArchivePack), name)
+
+		var packFile *PackFile
+		if pack.tmp != nil {
+			packFile, err = newPackFile(pack.tmp.Name(), 0, -1, opts)
+		} else {
+			packFile, err = newPackFile(archivePath, pack.offset, pack.size, opts)
+		}
+		if err == nil {
+			err = packFile.verify(name)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
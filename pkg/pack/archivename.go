@@ -0,0 +1,17 @@
+package pack
+
+import "strings"
+
+var archiveSuffixes = []string{".tar", ".tar.gz", ".tgz", ".zip"}
+
+// IsArchive returns whether path looks like a tar or zip archive. It is in
+// every build, so that one without VerifyArchive can still tell archives
+// from packs.
+func IsArchive(archivePath string) bool {
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(archivePath, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -15,8 +15,12 @@ type buffer struct {
 }
 
 func newBuffer(reader io.Reader) *buffer {
+	return newBufferSize(reader, DefaultBufferSize)
+}
+
+func newBufferSize(reader io.Reader, size int) *buffer {
 	return &buffer{
-		buf:    make([]byte, DefaultBufferSize),
+		buf:    make([]byte, size),
 		reader: reader,
 	}
 }
@@ -35,7 +39,7 @@ func (b *buffer) Fill(min uint64) ([]byte, error) {
 	if min <= b.length {
 		return b.buf[b.offset : b.offset+b.length], nil
 	}
-	if min > DefaultBufferSize {
+	if min > uint64(len(b.buf)) {
 		return nil, fmt.Errorf("cannot fill %d bytes", min)
 	}
 
@@ -43,12 +47,14 @@ func (b *buffer) Fill(min uint64) ([]byte, error) {
 
 	for b.length < min {
 		ret, err := b.reader.Read(b.buf[b.offset+b.length:])
+		b.length += uint64(ret)
 		if err != nil {
-			if err == io.EOF {
-				return nil, err
+			// readers like io.SectionReader return the last bytes along with io.EOF
+			if b.length >= min {
+				break
 			}
+			return nil, err
 		}
-		b.length += uint64(ret)
 	}
 
 	return b.buf[:min], nil
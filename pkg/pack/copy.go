@@ -0,0 +1,27 @@
+//go:build !nowriter
+
+package pack
+
+import (
+	"bufio"
+	"path/filepath"
+)
+
+// VerifyTo verifies the pack like Verify while copying it to outPath, which
+// only appears once the pack verified.
+func VerifyTo(packPath string, outPath string, opts ...Option) error {
+	tmp, err := CreateTempFile(filepath.Dir(outPath), TmpPackPrefix)
+	if err != nil {
+		return err
+	}
+	defer tmp.Cleanup()
+	// the scan hands over the pack in small pieces
+	w := bufio.NewWriter(tmp)
+	if err := Verify(packPath, append(opts[:len(opts):len(opts)], WithTee(w))...); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return tmp.Commit(outPath)
+}
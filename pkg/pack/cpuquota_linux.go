@@ -0,0 +1,99 @@
+package pack
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cpuQuota returns the CPU quota of the cgroup of the process in CPUs, ok is
+// false without a limit. Both cgroup v2 and the v1 cpu controller are looked
+// at.
+func cpuQuota() (quota float64, ok bool) {
+	content, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			if quota, ok := cgroup2Quota(fields[2]); ok {
+				return quota, true
+			}
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == "cpu" {
+				if quota, ok := cgroup1Quota(fields[1], fields[2]); ok {
+					return quota, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// cgroup2Quota reads cpu.max of the cgroup at path and of its parents, the
+// tightest limit applies
+func cgroup2Quota(path string) (quota float64, ok bool) {
+	for dir := filepath.Join(cgroupRoot, path); strings.HasPrefix(dir, cgroupRoot); dir = filepath.Dir(dir) {
+		content, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+		if err == nil {
+			// "$MAX $PERIOD", $MAX is "max" without a limit
+			fields := strings.Fields(string(content))
+			if len(fields) == 2 {
+				if q, ok2 := parseQuota(fields[0], fields[1]); ok2 && (!ok || q < quota) {
+					quota, ok = q, true
+				}
+			}
+		}
+		if dir == cgroupRoot {
+			break
+		}
+	}
+	return quota, ok
+}
+
+// cgroup1Quota reads cpu.cfs_quota_us and cpu.cfs_period_us of the cgroup at
+// path of the hierarchy mounted for controllers. Inside a container the
+// hierarchy is usually mounted at the cgroup itself, so its root is tried
+// too.
+func cgroup1Quota(controllers string, path string) (float64, bool) {
+	mount := filepath.Join(cgroupRoot, controllers)
+	if _, err := os.Stat(mount); err != nil {
+		mount = filepath.Join(cgroupRoot, "cpu")
+	}
+	for _, dir := range []string{filepath.Join(mount, path), mount} {
+		quota, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+		if err != nil {
+			continue
+		}
+		period, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+		if err != nil {
+			continue
+		}
+		return parseQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+	}
+	return 0, false
+}
+
+// parseQuota divides a quota by its period, both in microseconds, v1 writes
+// -1 and v2 "max" for no limit
+func parseQuota(quota string, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return q / p, true
+}
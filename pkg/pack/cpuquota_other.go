@@ -0,0 +1,9 @@
+//go:build !linux
+
+package pack
+
+// cpuQuota returns the CPU quota of the process, there is none outside of
+// Linux cgroups
+func cpuQuota() (quota float64, ok bool) {
+	return 0, false
+}
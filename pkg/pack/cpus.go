@@ -0,0 +1,30 @@
+package pack
+
+import (
+	"math"
+	"runtime"
+	"sync"
+)
+
+var (
+	cpusOnce sync.Once
+	cpus     int
+)
+
+// availableCPUs returns how many CPUs the process can make use of: the lower
+// of GOMAXPROCS and the CPU quota of its cgroup, rounded up. A throttled
+// container would only be slowed down by one goroutine per host CPU.
+func availableCPUs() int {
+	cpusOnce.Do(func() {
+		cpus = runtime.GOMAXPROCS(0)
+		if quota, ok := cpuQuota(); ok {
+			if n := int(math.Ceil(quota)); n < cpus {
+				cpus = n
+			}
+		}
+		if cpus < 1 {
+			cpus = 1
+		}
+	})
+	return cpus
+}
@@ -0,0 +1,144 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+// idxEntry is what an idx tells about an object without reading the pack
+type idxEntry struct {
+	crc32      uint32
+	hasCRC     bool
+	packedSize uint64
+}
+
+// generation maps the object ids of a set of packs to their entries
+type generation map[oid.Oid]*idxEntry
+
+// DedupStats compares two generations of the packs of a repository, e.g.
+// before and after a repack or a mirror sync. Objects appear in a
+// generation once even if several of its packs have them; the entry seen
+// first counts.
+type DedupStats struct {
+	OldObjects uint64
+	NewObjects uint64
+	OldBytes   uint64
+	NewBytes   uint64
+	// CommonObjects are in both generations, CommonBytes is their size in
+	// the new one
+	CommonObjects uint64
+	CommonBytes   uint64
+	// SameEntries are the common objects stored byte for byte the same,
+	// by crc32 and packed size, so a copy of the old packs has them already
+	SameEntries    uint64
+	SameEntryBytes uint64
+	NewOnlyObjects uint64
+	NewOnlyBytes   uint64
+	OldOnlyObjects uint64
+	OldOnlyBytes   uint64
+}
+
+// packsIn returns the packs at path, a pack directory or a single pack
+func packsIn(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{strings.TrimSuffix(strings.TrimSuffix(path, ".idx"), ".pack") + ".pack"}, nil
+	}
+	packs, err := filepath.Glob(filepath.Join(path, "pack-*.pack"))
+	if err != nil {
+		return nil, err
+	}
+	if len(packs) == 0 {
+		return nil, fmt.Errorf("no packs in %s", path)
+	}
+	return packs, nil
+}
+
+func loadGeneration(path string) (generation, error) {
+	packs, err := packsIn(path)
+	if err != nil {
+		return nil, err
+	}
+	gen := make(generation)
+	for _, packPath := range packs {
+		stat, err := os.Stat(packPath)
+		if err != nil {
+			return nil, err
+		}
+		if stat.Size() < int64(headerSize+hashSize) {
+			return nil, fmt.Errorf("%s is too small for a pack", packPath)
+		}
+		idxPath := strings.TrimSuffix(packPath, ".pack") + ".idx"
+		idx, err := OpenIdx(idxPath, false)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", idxPath, err)
+		}
+		entries, err := idxEntries(idx, uint64(stat.Size())-uint64(hashSize))
+		if err != nil {
+			idx.Close()
+			return nil, fmt.Errorf("%s: %w", idxPath, err)
+		}
+		for _, obj := range entries {
+			id := idx.Oid(obj.index)
+			if gen[id] != nil {
+				continue
+			}
+			crc, ok := idx.CRC32(obj.index)
+			gen[id] = &idxEntry{
+				crc32:      crc,
+				hasCRC:     ok,
+				packedSize: obj.packedSize,
+			}
+		}
+		idx.Close()
+	}
+	return gen, nil
+}
+
+// CompareGenerations reports how much of the packs at newPath the packs at
+// oldPath already hold, each a pack directory or a single pack. Only the
+// idx files are read.
+func CompareGenerations(oldPath string, newPath string) (*DedupStats, error) {
+	oldGen, err := loadGeneration(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newGen, err := loadGeneration(newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DedupStats{}
+	for id, entry := range oldGen {
+		stats.OldObjects++
+		stats.OldBytes += entry.packedSize
+		if newGen[id] == nil {
+			stats.OldOnlyObjects++
+			stats.OldOnlyBytes += entry.packedSize
+		}
+	}
+	for id, entry := range newGen {
+		stats.NewObjects++
+		stats.NewBytes += entry.packedSize
+		old := oldGen[id]
+		if old == nil {
+			stats.NewOnlyObjects++
+			stats.NewOnlyBytes += entry.packedSize
+			continue
+		}
+		stats.CommonObjects++
+		stats.CommonBytes += entry.packedSize
+		if old.hasCRC && entry.hasCRC && old.crc32 == entry.crc32 && old.packedSize == entry.packedSize {
+			stats.SameEntries++
+			stats.SameEntryBytes += entry.packedSize
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,212 @@
+//go:build !noreport
+
+package pack
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+// DeltaGraph is the delta dependency graph of a pack, to see the structure
+// of its chains: its deltas and the bases they need as nodes, and an edge
+// from each delta to its base. Objects no delta needs are left out.
+type DeltaGraph struct {
+	Nodes []*DeltaNode `json:"nodes"`
+	Edges []*DeltaEdge `json:"edges"`
+}
+
+// DeltaNode is an object of a DeltaGraph. ID is "o<offset>" for an entry of
+// the pack and "x<oid>" for a ref-delta base outside of it.
+type DeltaNode struct {
+	ID         string `json:"id"`
+	Oid        string `json:"oid,omitempty"`
+	Offset     uint64 `json:"offset,omitempty"`
+	Type       string `json:"type"`
+	Size       uint64 `json:"size"`
+	PackedSize uint64 `json:"packedSize,omitempty"`
+	// Depth is the length of the chain down to a non-delta, Children how
+	// many deltas have the node as their base
+	Depth    uint32 `json:"depth"`
+	Children int    `json:"children"`
+	// External is set for a base taken from the ObjectSource, Missing for
+	// one found nowhere
+	External bool `json:"external,omitempty"`
+	Missing  bool `json:"missing,omitempty"`
+}
+
+type DeltaEdge struct {
+	Delta string `json:"delta"`
+	Base  string `json:"base"`
+}
+
+// DeltaGraphOf parses and resolves the pack to return its delta graph. A pack
+// that fails to resolve still gets one, its object ids are then missing
+// where resolution stopped. When the scan fails, the graph of the entries
+// before the failure comes with the error.
+func DeltaGraphOf(packPath string, opts ...Option) (*DeltaGraph, error) {
+	packFile, err := NewPackFile(packPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer packFile.Close()
+
+	if err := packFile.ParseHeader(); err != nil {
+		return nil, err
+	}
+	if err := packFile.ParseObjects(); err != nil {
+		return packFile.DeltaGraph(), err
+	}
+	// the edges come from the entry headers, resolving only names the nodes
+	_ = packFile.ResolveObjects()
+	return packFile.DeltaGraph(), nil
+}
+
+// DeltaGraph returns the delta graph of the objects found by ParseObjects
+func (pf *PackFile) DeltaGraph() *DeltaGraph {
+	byOid := make(map[oid.Oid]*Object, len(pf.objects))
+	for _, obj := range pf.objects {
+		if !obj.oid.IsZero() {
+			byOid[obj.oid] = obj
+		}
+	}
+	external := make(map[oid.Oid]*Object, len(pf.externalBases))
+	for _, base := range pf.externalBases {
+		external[base.oid] = base
+	}
+
+	g := &DeltaGraph{}
+	nodes := make(map[string]*DeltaNode)
+	node := func(obj *Object) *DeltaNode {
+		id := fmt.Sprintf("o%d", obj.offset)
+		if n, ok := nodes[id]; ok {
+			return n
+		}
+		n := &DeltaNode{
+			ID:         id,
+			Offset:     obj.offset,
+			Type:       obj._type.String(),
+			Size:       obj.size,
+			PackedSize: obj.packedSize,
+		}
+		if !obj.oid.IsZero() {
+			n.Oid = obj.oid.String()
+		}
+		nodes[id] = n
+		return n
+	}
+	// outside returns the node of a base that is no entry of the pack, missing
+	// unless the ObjectSource has it
+	outside := func(id string) *DeltaNode {
+		if n, ok := nodes[id]; ok {
+			return n
+		}
+		n := &DeltaNode{ID: id, Missing: true}
+		nodes[id] = n
+		return n
+	}
+
+	bases := make(map[string]string)
+	for _, obj := range pf.objects {
+		var base *DeltaNode
+		switch obj._type {
+		case ObjOfsDelta:
+			offset := obj.offset - obj.baseDistance
+			i := sort.Search(len(pf.objects), func(i int) bool {
+				return pf.objects[i].offset >= offset
+			})
+			if i < len(pf.objects) && pf.objects[i].offset == offset {
+				base = node(pf.objects[i])
+			} else {
+				base = outside(fmt.Sprintf("o%d", offset))
+				base.Offset = offset
+			}
+		case ObjRefDelta:
+			if inPack, ok := byOid[obj.baseOid]; ok {
+				base = node(inPack)
+			} else if ext, ok := external[obj.baseOid]; ok {
+				base = outside("x" + obj.baseOid.String())
+				base.Oid, base.Type, base.Size = obj.baseOid.String(), ext.realType.String(), ext.size
+				base.External, base.Missing = true, false
+			} else {
+				base = outside("x" + obj.baseOid.String())
+				base.Oid = obj.baseOid.String()
+			}
+		default:
+			continue
+		}
+		delta := node(obj)
+		base.Children++
+		bases[delta.ID] = base.ID
+		g.Edges = append(g.Edges, &DeltaEdge{Delta: delta.ID, Base: base.ID})
+	}
+
+	// depths follow the edges, so they are known for unresolved chains too
+	depths := make(map[string]uint32, len(nodes))
+	var depth func(id string) uint32
+	depth = func(id string) uint32 {
+		if d, ok := depths[id]; ok {
+			return d
+		}
+		// a cycle of broken ofs-deltas ends here
+		depths[id] = 0
+		if base, ok := bases[id]; ok {
+			depths[id] = depth(base) + 1
+		}
+		return depths[id]
+	}
+	for _, n := range nodes {
+		n.Depth = depth(n.ID)
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		a, b := g.Nodes[i], g.Nodes[j]
+		if a.Offset != b.Offset {
+			return a.Offset < b.Offset
+		}
+		return a.ID < b.ID
+	})
+	return g
+}
+
+// WriteDOT writes the graph for Graphviz, e.g. dot -Tsvg. Non-delta bases
+// are boxes, the missing ones red.
+func (g *DeltaGraph) WriteDOT(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "digraph deltas {\n\trankdir=LR;\n\tnode [fontsize=10];"); err != nil {
+		return err
+	}
+	for _, n := range g.Nodes {
+		name := n.Oid
+		if len(name) > 12 {
+			name = name[:12]
+		}
+		if name == "" {
+			name = n.ID
+		}
+		attrs := "shape=ellipse"
+		switch {
+		case n.Missing:
+			attrs = "shape=box,color=red"
+		case n.External:
+			attrs = "shape=box,style=dashed"
+		case n.Depth == 0:
+			attrs = "shape=box"
+		}
+		label := fmt.Sprintf("%s\\n%s %d bytes\\ndepth %d, %d children", name, n.Type, n.Size, n.Depth, n.Children)
+		if n.Missing {
+			label = name + "\\nmissing"
+		}
+		if _, err := fmt.Fprintf(w, "\t%s [%s,label=\"%s\"];\n", n.ID, attrs, label); err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Edges {
+		if _, err := fmt.Fprintf(w, "\t%s -> %s;\n", e.Delta, e.Base); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
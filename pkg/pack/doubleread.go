@@ -0,0 +1,67 @@
+package pack
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ErrStorageCorrupt means two reads of the same bytes of an unchanged pack
+// returned different data. The fault is below the pack, in memory, the
+// controller or the disk, and says nothing about the content of the pack.
+var ErrStorageCorrupt = errors.New("storage returned different data for the same bytes")
+
+// extentCRC32 reads the entry of obj from the pack once more and returns its
+// crc32, asking the kernel to drop the cached pages first so the bytes come
+// from the device again where it can
+func (r *resolver) extentCRC32(obj *Object) (uint32, error) {
+	if err := r.pf.file.dropRange(int64(obj.offset), int64(obj.packedSize)); err != nil {
+		return 0, err
+	}
+	crc := crc32.NewIEEE()
+	_, err := io.Copy(crc, io.NewSectionReader(r.pf.file, int64(obj.offset), int64(obj.packedSize)))
+	return crc.Sum32(), err
+}
+
+// checkDoubleRead compares the crc32 the resolver read obj with to that of a
+// second read in double read mode
+func (r *resolver) checkDoubleRead(obj *Object) error {
+	if !r.pf.doubleRead {
+		return nil
+	}
+	crc, err := r.extentCRC32(obj)
+	if err != nil {
+		return err
+	}
+	if crc != obj.crc32 {
+		return r.storageError(fmt.Errorf("%w: entry crc32 was %08x on the first read and %08x on the second", ErrStorageCorrupt, obj.crc32, crc))
+	}
+	return nil
+}
+
+// checkFailedRead tells, in double read mode, if an entry failed to resolve
+// with err because of the storage: its bytes differ between two more reads
+func (r *resolver) checkFailedRead(obj *Object, err error) error {
+	if !r.pf.doubleRead {
+		return err
+	}
+	first, readErr := r.extentCRC32(obj)
+	if readErr != nil {
+		return err
+	}
+	second, readErr := r.extentCRC32(obj)
+	if readErr != nil || first == second {
+		return err
+	}
+	return r.storageError(fmt.Errorf("%w: entry crc32 was %08x and %08x on two more reads (it failed with: %v)", ErrStorageCorrupt, first, second, err))
+}
+
+// storageError blames the storage for err unless the pack changed, which the
+// differing reads would be just as well explained by
+func (r *resolver) storageError(err error) error {
+	if changed := r.pf.CheckUnchanged(); changed != nil {
+		return changed
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+//go:build !noreport
+
+package pack
+
+import (
+	"errors"
+	"io"
+
+	"github.com/adlternative/git-miner/pkg/catalog"
+)
+
+// Explanation tells a user who is no git expert what a failed verification
+// means and what to do about it
+type Explanation struct {
+	// Class names the kind of failure, Summary says what it means
+	Class     string
+	Summary   string
+	Causes    []string
+	NextSteps []string
+}
+
+// explanations are tried in order, the first one matching the error wins.
+// key names the texts of the explanation in the message catalog.
+var explanations = []struct {
+	is  func(err error) bool
+	key string
+}{
+	{hasCode(CodePackChanged), CodePackChanged},
+	{hasCode(CodeStorage), CodeStorage},
+	{is(ErrNotPack), CodeCorrupt + ".not-pack"},
+	{isTruncated, CodeCorrupt + ".truncated"},
+	{is(ErrChecksumMismatch), CodeCorrupt + ".checksum-mismatch"},
+	{hasCode(CodeMissingObject), CodeMissingObject},
+	{hasCode(CodeBadDelta), CodeBadDelta},
+	{hasCode(CodeRejected), CodeRejected},
+}
+
+func hasCode(code string) func(err error) bool {
+	return func(err error) bool {
+		return AsFinding(err).Code == code
+	}
+}
+
+func is(target error) func(err error) bool {
+	return func(err error) bool {
+		return errors.Is(err, target)
+	}
+}
+
+func isTruncated(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Explain returns a plain-language explanation of the failure err, nil for
+// a nil err. The texts come from the message catalog, the failures no more
+// specific explanation covers get the one of CodeCorrupt.
+func Explain(err error) *Explanation {
+	if err == nil {
+		return nil
+	}
+	key := CodeCorrupt
+	for _, e := range explanations {
+		if e.is(err) {
+			key = e.key
+			break
+		}
+	}
+	e := &Explanation{}
+	e.Class, e.Summary, e.Causes, e.NextSteps, _ = catalog.Explanation(key)
+	return e
+}
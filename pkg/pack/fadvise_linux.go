@@ -0,0 +1,15 @@
+package pack
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func dropPageCache(file *os.File) error {
+	return unix.Fadvise(int(file.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
+
+func dropPageRange(file *os.File, off int64, n int64) error {
+	return unix.Fadvise(int(file.Fd()), off, n, unix.FADV_DONTNEED)
+}
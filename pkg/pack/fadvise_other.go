@@ -0,0 +1,14 @@
+//go:build !linux
+
+package pack
+
+import "os"
+
+// dropPageCache is a no-op where posix_fadvise is not available
+func dropPageCache(file *os.File) error {
+	return nil
+}
+
+func dropPageRange(file *os.File, off int64, n int64) error {
+	return nil
+}
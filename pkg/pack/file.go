@@ -0,0 +1,286 @@
+package pack
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// ErrPackChanged means the pack file was modified or replaced, e.g. by a
+// concurrent repack, while it was being read. Errors found in such a pack
+// are not evidence of corruption.
+var ErrPackChanged = errors.New("pack changed while being verified")
+
+// nfsBufferSize is the read size in network filesystem mode, large
+// sequential reads save round trips to the server.
+const nfsBufferSize = 1 << 20
+
+// staleRetries is how often a read is retried after a stale file handle
+const staleRetries = 3
+
+// packReader reads the pack file. Sequential reads are done with ReadAt as
+// well, so that after a stale file handle the file can be reopened and the
+// read retried at the same offset. A pack stored in an archive is read as
+// the size bytes at base. Under a FileBudget the file may be closed between
+// reads, file is then nil until the next read reopens it.
+type packReader struct {
+	path      string
+	base      int64
+	size      int64
+	retry     bool
+	noatime   bool
+	lock      sync.RWMutex
+	file      *os.File
+	reopened  int
+	seqOffset int64
+	// opened is the stat of the file when it was first opened
+	opened os.FileInfo
+
+	budget *FileBudget
+	// budgetElem is the place of the reader in the budget, guarded by its
+	// mutex
+	budgetElem *list.Element
+	closed     bool
+}
+
+func openPackReader(path string, base int64, size int64, noatime bool, retry bool, budget *FileBudget) (*packReader, error) {
+	r := &packReader{
+		path:    path,
+		base:    base,
+		size:    size,
+		retry:   retry,
+		noatime: noatime,
+		budget:  budget,
+	}
+	file, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	r.file = file
+	r.opened, err = file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if budget != nil {
+		budget.touch(r)
+	}
+	return r, nil
+}
+
+func (r *packReader) open() (*os.File, error) {
+	if r.noatime {
+		// O_NOATIME only works on files we own, fall back to a plain open
+		if file, err := openNoatime(r.path); err == nil {
+			return file, nil
+		}
+	}
+	return os.Open(r.path)
+}
+
+// use runs fn on the open file, reopening it if the budget closed it. The
+// budget cannot close the file while fn runs: the file is touched first,
+// which may evict others, then held until fn returns.
+func (r *packReader) use(fn func(file *os.File) error) error {
+	for {
+		if r.budget != nil {
+			r.budget.touch(r)
+		}
+		r.lock.RLock()
+		if file := r.file; file != nil {
+			err := fn(file)
+			r.lock.RUnlock()
+			return err
+		}
+		r.lock.RUnlock()
+		// evicted again since the touch, the next round puts it back
+		if _, err := r.reopenEvicted(); err != nil {
+			return err
+		}
+	}
+}
+
+// reopenEvicted opens the file again after the budget closed it, unless
+// another reader already did, checking that it is still the same file
+func (r *packReader) reopenEvicted() (*os.File, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file != nil {
+		return r.file, nil
+	}
+	if r.closed {
+		return nil, os.ErrClosed
+	}
+	file, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err == nil && !os.SameFile(r.opened, info) {
+		err = fmt.Errorf("%w: %s was replaced by another file", ErrPackChanged, r.path)
+	}
+	if err == nil {
+		err = sameStat(r.opened, info)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.file = file
+	return file, nil
+}
+
+// evict closes the file for the budget, once the reads in flight on it are
+// done
+func (r *packReader) evict() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+// reopen replaces file unless another reader already did
+func (r *packReader) reopen(stale *os.File) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file != stale {
+		return nil
+	}
+	file, err := r.open()
+	if err != nil {
+		return err
+	}
+	r.file.Close()
+	r.file = file
+	r.reopened++
+	return nil
+}
+
+func (r *packReader) ReadAt(p []byte, off int64) (int, error) {
+	var short bool
+	if r.size >= 0 {
+		if off >= r.size {
+			return 0, io.EOF
+		}
+		if int64(len(p)) > r.size-off {
+			p = p[:r.size-off]
+			short = true
+		}
+	}
+	for i := 0; ; i++ {
+		var file *os.File
+		var n int
+		err := r.use(func(f *os.File) error {
+			var err error
+			file = f
+			n, err = f.ReadAt(p, r.base+off)
+			return err
+		})
+		if err == nil && short {
+			err = io.EOF
+		}
+		if err == nil || file == nil || !r.retry || i >= staleRetries || !errors.Is(err, syscall.ESTALE) {
+			return n, err
+		}
+		if err := r.reopen(file); err != nil {
+			return n, err
+		}
+	}
+}
+
+// dropRange drops the cached pages of the n bytes at off
+func (r *packReader) dropRange(off int64, n int64) error {
+	return r.use(func(file *os.File) error {
+		return dropPageRange(file, r.base+off, n)
+	})
+}
+
+func (r *packReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.seqOffset)
+	r.seqOffset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// sectionInfo is the stat of a pack in an archive
+type sectionInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i *sectionInfo) Size() int64 {
+	return i.size
+}
+
+func (r *packReader) Stat() (os.FileInfo, error) {
+	var info os.FileInfo
+	err := r.use(func(file *os.File) error {
+		var err error
+		info, err = file.Stat()
+		return err
+	})
+	if err != nil || r.size < 0 {
+		return info, err
+	}
+	return &sectionInfo{FileInfo: info, size: r.size}, nil
+}
+
+func (r *packReader) Close() error {
+	if r.budget != nil {
+		r.budget.forget(r)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.closed = true
+	file := r.file
+	r.file = nil
+	if file == nil {
+		return nil
+	}
+	return file.Close()
+}
+
+// checkUnchanged compares the open file and whatever is at path now with
+// the stat taken at open
+func (r *packReader) checkUnchanged() error {
+	var info os.FileInfo
+	err := r.use(func(file *os.File) error {
+		var err error
+		info, err = file.Stat()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := sameStat(r.opened, info); err != nil {
+		return err
+	}
+	info, err = os.Stat(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s was removed", ErrPackChanged, r.path)
+	} else if err != nil {
+		return err
+	}
+	if !os.SameFile(r.opened, info) {
+		return fmt.Errorf("%w: %s was replaced by another file", ErrPackChanged, r.path)
+	}
+	return sameStat(r.opened, info)
+}
+
+func sameStat(before, after os.FileInfo) error {
+	if before.Size() != after.Size() {
+		return fmt.Errorf("%w: size went from %d to %d", ErrPackChanged, before.Size(), after.Size())
+	}
+	if !before.ModTime().Equal(after.ModTime()) {
+		return fmt.Errorf("%w: mtime went from %s to %s", ErrPackChanged, before.ModTime(), after.ModTime())
+	}
+	return nil
+}
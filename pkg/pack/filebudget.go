@@ -0,0 +1,74 @@
+package pack
+
+import (
+	"container/list"
+	"sync"
+)
+
+// FileBudget caps how many pack files the packs opened with it keep open at
+// once: past the limit the least recently read one is closed, and reopened
+// when it is read again, so that working over thousands of packs stays
+// within the open file limit. A reopened pack must still be the same file,
+// else its reads fail with ErrPackChanged. Idx files are mapped and count
+// for nothing. It is safe for concurrent use.
+type FileBudget struct {
+	mu    sync.Mutex
+	limit int
+	// open are the readers holding a file, the most recently read first
+	open *list.List
+}
+
+// defaultOpenFileLimit is assumed where the open file limit cannot be read
+const defaultOpenFileLimit = 1024
+
+// NewFileBudget returns a budget of limit open pack files, zero or less for
+// half of the open file limit of the process
+func NewFileBudget(limit int) *FileBudget {
+	if limit <= 0 {
+		limit = openFileLimit() / 2
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	return &FileBudget{limit: limit, open: list.New()}
+}
+
+// WithFileBudget keeps the pack file open within budget, see FileBudget
+func WithFileBudget(budget *FileBudget) Option {
+	return func(pf *PackFile) {
+		pf.fileBudget = budget
+	}
+}
+
+// touch records that r read its file, closing the files of the least
+// recently read readers over the limit. The caller must not hold r.lock.
+func (b *FileBudget) touch(r *packReader) {
+	var evict []*packReader
+	b.mu.Lock()
+	if r.budgetElem != nil {
+		b.open.MoveToFront(r.budgetElem)
+	} else {
+		r.budgetElem = b.open.PushFront(r)
+	}
+	for b.open.Len() > b.limit {
+		elem := b.open.Back()
+		victim := elem.Value.(*packReader)
+		b.open.Remove(elem)
+		victim.budgetElem = nil
+		evict = append(evict, victim)
+	}
+	b.mu.Unlock()
+	for _, victim := range evict {
+		victim.evict()
+	}
+}
+
+// forget drops a reader that closed its file
+func (b *FileBudget) forget(r *packReader) {
+	b.mu.Lock()
+	if r.budgetElem != nil {
+		b.open.Remove(r.budgetElem)
+		r.budgetElem = nil
+	}
+	b.mu.Unlock()
+}
@@ -0,0 +1,52 @@
+package pack
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestFileBudgetConcurrentReads(t *testing.T) {
+	const path = "testdata/producer-git.pack"
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// more readers than the budget, each evicting the others while they read
+	budget := NewFileBudget(1)
+	readers := make([]*packReader, 4)
+	for i := range readers {
+		if readers[i], err = openPackReader(path, 0, -1, false, false, budget); err != nil {
+			t.Fatal(err)
+		}
+		defer readers[i].Close()
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			buf := make([]byte, 64)
+			for i := 0; i < 10000; i++ {
+				r := readers[rng.Intn(len(readers))]
+				off := rng.Intn(len(want) - len(buf))
+				if _, err := r.ReadAt(buf, int64(off)); err != nil {
+					t.Errorf("ReadAt(%d): %v", off, err)
+					return
+				}
+				if !bytes.Equal(buf, want[off:off+len(buf)]) {
+					t.Errorf("ReadAt(%d) read other bytes", off)
+					return
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+	if n := budget.open.Len(); n > 1 {
+		t.Errorf("%d files open, the budget is 1", n)
+	}
+}
@@ -0,0 +1,37 @@
+package pack
+
+import (
+	"errors"
+
+	"github.com/adlternative/git-miner/pkg/delta"
+	"github.com/adlternative/git-miner/pkg/finding"
+)
+
+// Finding codes of the pack checks
+const (
+	CodeNonCanonical  = "non-canonical-encoding"
+	CodePackChanged   = "pack-changed"
+	CodeBadDelta      = "bad-delta"
+	CodeMissingObject = "missing-object"
+	CodeCorrupt       = "corrupt-pack"
+	CodeRejected      = "rejected"
+	CodeStorage       = "storage-corruption"
+)
+
+// AsFinding turns an error from verifying a pack into an error finding
+func AsFinding(err error) *finding.Finding {
+	code := CodeCorrupt
+	switch {
+	case errors.Is(err, ErrPackChanged):
+		code = CodePackChanged
+	case errors.Is(err, delta.ErrBadDelta):
+		code = CodeBadDelta
+	case errors.Is(err, ErrObjectNotFound):
+		code = CodeMissingObject
+	case errors.Is(err, ErrRejected):
+		code = CodeRejected
+	case errors.Is(err, ErrStorageCorrupt):
+		code = CodeStorage
+	}
+	return finding.As(err, code)
+}
@@ -0,0 +1,46 @@
+package pack
+
+import (
+	"fmt"
+	"github.com/adlternative/git-miner/pkg/oid"
+	"hash"
+)
+
+// oidAlgorithm is the hash of the object ids in packs
+const oidAlgorithm = oid.SHA1
+
+// hashSize is the size of the object ids of oidAlgorithm, and of the
+// checksums ending packs, idx and rev files
+var hashSize = oidAlgorithm.Size()
+
+// hashID returns the id git's file formats give oidAlgorithm, e.g. in the
+// header of a rev file
+func hashID() uint32 {
+	if oidAlgorithm == oid.SHA256 {
+		return 2
+	}
+	return 1
+}
+
+// fileChecksum returns the checksum git ends a file of its formats with
+// data with
+func fileChecksum(data []byte) []byte {
+	h := oidAlgorithm.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// newObjectHasher returns a hash which has already been fed with the
+// "<type> <size>\0" object header.
+func newObjectHasher(_type ObjectType, size uint64) hash.Hash {
+	h := oidAlgorithm.New()
+	fmt.Fprintf(h, "%s %d\x00", _type.ContentType(), size)
+	return h
+}
+
+// HashObject returns the id git gives an object of this type and content
+func HashObject(_type ObjectType, data []byte) oid.Oid {
+	h := newObjectHasher(_type, uint64(len(data)))
+	h.Write(data)
+	return oid.Sum(h)
+}
@@ -0,0 +1,68 @@
+package pack
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// idleLoadCheck is how often the load average is read in idle mode
+const idleLoadCheck = time.Second
+
+// idlePause is how long idle mode waits before looking at the load again
+const idlePause = 100 * time.Millisecond
+
+// idler makes a verification in idle mode give way to other work on the host
+type idler struct {
+	enabled bool
+	// maxLoad is the load average per CPU above which verification pauses,
+	// zero means the load is not watched
+	maxLoad float64
+
+	mu      sync.Mutex
+	checked time.Time
+	loaded  bool
+}
+
+// threads returns how many goroutines resolve objects when threads were asked
+// for, by default one per available CPU and in idle mode a quarter of them
+func (i *idler) threads(threads int) int {
+	if threads > 0 {
+		return threads
+	}
+	if !i.enabled {
+		return availableCPUs()
+	}
+	if threads = availableCPUs() / 4; threads < 1 {
+		threads = 1
+	}
+	return threads
+}
+
+// yield is called between objects, it lets other goroutines run and waits
+// while the host is loaded
+func (i *idler) yield() {
+	if !i.enabled {
+		return
+	}
+	for i.overloaded() {
+		time.Sleep(idlePause)
+	}
+	runtime.Gosched()
+}
+
+func (i *idler) overloaded() bool {
+	if i.maxLoad <= 0 {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if time.Since(i.checked) < idleLoadCheck {
+		return i.loaded
+	}
+	i.checked = time.Now()
+	load, err := loadAverage()
+	// without a load average there is nothing to wait for
+	i.loaded = err == nil && load/float64(runtime.NumCPU()) > i.maxLoad
+	return i.loaded
+}
@@ -0,0 +1,226 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/mmap"
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+const IdxSignature = 0xff744f63
+const idxFanoutSize = 256 * 4
+const idxLargeOffsetNeeded = 0x80000000
+
+// Idx is a parsed pack .idx file, version 1 or 2
+type Idx struct {
+	Version     uint32
+	ObjectCount uint32
+
+	fanout       []byte
+	oids         []byte
+	crcs         []byte
+	offsets      []byte
+	largeOffsets []byte
+
+	PackChecksum []byte
+	Checksum     []byte
+
+	// b is the whole file, mapped by OpenIdx
+	b      []byte
+	mapped bool
+}
+
+// ParseIdx parses and validates a whole .idx file held in b
+func ParseIdx(b []byte) (*Idx, error) {
+	idx, err := parseIdxLayout(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.Check(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// OpenIdx maps the .idx file at path instead of reading it into the heap,
+// for verifiers holding many large ones open; Close unmaps it. Like ParseIdx
+// it validates the whole file, unless lazy: then only the layout is, the
+// rest is left to Check, and pages are read as lookups touch them.
+func OpenIdx(path string, lazy bool) (*Idx, error) {
+	b, err := mmap.Map(path)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := parseIdxLayout(b)
+	if err == nil && !lazy {
+		err = idx.Check()
+	}
+	if err != nil {
+		mmap.Unmap(b)
+		return nil, err
+	}
+	idx.mapped = true
+	return idx, nil
+}
+
+// Close unmaps an idx opened by OpenIdx, its PackChecksum and Checksum go
+// with it
+func (idx *Idx) Close() error {
+	if !idx.mapped {
+		return nil
+	}
+	idx.mapped = false
+	return mmap.Unmap(idx.b)
+}
+
+// openIdx opens the idx next to the pack at packPath, see WithLazyIdx
+func (pf *PackFile) openIdx(packPath string) (*Idx, error) {
+	return OpenIdx(strings.TrimSuffix(packPath, ".pack")+".idx", pf.lazyIdx)
+}
+
+// parseIdxLayout finds the tables of an .idx file, checking only that they
+// fit it
+func parseIdxLayout(b []byte) (*Idx, error) {
+	idx := &Idx{Version: 1, b: b}
+
+	hdr := 0
+	if len(b) >= 8 && binary.BigEndian.Uint32(b[0:4]) == IdxSignature {
+		idx.Version = binary.BigEndian.Uint32(b[4:8])
+		if idx.Version != 2 {
+			return nil, fmt.Errorf("unsupported idx version %d", idx.Version)
+		}
+		hdr = 8
+	}
+	if len(b) < hdr+idxFanoutSize+2*hashSize {
+		return nil, fmt.Errorf("idx file is too short")
+	}
+
+	idx.fanout = b[hdr : hdr+idxFanoutSize]
+	var prev uint32
+	for i := 0; i < 256; i++ {
+		count := binary.BigEndian.Uint32(idx.fanout[i*4:])
+		if count < prev {
+			return nil, fmt.Errorf("idx fanout out of order at %d", i)
+		}
+		prev = count
+	}
+	idx.ObjectCount = prev
+	n := uint64(idx.ObjectCount)
+
+	rawsz := uint64(hashSize)
+	trailerOffset := uint64(len(b)) - 2*rawsz
+	offset := uint64(hdr + idxFanoutSize)
+	if idx.Version == 1 {
+		if offset+n*(4+rawsz) != trailerOffset {
+			return nil, fmt.Errorf("idx file has wrong size %d for %d objects", len(b), n)
+		}
+		idx.offsets = b[offset:trailerOffset]
+	} else {
+		if offset+n*(rawsz+4+4) > trailerOffset {
+			return nil, fmt.Errorf("idx file is too short for %d objects", n)
+		}
+		idx.oids = b[offset : offset+n*rawsz]
+		offset += n * rawsz
+		idx.crcs = b[offset : offset+n*4]
+		offset += n * 4
+		idx.offsets = b[offset : offset+n*4]
+		offset += n * 4
+		idx.largeOffsets = b[offset:trailerOffset]
+		if len(idx.largeOffsets)%8 != 0 {
+			return nil, fmt.Errorf("idx large offset table has wrong size %d", len(idx.largeOffsets))
+		}
+	}
+	idx.PackChecksum = b[trailerOffset : trailerOffset+rawsz]
+	idx.Checksum = b[trailerOffset+rawsz:]
+	return idx, nil
+}
+
+// Check validates what parsing the layout leaves out: the checksum, that the
+// object ids are sorted and agree with the fanout, and the offsets
+func (idx *Idx) Check() error {
+	if !bytes.Equal(fileChecksum(idx.b[:len(idx.b)-hashSize]), idx.Checksum) {
+		return fmt.Errorf("idx checksum mismatch")
+	}
+
+	for i := uint32(0); i < idx.ObjectCount; i++ {
+		raw := idx.rawOid(i)
+		if i > 0 && bytes.Compare(idx.rawOid(i-1), raw) >= 0 {
+			return fmt.Errorf("idx oids out of order at %d: %x", i, raw)
+		}
+		if i >= binary.BigEndian.Uint32(idx.fanout[int(raw[0])*4:]) {
+			return fmt.Errorf("idx oid %x disagrees with fanout", raw)
+		}
+		if _, err := idx.Offset(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Oid returns the i-th object id in sorted order
+func (idx *Idx) Oid(i uint32) oid.Oid {
+	return oid.MustNew(oidAlgorithm, idx.rawOid(i))
+}
+
+func (idx *Idx) rawOid(i uint32) []byte {
+	pos := int(i)
+	if idx.Version == 1 {
+		entry := idx.offsets[pos*(4+hashSize):]
+		return entry[4 : 4+hashSize]
+	}
+	return idx.oids[pos*hashSize : (pos+1)*hashSize]
+}
+
+// Offset returns the pack offset of the i-th object
+func (idx *Idx) Offset(i uint32) (uint64, error) {
+	if idx.Version == 1 {
+		return uint64(binary.BigEndian.Uint32(idx.offsets[int(i)*(4+hashSize):])), nil
+	}
+
+	offset := binary.BigEndian.Uint32(idx.offsets[i*4:])
+	if offset&idxLargeOffsetNeeded == 0 {
+		return uint64(offset), nil
+	}
+	large := uint64(offset ^ idxLargeOffsetNeeded)
+	if (large+1)*8 > uint64(len(idx.largeOffsets)) {
+		return 0, fmt.Errorf("idx object %d refers to missing large offset %d", i, large)
+	}
+	return binary.BigEndian.Uint64(idx.largeOffsets[large*8:]), nil
+}
+
+// CRC32 returns the checksum of the i-th object's packed bytes, version 1
+// files do not record it.
+func (idx *Idx) CRC32(i uint32) (uint32, bool) {
+	if idx.Version == 1 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(idx.crcs[i*4:]), true
+}
+
+// Find returns the position of oid in the idx
+func (idx *Idx) Find(id oid.Oid) (uint32, bool) {
+	if id.Algorithm() != oidAlgorithm {
+		return 0, false
+	}
+	raw := id.Bytes()
+	lo := uint32(0)
+	if raw[0] > 0 {
+		lo = binary.BigEndian.Uint32(idx.fanout[(int(raw[0])-1)*4:])
+	}
+	hi := binary.BigEndian.Uint32(idx.fanout[int(raw[0])*4:])
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		switch bytes.Compare(idx.rawOid(mid), raw) {
+		case 0:
+			return mid, true
+		case -1:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,133 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/catalog"
+	log "github.com/sirupsen/logrus"
+)
+
+const revSignature = 0x52494458
+
+// revHeaderSize is the signature, version and hash id of a .rev file
+const revHeaderSize = 12
+
+// VerifyIdx checks an idx on its own, for backups keeping it apart from its
+// pack: its structure, the order of its object ids, its checksum, and that
+// its offsets could all be entries of one pack. The .rev next to it, if any,
+// is checked against it.
+func VerifyIdx(idxPath string) error {
+	idx, err := OpenIdx(idxPath, false)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+	order, err := idx.packOrder()
+	if err != nil {
+		return err
+	}
+
+	revPath := strings.TrimSuffix(idxPath, ".idx") + ".rev"
+	revStatus := "checked"
+	rev, err := os.ReadFile(revPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		revStatus = "missing"
+	} else if err != nil {
+		return err
+	} else if err := idx.checkRev(rev, order); err != nil {
+		return fmt.Errorf("%s: %w", revPath, err)
+	}
+
+	log.Printf(catalog.Format(catalog.IdxChecked), idxPath, idx.Version, idx.ObjectCount, idx.PackChecksum, revStatus)
+	return nil
+}
+
+// packOrder returns the idx positions of the objects in pack order, checking
+// that no offset falls in the pack header, that no two objects share one and
+// that large offsets are only used, each once, for offsets that need them
+func (idx *Idx) packOrder() ([]uint32, error) {
+	offsets := make([]uint64, idx.ObjectCount)
+	order := make([]uint32, idx.ObjectCount)
+	var usedLarge []bool
+	if idx.Version == 2 {
+		usedLarge = make([]bool, len(idx.largeOffsets)/8)
+	}
+	for i := range offsets {
+		offset, err := idx.Offset(uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		if offset < headerSize {
+			return nil, fmt.Errorf("idx object %d has offset %d inside the pack header", i, offset)
+		}
+		if idx.Version == 2 {
+			if small := binary.BigEndian.Uint32(idx.offsets[i*4:]); small&idxLargeOffsetNeeded != 0 {
+				large := small ^ idxLargeOffsetNeeded
+				if offset < idxLargeOffsetNeeded {
+					return nil, fmt.Errorf("idx object %d has offset %d in the large offset table, it fits in 31 bits", i, offset)
+				}
+				if usedLarge[large] {
+					return nil, fmt.Errorf("idx large offset %d is used twice", large)
+				}
+				usedLarge[large] = true
+			}
+		}
+		offsets[i] = offset
+		order[i] = uint32(i)
+	}
+	for i, used := range usedLarge {
+		if !used {
+			return nil, fmt.Errorf("idx large offset %d is not used", i)
+		}
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		return offsets[order[i]] < offsets[order[j]]
+	})
+	for i := 1; i < len(order); i++ {
+		if offsets[order[i]] == offsets[order[i-1]] {
+			return nil, fmt.Errorf("idx objects %d and %d share offset %d", order[i-1], order[i], offsets[order[i]])
+		}
+	}
+	return order, nil
+}
+
+// checkRev checks a .rev file against the idx, whose positions in pack order
+// are order
+func (idx *Idx) checkRev(b []byte, order []uint32) error {
+	n := uint64(idx.ObjectCount)
+	rawsz := uint64(hashSize)
+	if uint64(len(b)) != revHeaderSize+n*4+2*rawsz {
+		return fmt.Errorf("rev has wrong size %d for %d objects", len(b), n)
+	}
+	if binary.BigEndian.Uint32(b[0:4]) != revSignature {
+		return fmt.Errorf("rev has bad signature")
+	}
+	if version := binary.BigEndian.Uint32(b[4:8]); version != 1 {
+		return fmt.Errorf("unsupported rev version %d", version)
+	}
+	if id := binary.BigEndian.Uint32(b[8:12]); id != hashID() {
+		return fmt.Errorf("rev has hash id %d, want %d for %s", id, hashID(), oidAlgorithm)
+	}
+
+	trailer := revHeaderSize + n*4
+	if !bytes.Equal(fileChecksum(b[:trailer+rawsz]), b[trailer+rawsz:]) {
+		return fmt.Errorf("rev checksum mismatch")
+	}
+	if !bytes.Equal(b[trailer:trailer+rawsz], idx.PackChecksum) {
+		return fmt.Errorf("rev is for pack %x, the idx for %x", b[trailer:trailer+rawsz], idx.PackChecksum)
+	}
+	for i, want := range order {
+		if got := binary.BigEndian.Uint32(b[revHeaderSize+i*4:]); got != want {
+			return fmt.Errorf("rev has idx position %d at pack position %d, the idx says %d", got, i, want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Input is a buffered source of compressed bytes: Fill makes at least min
+// bytes available, Buffer returns all available bytes and Use consumes
+// length of them.
+type Input interface {
+	Fill(min uint64) ([]byte, error)
+	Buffer() []byte
+	Use(length uint64)
+}
+
+// Inflater decompresses the zlib stream at the start of in, writing its size
+// bytes of output to w. It must consume exactly the bytes of the stream, as
+// the next entry follows right after it.
+type Inflater interface {
+	Inflate(in Input, size uint64, w io.Writer) error
+}
+
+// defaultInflater is the cgo zlib backend when it is built in, see
+// inflate_zlib.go
+var defaultInflater Inflater = flateInflater{}
+
+var inflaters = map[string]Inflater{
+	"flate": flateInflater{},
+}
+
+// DefaultInflater returns the inflater used unless WithInflater says otherwise
+func DefaultInflater() Inflater {
+	return defaultInflater
+}
+
+// LookupInflater returns a built-in inflater by name, see InflaterNames
+func LookupInflater(name string) (Inflater, error) {
+	inflater, ok := inflaters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown inflater %q, have %v", name, InflaterNames())
+	}
+	return inflater, nil
+}
+
+func InflaterNames() []string {
+	var names []string
+	for name := range inflaters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func unpackEntryData(inflater Inflater, in Input, size uint64) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, size))
+	if err := inflater.Inflate(in, size, out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package pack
+
+import (
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// inputByteReader lets compress/flate read from an Input. Because it is an
+// io.ByteReader flate reads exactly what it needs and does not buffer ahead.
+type inputByteReader struct {
+	in Input
+}
+
+func (r *inputByteReader) Read(p []byte) (int, error) {
+	if _, err := r.in.Fill(1); err != nil {
+		return 0, err
+	}
+	n := copy(p, r.in.Buffer())
+	r.in.Use(uint64(n))
+	return n, nil
+}
+
+func (r *inputByteReader) ReadByte() (byte, error) {
+	buf, err := r.in.Fill(1)
+	if err != nil {
+		return 0, err
+	}
+	c := buf[0]
+	r.in.Use(1)
+	return c, nil
+}
+
+// flateInflater is the pure Go backend built on compress/zlib
+type flateInflater struct{}
+
+func (flateInflater) Inflate(in Input, size uint64, w io.Writer) error {
+	zr, err := zlib.NewReader(&inputByteReader{in: in})
+	if err != nil {
+		return fmt.Errorf("inflate failed: %w", err)
+	}
+
+	// read one byte more than expected to catch streams that are too long
+	n, err := io.Copy(w, io.LimitReader(zr, int64(size)+1))
+	if err != nil {
+		return fmt.Errorf("inflate failed: %w", err)
+	}
+	if uint64(n) != size {
+		return fmt.Errorf("inflate returned %d bytes, expect %d", n, size)
+	}
+	return zr.Close()
+}
@@ -0,0 +1,64 @@
+//go:build cgo && !purego
+
+package pack
+
+import (
+	"fmt"
+	"io"
+
+	gitzlib "github.com/adlternative/git-zlib-cgo"
+)
+
+func init() {
+	inflaters["zlib"] = zlibInflater{}
+	defaultInflater = zlibInflater{}
+}
+
+const streamBufferSize = 8192
+
+// zlibInflater is the cgo backend built on git's own zlib wrapper, it inflates
+// in streamBufferSize chunks so memory stays bounded for any object size.
+type zlibInflater struct{}
+
+func (zlibInflater) Inflate(in Input, size uint64, w io.Writer) error {
+	var err error
+	var totalOut uint64
+	outBuf := make([]byte, streamBufferSize)
+	zstream := &gitzlib.GitZStream{}
+	status := gitzlib.Z_OK
+
+	err = zstream.InflateInit()
+	if err != nil {
+		return err
+	}
+
+	// zstream.TotalOut() is only 32 bits wide, count the output ourselves
+	for status == gitzlib.Z_OK && totalOut <= size {
+		_, err = in.Fill(1)
+		if err != nil {
+			return err
+		}
+
+		allInputBuf := in.Buffer()
+		inputLength := len(allInputBuf)
+		zstream.SetInBuf(allInputBuf, inputLength)
+		zstream.SetOutBuf(outBuf, streamBufferSize)
+
+		status, err = zstream.Inflate(0)
+		if err != nil {
+			return err
+		}
+
+		in.Use(uint64(inputLength - zstream.AvailIn()))
+		out := streamBufferSize - zstream.AvailOut()
+		if _, err = w.Write(outBuf[:out]); err != nil {
+			return err
+		}
+		totalOut += uint64(out)
+	}
+	if status != gitzlib.Z_STREAM_END || totalOut != size {
+		return fmt.Errorf("inflate returned %d", status)
+	}
+
+	return zstream.InflateEnd()
+}
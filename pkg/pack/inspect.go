@@ -0,0 +1,116 @@
+package pack
+
+import (
+	"fmt"
+
+	"github.com/adlternative/git-miner/pkg/delta"
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+// EntryInfo is everything about a single pack entry, down to its bytes
+type EntryInfo struct {
+	Offset     uint64
+	PackedSize uint64
+	Type       ObjectType
+	Size       uint64
+	// SizeBytes is the type and size varint, BaseBytes the ofs-delta
+	// distance varint or the ref-delta base oid following it
+	SizeBytes []byte
+	BaseBytes []byte
+	// BaseOffset is where the base of a delta starts, if it is in the pack
+	BaseOffset uint64
+	BaseOid    oid.Oid
+	CRC32      uint32
+	// Oid and IdxCRC32 are what the idx records for the entry
+	Oid       oid.Oid
+	IdxCRC32  uint32
+	HasIdxCRC bool
+	// DeltaBaseSize and DeltaResultSize come from the header of a delta
+	DeltaBaseSize   uint64
+	DeltaResultSize uint64
+	// Data holds the first bytes of the inflated entry
+	Data []byte
+}
+
+// prefixWriter keeps the first bytes written to it
+type prefixWriter struct {
+	buf   []byte
+	limit int
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if room := w.limit - len(w.buf); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		w.buf = append(w.buf, p[:room]...)
+	}
+	return len(p), nil
+}
+
+// Offset returns where the entry of oid starts
+func (p *PackObjectSource) Offset(id oid.Oid) (uint64, error) {
+	i, ok := p.s.idx.Find(id)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrObjectNotFound, id)
+	}
+	return p.s.idx.Offset(i)
+}
+
+// Inspect decodes the entry at offset, keeping the first keep bytes of its
+// inflated data
+func (p *PackObjectSource) Inspect(offset uint64, keep int) (*EntryInfo, error) {
+	obj, ok := p.s.byOffset[offset]
+	if !ok {
+		return nil, fmt.Errorf("no entry starts at offset %d", offset)
+	}
+	in, err := p.s.readHeader(obj)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, obj.dataOffset-obj.offset)
+	if _, err := p.s.pf.file.ReadAt(header, int64(obj.offset)); err != nil {
+		return nil, err
+	}
+	sizeLen := 1
+	for sizeLen < len(header) && header[sizeLen-1]&0x80 != 0 {
+		sizeLen++
+	}
+
+	info := &EntryInfo{
+		Offset:     obj.offset,
+		PackedSize: obj.packedSize,
+		Type:       obj._type,
+		Size:       obj.size,
+		SizeBytes:  header[:sizeLen],
+		BaseBytes:  header[sizeLen:],
+		BaseOid:    obj.baseOid,
+		Oid:        p.s.idx.Oid(obj.index),
+	}
+	info.IdxCRC32, info.HasIdxCRC = p.s.idx.CRC32(obj.index)
+	if obj._type.IsDelta() {
+		if base, err := p.s.base(obj); err == nil {
+			info.BaseOffset = base.offset
+		}
+	}
+
+	// a delta header is two varints of up to 10 bytes
+	prefix := &prefixWriter{limit: keep}
+	if prefix.limit < 20 {
+		prefix.limit = 20
+	}
+	if err := p.s.pf.inflater.Inflate(in, obj.size, prefix); err != nil {
+		return info, err
+	}
+	info.CRC32 = in.crc.Sum32()
+	if obj._type.IsDelta() {
+		if info.DeltaBaseSize, info.DeltaResultSize, err = delta.Sizes(prefix.buf); err != nil {
+			return info, err
+		}
+	}
+	info.Data = prefix.buf
+	if len(info.Data) > keep {
+		info.Data = info.Data[:keep]
+	}
+	return info, nil
+}
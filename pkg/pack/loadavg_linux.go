@@ -0,0 +1,19 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+)
+
+// loadAverage returns the load average over the last minute
+func loadAverage() (float64, error) {
+	content, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	var load float64
+	if _, err := fmt.Sscan(string(content), &load); err != nil {
+		return 0, fmt.Errorf("/proc/loadavg: %w", err)
+	}
+	return load, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package pack
+
+import "errors"
+
+func loadAverage() (float64, error) {
+	return 0, errors.New("load average is not supported on this platform")
+}
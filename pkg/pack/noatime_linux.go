@@ -0,0 +1,10 @@
+package pack
+
+import (
+	"os"
+	"syscall"
+)
+
+func openNoatime(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_NOATIME, 0)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package pack
+
+import "os"
+
+func openNoatime(path string) (*os.File, error) {
+	return os.Open(path)
+}
@@ -0,0 +1,15 @@
+package pack
+
+import "syscall"
+
+// openFileLimit returns the soft limit of open files of the process
+func openFileLimit() int {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return defaultOpenFileLimit
+	}
+	if limit.Cur > 1<<20 {
+		return 1 << 20
+	}
+	return int(limit.Cur)
+}
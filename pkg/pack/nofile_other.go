@@ -0,0 +1,7 @@
+//go:build !linux
+
+package pack
+
+func openFileLimit() int {
+	return defaultOpenFileLimit
+}
@@ -0,0 +1,12 @@
+//go:build nowriter
+
+package pack
+
+import "errors"
+
+// ErrNoWriter is returned by WithWriteMissing in a build without the writers
+var ErrNoWriter = errors.New("this build has no pack writers, the nowriter tag was given")
+
+func (pf *PackFile) writeSidecars(packPath string) error {
+	return ErrNoWriter
+}
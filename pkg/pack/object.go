@@ -1,5 +1,12 @@
 package pack
 
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
 //go:generate stringer -type=ObjectType -trimprefix=Obj
 
 type ObjectType int8
@@ -17,13 +24,117 @@ const (
 	ObjMax
 )
 
+var (
+	// ErrTypeNone is the error for an entry of type 0, which git never uses
+	ErrTypeNone = errors.New("object type 0 is invalid")
+	// ErrTypeReserved is the error for an entry of type 5, which git
+	// reserves for future use
+	ErrTypeReserved = errors.New("object type 5 is reserved")
+	ErrBadType      = errors.New("invalid object type")
+)
+
+var contentTypes = map[ObjectType]string{
+	ObjCommit: "commit",
+	ObjTree:   "tree",
+	ObjBlob:   "blob",
+	ObjTag:    "tag",
+}
+
+// ParseContentType returns the type named name in object headers, such as
+// "commit"
+func ParseContentType(name string) (ObjectType, error) {
+	for _type, contentType := range contentTypes {
+		if contentType == name {
+			return _type, nil
+		}
+	}
+	return ObjNone, fmt.Errorf("%w %q", ErrBadType, name)
+}
+
+// ContentType returns the name of t in object headers, or "" for the types
+// no object has, deltas included
+func (t ObjectType) ContentType() string {
+	return contentTypes[t]
+}
+
+// IsDelta tells whether t is an ofs-delta or a ref-delta
+func (t ObjectType) IsDelta() bool {
+	return t == ObjOfsDelta || t == ObjRefDelta
+}
+
+// IsValidInPack tells whether t can be the type of a pack entry
+func (t ObjectType) IsValidInPack() bool {
+	return t.CheckInPack() == nil
+}
+
+// CheckInPack returns why t cannot be the type of a pack entry, or nil
+func (t ObjectType) CheckInPack() error {
+	switch {
+	case t == ObjNone:
+		return ErrTypeNone
+	case t == ObjFake:
+		return ErrTypeReserved
+	case t.ContentType() != "" || t.IsDelta():
+		return nil
+	}
+	return fmt.Errorf("%w %d", ErrBadType, int(t))
+}
+
 type Object struct {
 	*ObjectHeader
 	offset uint64
 	index  uint32
+	oid    oid.Oid
+
+	// dataOffset is where the compressed data starts, after the entry header
+	dataOffset uint64
+	packedSize uint64
+	crc32      uint32
+	// scanCRC32 is the crc32 seen by the scan in network filesystem mode
+	scanCRC32 uint32
+
+	// realType is the type of the object a delta resolves to
+	realType ObjectType
+	base     *Object
+	depth    uint32
+	// external is set for a thin pack base taken from an ObjectSource
+	external bool
 }
 
 type ObjectHeader struct {
 	size  uint64
 	_type ObjectType
+
+	// baseDistance is how many bytes before the entry an ofs-delta base starts
+	baseDistance uint64
+	// baseOid is the base object of a ref-delta
+	baseOid oid.Oid
+	// overlongSize is set when the size is encoded in more bytes than
+	// needed, git never writes that
+	overlongSize bool
+}
+
+func (h *ObjectHeader) Size() uint64 {
+	return h.size
+}
+
+func (h *ObjectHeader) Type() ObjectType {
+	return h._type
+}
+
+func (o *Object) Oid() oid.Oid {
+	return o.oid
+}
+
+func (o *Object) Offset() uint64 {
+	return o.offset
+}
+
+func (o *Object) CRC32() uint32 {
+	return o.crc32
+}
+
+// RealType returns the type of the object, resolving deltas
+func (o *Object) RealType() ObjectType {
+	return o.realType
 }
@@ -0,0 +1,145 @@
+package pack
+
+import (
+	"io"
+	"time"
+
+	"github.com/adlternative/git-miner/pkg/finding"
+)
+
+// DefaultBigFileThreshold is the same as git's core.bigFileThreshold default.
+const DefaultBigFileThreshold = 512 << 20
+
+// Option configures a PackFile
+type Option func(pf *PackFile)
+
+// WithBigFileThreshold sets the size from which non-delta objects are
+// inflated in fixed-size chunks instead of into a full-size buffer.
+func WithBigFileThreshold(threshold uint64) Option {
+	return func(pf *PackFile) {
+		pf.bigFileThreshold = threshold
+	}
+}
+
+// WithThreads sets how many goroutines resolve objects after the scan,
+// zero means one per CPU the process may use given GOMAXPROCS and the cgroup
+// CPU quota, or a quarter of them with WithIdle.
+func WithThreads(threads int) Option {
+	return func(pf *PackFile) {
+		pf.threads = threads
+	}
+}
+
+// WithIdle makes verification give way to other work on the host: unless
+// WithThreads says otherwise only a quarter of the CPUs resolve objects, and
+// goroutines yield between objects. If maxLoad is above zero they also pause
+// while the one minute load average per CPU is above it.
+func WithIdle(idle bool, maxLoad float64) Option {
+	return func(pf *PackFile) {
+		pf.idle.enabled = idle
+		pf.idle.maxLoad = maxLoad
+	}
+}
+
+// WithObjectSource sets where ref-delta bases missing from the pack are
+// looked up, which is what makes thin packs resolvable.
+func WithObjectSource(source ObjectSource) Option {
+	return func(pf *PackFile) {
+		pf.source = source
+	}
+}
+
+// WithInflater sets the zlib backend, see LookupInflater for the built-in ones
+func WithInflater(inflater Inflater) Option {
+	return func(pf *PackFile) {
+		pf.inflater = inflater
+	}
+}
+
+// WithDropCache makes Verify advise the kernel to drop the pack's pages from
+// the page cache once it is done, so scrubbing many packs does not evict the
+// data live traffic needs.
+func WithDropCache(drop bool) Option {
+	return func(pf *PackFile) {
+		pf.dropCache = drop
+	}
+}
+
+// WithNetworkFS tunes reading for NFS and similar: no O_NOATIME, larger
+// reads, retries after stale file handles, and every entry is checksummed on
+// both reads to catch the file being replaced in between.
+func WithNetworkFS(networkFS bool) Option {
+	return func(pf *PackFile) {
+		pf.networkFS = networkFS
+	}
+}
+
+// WithDoubleRead reads every entry a second time, past the page cache where
+// the kernel allows, and compares the two reads. A difference while the pack
+// is unchanged is reported as ErrStorageCorrupt: a fault of the memory or the
+// storage rather than of the pack.
+func WithDoubleRead(double bool) Option {
+	return func(pf *PackFile) {
+		pf.doubleRead = double
+	}
+}
+
+// WithLazyIdx checks only the layout of the idx of a pack read through it, as
+// Sample, VerifyWindow and PackObjectSource do, leaving its checksum and
+// order unchecked, so that opening one reads next to nothing of it
+func WithLazyIdx(lazy bool) Option {
+	return func(pf *PackFile) {
+		pf.lazyIdx = lazy
+	}
+}
+
+// WithTee copies the pack to w as the scan reads it, from the header to the
+// trailer, so that a receiving side can verify and store a pack in one pass.
+// The copy is only complete if verification succeeds.
+func WithTee(w io.Writer) Option {
+	return func(pf *PackFile) {
+		pf.tee = w
+	}
+}
+
+// WithWriteMissing makes Verify write the idx and rev of a pack that verified
+// if they do not exist, and with bitmap its bitmap as well, so that git can
+// serve a bare pack file.
+func WithWriteMissing(write bool, bitmap bool) Option {
+	return func(pf *PackFile) {
+		pf.writeMissing = write
+		pf.writeBitmap = bitmap
+	}
+}
+
+// WithMaxErrors ends a VerifyWindow early once n more entries failed in it, so
+// that a badly damaged pack does not bury the report under its failures.
+// Zero means no limit.
+func WithMaxErrors(n int) Option {
+	return func(pf *PackFile) {
+		pf.maxErrors = n
+	}
+}
+
+// WithBaseline marks the findings acknowledged in baseline as known
+func WithBaseline(baseline *finding.Baseline) Option {
+	return func(pf *PackFile) {
+		pf.baseline = baseline
+	}
+}
+
+// WithSeverities overrides the severities of the findings by code, a finding
+// made an error fails the verification unless it is in the baseline
+func WithSeverities(severities *finding.SeverityMap) Option {
+	return func(pf *PackFile) {
+		pf.severities = severities
+	}
+}
+
+// WithProgress logs progress, throughput and an ETA every interval, and how
+// long each phase took
+func WithProgress(interval time.Duration) Option {
+	return func(pf *PackFile) {
+		pf.progress.interval = interval
+	}
+}
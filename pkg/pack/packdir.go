@@ -0,0 +1,112 @@
+package pack
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sidecarExts are the files git keeps next to a pack and rebuilds with it
+var sidecarExts = []string{".idx", ".rev", ".bitmap"}
+
+// Sidecar is a file belonging to a pack, such as its idx
+type Sidecar struct {
+	Ext     string
+	Path    string
+	Exists  bool
+	ModTime time.Time
+	// Stale is set when the sidecar is older than its pack, i.e. it was not
+	// rewritten along with the pack and may describe different content
+	Stale bool
+}
+
+// PackAge reports the age of a pack and of its sidecars
+type PackAge struct {
+	Path     string
+	ModTime  time.Time
+	Sidecars []*Sidecar
+	// IdxMismatch says why the idx does not fit the pack, see CheckIdx
+	IdxMismatch error
+}
+
+// Stale returns whether any sidecar is older than the pack or the idx is
+// missing or does not fit
+func (p *PackAge) Stale() bool {
+	if p.IdxMismatch != nil {
+		return true
+	}
+	for _, sidecar := range p.Sidecars {
+		if sidecar.Stale || (sidecar.Ext == ".idx" && !sidecar.Exists) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultStaleSlack is how much older than its pack a sidecar may be before
+// it counts as stale, since the pack is written first
+const DefaultStaleSlack = time.Second
+
+// PackAges reports every pack in the pack directory dir, oldest first. A
+// sidecar more than slack older than its pack is stale.
+func PackAges(dir string, slack time.Duration) ([]*PackAge, error) {
+	packs, err := filepath.Glob(filepath.Join(dir, "pack-*.pack"))
+	if err != nil {
+		return nil, err
+	}
+
+	var ages []*PackAge
+	for _, packPath := range packs {
+		info, err := os.Stat(packPath)
+		if err != nil {
+			return nil, err
+		}
+		age := &PackAge{
+			Path:    packPath,
+			ModTime: info.ModTime(),
+		}
+		for _, ext := range sidecarExts {
+			sidecar := &Sidecar{
+				Ext:  ext,
+				Path: strings.TrimSuffix(packPath, ".pack") + ext,
+			}
+			info, err := os.Stat(sidecar.Path)
+			if err == nil {
+				sidecar.Exists = true
+				sidecar.ModTime = info.ModTime()
+				sidecar.Stale = sidecar.ModTime.Add(slack).Before(age.ModTime)
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+			age.Sidecars = append(age.Sidecars, sidecar)
+		}
+		ages = append(ages, age)
+	}
+	sort.SliceStable(ages, func(i, j int) bool {
+		return ages[i].ModTime.Before(ages[j].ModTime)
+	})
+	return ages, nil
+}
+
+// CheckIdx opens each pack of ages that has an idx together with it, like
+// the object sources do, and records in IdxMismatch why they do not fit,
+// e.g. another object count or pack checksum. The packs go under a
+// FileBudget of half the open file limit, unless opts give another, such as
+// one shared with other work over the same directory.
+func CheckIdx(ages []*PackAge, opts ...Option) {
+	opts = append([]Option{WithFileBudget(NewFileBudget(0))}, opts...)
+	for _, age := range ages {
+		// the idx is the first sidecar
+		if !age.Sidecars[0].Exists {
+			continue
+		}
+		source, err := NewPackObjectSource(age.Path, opts...)
+		if err != nil {
+			age.IdxMismatch = err
+			continue
+		}
+		source.Close()
+	}
+}
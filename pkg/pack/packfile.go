@@ -1,28 +1,89 @@
 package pack
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"github.com/adlternative/git-miner/pkg/codec"
+	"github.com/adlternative/git-miner/pkg/finding"
+	"github.com/adlternative/git-miner/pkg/oid"
 	log "github.com/sirupsen/logrus"
-
-	"os"
-	"unsafe"
-
-	gitzlib "github.com/adlternative/git-zlib-cgo"
+	"hash"
+	"hash/crc32"
+	"io"
 )
 
 const headerSize = 12
 const Signature = 0x5041434b
+
+// GitSha1Rawsz is the size of a SHA-1, for callers building SHA-1 packs by
+// hand. The sizes of the ids and checksums read here follow oidAlgorithm.
 const GitSha1Rawsz = 20
 
+var (
+	// ErrNotPack means the file does not start like a pack at all
+	ErrNotPack = errors.New("not a pack file")
+	// ErrChecksumMismatch means the pack trailer does not match its content
+	ErrChecksumMismatch = errors.New("pack checksum mismatch")
+)
+
 type PackFile struct {
-	file       *os.File
+	file       *packReader
 	version    uint32
 	objectNums uint32
 	curOffset  uint64
 	objects    []*Object
 
 	inputBuf *buffer
+
+	bigFileThreshold uint64
+	threads          int
+	idle             idler
+	inflater         Inflater
+	dropCache        bool
+	networkFS        bool
+	doubleRead       bool
+	lazyIdx          bool
+	fileBudget       *FileBudget
+	// scanCRC checksums each entry during the scan in network filesystem
+	// mode, to be compared with what the resolver reads later
+	scanCRC hash.Hash32
+	// packHash checksums everything the scan reads, for the trailer
+	packHash hash.Hash
+	traits   writerTraits
+	// tee receives a copy of everything the scan reads, teeErr is its first
+	// write error
+	tee    io.Writer
+	teeErr error
+	// checksum is the trailer, once the scan verified it
+	checksum []byte
+
+	writeMissing bool
+	writeBitmap  bool
+	maxErrors    int
+
+	// findings are the warnings found so far, errors are returned instead
+	findings []*finding.Finding
+	baseline *finding.Baseline
+	// severities are given by WithSeverities
+	severities *finding.SeverityMap
+	progress   progress
+	veto       Veto
+	// checkTrees, checkSignatures and checkText are set by WithTreeChecks,
+	// WithSignatureChecks and WithTextChecks
+	checkTrees      bool
+	checkSignatures bool
+	checkText       bool
+	signatures      *SignatureCounts
+	// verifier and what it requires are set by WithSignatureVerifier
+	verifier          SignatureVerifier
+	requireSigned     bool
+	requireSignedTags bool
+
+	source ObjectSource
+	// externalBases are the ref-delta bases found through source
+	externalBases []*Object
 }
 
 func (pf *PackFile) fill(min uint64) ([]byte, error) {
@@ -34,19 +95,63 @@ func (pf *PackFile) buffer() []byte {
 }
 
 func (pf *PackFile) use(length uint64) {
+	pf.packHash.Write(pf.inputBuf.Buffer()[:length])
+	if pf.scanCRC != nil {
+		pf.scanCRC.Write(pf.inputBuf.Buffer()[:length])
+	}
+	if pf.tee != nil && pf.teeErr == nil {
+		_, pf.teeErr = pf.tee.Write(pf.inputBuf.Buffer()[:length])
+	}
 	pf.inputBuf.Use(length)
 	pf.curOffset += length
 }
 
-func NewPackFile(packPath string) (*PackFile, error) {
-	file, err := os.Open(packPath)
+// scanInput is the Input of the sequential scan
+type scanInput PackFile
+
+func (s *scanInput) Fill(min uint64) ([]byte, error) {
+	return (*PackFile)(s).fill(min)
+}
+
+func (s *scanInput) Buffer() []byte {
+	return (*PackFile)(s).buffer()
+}
+
+func (s *scanInput) Use(length uint64) {
+	s.traits.consumed(s.inputBuf.Buffer()[:length])
+	(*PackFile)(s).use(length)
+}
+
+func NewPackFile(packPath string, opts ...Option) (*PackFile, error) {
+	return newPackFile(packPath, 0, -1, opts)
+}
+
+// newPackFile opens the pack in the size bytes at base of the file at
+// packPath, all of it if size is negative
+func newPackFile(packPath string, base int64, size int64, opts []Option) (*PackFile, error) {
+	pf := &PackFile{
+		bigFileThreshold: DefaultBigFileThreshold,
+		inflater:         defaultInflater,
+		packHash:         oidAlgorithm.New(),
+	}
+	for _, opt := range opts {
+		opt(pf)
+	}
+
+	// atime updates are pointless for a scrub, but network filesystems
+	// may refuse O_NOATIME
+	file, err := openPackReader(packPath, base, size, !pf.networkFS, pf.networkFS, pf.fileBudget)
 	if err != nil {
 		return nil, err
 	}
-	return &PackFile{
-		file:     file,
-		inputBuf: newBuffer(file),
-	}, nil
+	pf.file = file
+	if pf.networkFS {
+		pf.inputBuf = newBufferSize(file, nfsBufferSize)
+		pf.scanCRC = crc32.NewIEEE()
+	} else {
+		pf.inputBuf = newBuffer(file)
+	}
+	return pf, nil
 }
 
 func (pf *PackFile) ShowFileStat() error {
@@ -66,12 +171,12 @@ func (pf *PackFile) ParseHeader() error {
 	defer pf.use(headerSize)
 
 	if binary.BigEndian.Uint32(header[0:4]) != Signature {
-		return fmt.Errorf("bad signature %v", header[0:4])
+		return fmt.Errorf("%w: bad signature %v", ErrNotPack, header[0:4])
 	}
 
 	version := binary.BigEndian.Uint32(header[4:8])
 	if version != 2 && version != 3 {
-		return fmt.Errorf("bad version %d", version)
+		return fmt.Errorf("%w: bad version %d", ErrNotPack, version)
 	}
 	pf.version = version
 	objectNums := binary.BigEndian.Uint32(header[8:12])
@@ -86,78 +191,82 @@ func (pf *PackFile) ShowHeader() {
 	log.Printf("objectNums = %d\n", pf.objectNums)
 }
 
-func MSB64(value uint64) uint8 {
-	size := unsafe.Sizeof(value) * 8
-	return uint8(value >> (size - 8))
+// byteReaderFunc turns a readByte method into an io.ByteReader
+type byteReaderFunc func() (byte, error)
+
+func (f byteReaderFunc) ReadByte() (byte, error) {
+	return f()
 }
 
-func (pf *PackFile) ParseObjectHeader(curOffset uint64) (*ObjectHeader, error) {
-	b, err := pf.readByte()
+func parseEntryHeader(r io.ByteReader) (*ObjectHeader, error) {
+	t, size, overlong, err := codec.ReadEntryHeader(r)
 	if err != nil {
 		return nil, err
 	}
 
-	_type := ObjectType((b >> 4) & 7)
-	size := uint64(b & 15)
-	shift := 4
-
-	for b&0x80 != 0 {
-		b, err = pf.readByte()
-		if err != nil {
-			return nil, err
-		}
-
-		size += (uint64(b) & 0x7f) << shift
-		shift += 7
+	_type := ObjectType(t)
+	header := &ObjectHeader{
+		size:         size,
+		_type:        _type,
+		overlongSize: overlong,
 	}
 
 	switch _type {
 	case ObjRefDelta:
-		_, err = pf.fill(GitSha1Rawsz)
-		if err != nil {
-			return nil, err
+		raw := make([]byte, oidAlgorithm.Size())
+		for i := range raw {
+			if raw[i], err = r.ReadByte(); err != nil {
+				return nil, err
+			}
 		}
-
-		// handle ref delta
-
-		pf.use(GitSha1Rawsz)
+		header.baseOid = oid.MustNew(oidAlgorithm, raw)
 	case ObjOfsDelta:
-		b, err = pf.readByte()
-		if err != nil {
+		if header.baseDistance, err = codec.ReadOfsDistance(r); err != nil {
+			return nil, err
+		}
+	default:
+		if err := _type.CheckInPack(); err != nil {
 			return nil, err
 		}
+	}
 
-		baseOffset := uint64(b & 127)
-		for b&128 != 0 {
-			baseOffset++
-			if baseOffset == 0 || (MSB64(baseOffset) != 0) {
-				return nil, fmt.Errorf("bad delta base object offset value")
-			}
+	return header, nil
+}
 
-			if b, err = pf.readByte(); err != nil {
-				return nil, err
-			}
+// ParseEntryHeader parses the pack entry header at the start of b and
+// returns it with the number of bytes it occupies. Unlike ParseObjectHeader
+// it does not know where the entry lives, so ofs-delta bases are not
+// bound-checked.
+func ParseEntryHeader(b []byte) (*ObjectHeader, int, error) {
+	r := bytes.NewReader(b)
+	header, err := parseEntryHeader(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return header, len(b) - r.Len(), nil
+}
 
-			baseOffset = (baseOffset << 7) + uint64(b&127)
-		}
-		ofsOffset := curOffset - baseOffset
+func (pf *PackFile) ParseObjectHeader(curOffset uint64) (*ObjectHeader, error) {
+	header, err := parseEntryHeader(byteReaderFunc(pf.readByte))
+	if err != nil {
+		return nil, err
+	}
+
+	if header._type == ObjOfsDelta {
+		ofsOffset := curOffset - header.baseDistance
 		if ofsOffset <= 0 || ofsOffset >= curOffset {
-			return nil, fmt.Errorf("delta base offset is out of bound: curOffset=%d, baseOffet=%d, b=%d", curOffset, baseOffset, b)
+			return nil, fmt.Errorf("delta base offset is out of bound: curOffset=%d, baseOffet=%d", curOffset, header.baseDistance)
 		}
-	case ObjCommit, ObjTree, ObjBlob, ObjTag:
-	default:
-		return nil, fmt.Errorf("bad type %v", _type)
 	}
 
-	return &ObjectHeader{
-		size:  size,
-		_type: _type,
-	}, nil
-
+	return header, nil
 }
 
 func (pf *PackFile) ParseObject(index uint32) (*Object, error) {
 	curOffset := pf.curOffset
+	if pf.scanCRC != nil {
+		pf.scanCRC.Reset()
+	}
 	header, err := pf.ParseObjectHeader(curOffset)
 	if err != nil {
 		return nil, err
@@ -166,31 +275,108 @@ func (pf *PackFile) ParseObject(index uint32) (*Object, error) {
 	obj := &Object{
 		index:        index,
 		offset:       curOffset,
+		dataOffset:   pf.curOffset,
 		ObjectHeader: header,
 	}
 
-	_, err = pf.unpackEntryData(int(obj.size), obj._type)
+	// the scan only finds where the entry ends, ResolveObjects checks its content
+	level := -1
+	if zlibHeader, err := pf.fill(2); err == nil {
+		level = int(zlibHeader[1] >> 6)
+	}
+	err = pf.inflater.Inflate((*scanInput)(pf), obj.size, io.Discard)
 	if err != nil {
 		return nil, err
 	}
+	obj.packedSize = pf.curOffset - curOffset
+	pf.traits.entry(obj, level)
+	if header.overlongSize {
+		pf.findings = append(pf.findings, finding.New(finding.Warning, CodeNonCanonical,
+			"entry header encodes size %d in more bytes than needed", obj.size).WithOffset(curOffset))
+	}
+	if pf.scanCRC != nil {
+		obj.scanCRC32 = pf.scanCRC.Sum32()
+	}
 	return obj, nil
 }
 
 func (pf *PackFile) ParseObjects() error {
+	var dataSize uint64
+	if stat, err := pf.file.Stat(); err == nil && stat.Size() > int64(headerSize+hashSize) {
+		dataSize = uint64(stat.Size()) - uint64(headerSize+hashSize)
+	}
+	pf.progress.begin("scan", uint64(pf.objectNums), dataSize)
+	defer pf.progress.end()
+
 	for i := uint32(0); i < pf.objectNums; i++ {
+		pf.idle.yield()
 		obj, err := pf.ParseObject(i)
 		if err != nil {
 			return err
 		}
 		pf.objects = append(pf.objects, obj)
+		pf.progress.add(1, obj.packedSize)
+	}
+
+	return pf.parseTrailer()
+}
+
+// parseTrailer checks the checksum after the last entry, and that nothing
+// follows it
+func (pf *PackFile) parseTrailer() error {
+	sum := pf.packHash.Sum(nil)
+	trailer, err := pf.fill(uint64(hashSize))
+	if err != nil {
+		return fmt.Errorf("pack trailer: %w", err)
+	}
+	if !bytes.Equal(trailer[:hashSize], sum) {
+		return fmt.Errorf("%w: trailer has %x, content hashes to %x", ErrChecksumMismatch, trailer[:hashSize], sum)
+	}
+	pf.checksum = sum
+	pf.use(uint64(hashSize))
+	if pf.teeErr != nil {
+		return fmt.Errorf("copy of the pack failed: %w", pf.teeErr)
 	}
 
+	stat, err := pf.file.Stat()
+	if err != nil {
+		return err
+	}
+	if uint64(stat.Size()) != pf.curOffset {
+		return fmt.Errorf("pack has %d bytes of garbage after its trailer", uint64(stat.Size())-pf.curOffset)
+	}
 	return nil
 }
 
+// Timings returns how long the scan and the resolution of the objects took
+func (pf *PackFile) Timings() []*PhaseTiming {
+	return pf.progress.timings
+}
+
+// Findings returns the warnings found while verifying the pack, with the
+// severities given by WithSeverities
+func (pf *PackFile) Findings() []*finding.Finding {
+	pf.findings = pf.severities.Apply(pf.findings)
+	return pf.findings
+}
+
+// Objects returns the entries found by ParseObjects in pack order
+func (pf *PackFile) Objects() []*Object {
+	return pf.objects
+}
+
 func (pf *PackFile) ShowObjects() {
+	for _, base := range pf.externalBases {
+		log.Printf("[thin] base=%x, type=%s, size=%d\n", base.oid, base.realType, base.size)
+	}
 	for _, obj := range pf.objects {
-		log.Printf("index=%d offset=%d, type=%s, size=%d\n", obj.index, obj.offset, obj._type, obj.size)
+		if obj.base == nil {
+			log.Printf("index=%d offset=%d, oid=%x, type=%s, size=%d, packedSize=%d, crc32=%08x\n",
+				obj.index, obj.offset, obj.oid, obj._type, obj.size, obj.packedSize, obj.crc32)
+		} else {
+			log.Printf("index=%d offset=%d, oid=%x, type=%s, size=%d, packedSize=%d, crc32=%08x, realType=%s, depth=%d, base=%x\n",
+				obj.index, obj.offset, obj.oid, obj._type, obj.size, obj.packedSize, obj.crc32, obj.realType, obj.depth, obj.base.oid)
+		}
 	}
 }
 
@@ -204,48 +390,30 @@ func (pf *PackFile) readByte() (byte, error) {
 	return c, nil
 }
 
-func (pf *PackFile) Close() error {
-	return pf.file.Close()
+// DropCache advises the kernel (POSIX_FADV_DONTNEED) that the cached pages
+// of the pack are no longer needed.
+func (pf *PackFile) DropCache() error {
+	return pf.file.use(dropPageCache)
 }
 
-func (pf *PackFile) unpackEntryData(size int, _type ObjectType) ([]byte, error) {
-	var err error
-	outBuf := make([]byte, size)
-	zstream := &gitzlib.GitZStream{}
-	status := gitzlib.Z_OK
-
-	err = zstream.InflateInit()
-	if err != nil {
-		return nil, err
-	}
-	zstream.SetOutBuf(outBuf, size)
-
-	for status == gitzlib.Z_OK {
-		_, err = pf.fill(1)
-		if err != nil {
-			return nil, err
-		}
-
-		allInputBuf := pf.buffer()
-		inputLength := len(allInputBuf)
-		//log.Printf("curoff=%d, inputlen=%d curdata=%d", pf.curOffset, inputLength, allInputBuf[0])
-		zstream.SetInBuf(allInputBuf, inputLength)
+// CheckUnchanged returns an ErrPackChanged error if the pack was modified,
+// replaced or removed since NewPackFile opened it.
+func (pf *PackFile) CheckUnchanged() error {
+	return pf.file.checkUnchanged()
+}
 
-		status, err = zstream.Inflate(0)
-		if err != nil {
-			return nil, err
+// checkChanged prefers ErrPackChanged over err when the pack moved under us,
+// since err is then most likely caused by the change
+func (pf *PackFile) checkChanged(err error) error {
+	if changed := pf.CheckUnchanged(); changed != nil {
+		if err == nil || errors.Is(err, ErrPackChanged) {
+			return changed
 		}
-
-		pf.use(uint64(inputLength - zstream.AvailIn()))
-	}
-	if status != gitzlib.Z_STREAM_END || zstream.TotalOut() != size {
-		return nil, fmt.Errorf("inflate returned %d", status)
-	}
-
-	err = zstream.InflateEnd()
-	if err != nil {
-		return nil, err
+		return fmt.Errorf("%w (while reading it: %v)", changed, err)
 	}
+	return err
+}
 
-	return outBuf, nil
+func (pf *PackFile) Close() error {
+	return pf.file.Close()
 }
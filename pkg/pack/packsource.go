@@ -0,0 +1,112 @@
+package pack
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+// PackObjectSource reads objects out of a pack through its idx, resolving
+// deltas on demand. It is safe for concurrent use, the reads take turns.
+type PackObjectSource struct {
+	// mu serializes the reads, which share the entries and the inflater of
+	// the sampler
+	mu sync.Mutex
+	s  *sampler
+}
+
+func NewPackObjectSource(packPath string, opts ...Option) (*PackObjectSource, error) {
+	packFile, err := NewPackFile(packPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+	source, err := newPackObjectSource(packFile, packPath)
+	if err != nil {
+		packFile.Close()
+		return nil, err
+	}
+	return source, nil
+}
+
+func newPackObjectSource(packFile *PackFile, packPath string) (*PackObjectSource, error) {
+	if err := packFile.ParseHeader(); err != nil {
+		return nil, err
+	}
+	idx, err := packFile.openIdx(packPath)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSampler(packFile, idx)
+	if err != nil {
+		idx.Close()
+		return nil, err
+	}
+	return &PackObjectSource{s: s}, nil
+}
+
+func (p *PackObjectSource) ReadObject(id oid.Oid) (ObjectType, []byte, error) {
+	i, ok := p.s.idx.Find(id)
+	if !ok {
+		return ObjNone, nil, fmt.Errorf("%w: %s", ErrObjectNotFound, id)
+	}
+	offset, err := p.s.idx.Offset(i)
+	if err != nil {
+		return ObjNone, nil, err
+	}
+	return p.ReadObjectAt(offset)
+}
+
+// Contains tells whether the pack has an object, without reading it
+func (p *PackObjectSource) Contains(id oid.Oid) bool {
+	_, ok := p.s.idx.Find(id)
+	return ok
+}
+
+// Oids returns the ids of the objects of the pack in idx order
+func (p *PackObjectSource) Oids() []oid.Oid {
+	ids := make([]oid.Oid, p.s.idx.ObjectCount)
+	for i := range ids {
+		ids[i] = p.s.idx.Oid(uint32(i))
+	}
+	return ids
+}
+
+// TypeOf returns the type of an object, reading only the entry headers down
+// its delta chain
+func (p *PackObjectSource) TypeOf(id oid.Oid) (ObjectType, error) {
+	i, ok := p.s.idx.Find(id)
+	if !ok {
+		return ObjNone, fmt.Errorf("%w: %s", ErrObjectNotFound, id)
+	}
+	offset, err := p.s.idx.Offset(i)
+	if err != nil {
+		return ObjNone, err
+	}
+	obj, ok := p.s.byOffset[offset]
+	if !ok {
+		return ObjNone, fmt.Errorf("no entry starts at offset %d", offset)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.s.realType(obj, 0)
+}
+
+// ReadObjectAt reads the object of the entry starting at offset
+func (p *PackObjectSource) ReadObjectAt(offset uint64) (ObjectType, []byte, error) {
+	obj, ok := p.s.byOffset[offset]
+	if !ok {
+		return ObjNone, nil, fmt.Errorf("no entry starts at offset %d", offset)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.s.unpack(obj, 0)
+}
+
+func (p *PackObjectSource) Close() error {
+	if err := p.s.idx.Close(); err != nil {
+		p.s.pf.Close()
+		return err
+	}
+	return p.s.pf.Close()
+}
@@ -0,0 +1,46 @@
+package pack
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestPackObjectSourceConcurrentReads(t *testing.T) {
+	source, err := NewPackObjectSource("testdata/producer-git.pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	ids := source.Oids()
+	want := make([][]byte, len(ids))
+	for i, id := range ids {
+		if _, want[i], err = source.ReadObject(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the resolver reads the bases of a thin pack from every worker
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for round := 0; round < 20; round++ {
+				for i := range ids {
+					i := (i + g) % len(ids)
+					_, data, err := source.ReadObject(ids[i])
+					if err != nil {
+						t.Errorf("ReadObject(%s): %v", ids[i], err)
+						return
+					}
+					if !bytes.Equal(data, want[i]) {
+						t.Errorf("ReadObject(%s) read other data", ids[i])
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
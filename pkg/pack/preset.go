@@ -0,0 +1,108 @@
+package pack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/finding"
+)
+
+// Preset is a named bundle of checks, so that users need not pick each of
+// them
+type Preset struct {
+	Name        string
+	Description string
+
+	TreeChecks      bool
+	TextChecks      bool
+	SignatureChecks bool
+	DoubleRead      bool
+	// Severities overrides the severities of findings, in the form
+	// ParseSeverityMap takes
+	Severities string
+}
+
+var presets = map[string]*Preset{
+	"transfer": {
+		Name:        "transfer",
+		Description: "what a server receiving a push or fetch checks, like git's transfer.fsckObjects",
+		TreeChecks:  true,
+		Severities:  "bad-tree=error,bad-tree-mode=error",
+	},
+	"fsck-strict": {
+		Name:            "fsck-strict",
+		Description:     "like git fsck --strict, every malformed tree, message or signature fails",
+		TreeChecks:      true,
+		TextChecks:      true,
+		SignatureChecks: true,
+		Severities: "bad-tree=error,bad-tree-mode=error,bad-symlink=error,bad-signature=error," +
+			"nul-in-message=error,bad-encoding=error",
+	},
+	"hosting-policy": {
+		Name:        "hosting-policy",
+		Description: "what a hosting service refuses: bad modes, symlinks and control characters, warning about names Windows users cannot check out",
+		TreeChecks:  true,
+		TextChecks:  true,
+		Severities: "bad-tree=error,bad-tree-mode=error,bad-symlink=error,control-character=error," +
+			"nul-in-message=error,windows-name=warning,case-collision=warning",
+	},
+	"forensics": {
+		Name:            "forensics",
+		Description:     "every content check and a second read of each entry, telling storage faults apart from a damaged pack, the findings keep their severities",
+		TreeChecks:      true,
+		TextChecks:      true,
+		SignatureChecks: true,
+		DoubleRead:      true,
+	},
+}
+
+// LookupPreset returns a preset by name, see PresetNames
+func LookupPreset(name string) (*Preset, error) {
+	preset, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown checks %q, have %v", name, PresetNames())
+	}
+	return preset, nil
+}
+
+func PresetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PresetOptions returns the options turning on the checks of the named
+// presets together. severities, in the form ParseSeverityMap takes, override
+// those of the presets.
+func PresetOptions(names []string, severities string) ([]Option, error) {
+	var opts []Option
+	var specs []string
+	for _, name := range names {
+		preset, err := LookupPreset(name)
+		if err != nil {
+			return nil, err
+		}
+		if preset.TreeChecks {
+			opts = append(opts, WithTreeChecks(true))
+		}
+		if preset.TextChecks {
+			opts = append(opts, WithTextChecks(true))
+		}
+		if preset.SignatureChecks {
+			opts = append(opts, WithSignatureChecks(true))
+		}
+		if preset.DoubleRead {
+			opts = append(opts, WithDoubleRead(true))
+		}
+		specs = append(specs, preset.Severities)
+	}
+	severityMap, err := finding.ParseSeverityMap(strings.Join(append(specs, severities), ","))
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, WithSeverities(severityMap)), nil
+}
@@ -0,0 +1,263 @@
+package pack
+
+import (
+	"fmt"
+	"strings"
+)
+
+// flateEnd tells if the last two bytes of a deflate stream are an empty final
+// block of fixed huffman codes starting on a byte boundary: the final bit and
+// the two type bits, 011, and the seven zero bits of the end of block code,
+// padded with zero bits, 03 00. compress/flate closes a stream with such a
+// block after the blocks holding data, zlib sets the final bit on the last
+// block holding data instead. compress/flate does not always start it on a
+// byte boundary, but the unaligned ones end like zlib's often do.
+func flateEnd(prev, last byte) bool {
+	return prev == 0x03 && last == 0x00
+}
+
+// zlibLevels names the FLEVEL bits of a zlib header
+var zlibLevels = [4]string{"fastest", "fast", "default", "maximum"}
+
+// writerTraits are the details of how a pack was deflated, which differ
+// between the implementations writing packs. The scan gathers them.
+type writerTraits struct {
+	// levels counts the zlib streams by compression level
+	levels [4]uint32
+	// flateEnds counts the zlib streams ending the way compress/flate often
+	// ends them
+	flateEnds uint32
+	// tail holds the last compressed bytes the scan consumed, the end of the
+	// deflate stream and the adler32 once an entry is inflated
+	tail [6]byte
+}
+
+// consumed records the last compressed bytes used, for the stream ends
+func (t *writerTraits) consumed(b []byte) {
+	if len(b) >= len(t.tail) {
+		copy(t.tail[:], b[len(b)-len(t.tail):])
+		return
+	}
+	copy(t.tail[:], t.tail[len(b):])
+	copy(t.tail[len(t.tail)-len(b):], b)
+}
+
+// entry records the traits of obj once the scan has inflated it, level is
+// from its zlib header or -1 if that could not be read
+func (t *writerTraits) entry(obj *Object, level int) {
+	if level >= 0 {
+		t.levels[level]++
+	}
+	// the zlib header, a block with data, the empty block and the adler32
+	if obj.packedSize-(obj.dataOffset-obj.offset) < 2+1+2+4 {
+		return
+	}
+	if flateEnd(t.tail[0], t.tail[1]) {
+		t.flateEnds++
+	}
+}
+
+// The implementations Producer tells apart
+const (
+	producerGit     = "git"
+	producerJGit    = "JGit"
+	producerLibgit2 = "libgit2"
+	producerGoGit   = "go-git"
+)
+
+var producers = []string{producerGit, producerJGit, producerLibgit2, producerGoGit}
+
+// Producer is a guess at which implementation wrote a pack. Name may list a
+// few implementations when the heuristics cannot tell them apart, Confidence
+// is the share of the heuristics that voted and agree with it.
+type Producer struct {
+	Name       string   `json:"name"`
+	Confidence float64  `json:"confidence"`
+	Evidence   []string `json:"evidence"`
+}
+
+// producerVote is what a heuristic concluded, producers is empty when it
+// could not tell
+type producerVote struct {
+	producers []string
+	evidence  string
+}
+
+// Producer guesses which implementation wrote the pack once it is verified.
+// It is nil when the pack gives nothing away.
+func (pf *PackFile) Producer() *Producer {
+	votes := []*producerVote{pf.voteZlibEnds(), pf.voteDeltas(), pf.voteOrder()}
+
+	score := make(map[string]int)
+	voted := 0
+	p := &Producer{}
+	for _, v := range votes {
+		if v == nil {
+			continue
+		}
+		p.Evidence = append(p.Evidence, v.evidence)
+		if len(v.producers) > 0 {
+			voted++
+		}
+		for _, name := range v.producers {
+			score[name]++
+		}
+	}
+	if voted == 0 {
+		return nil
+	}
+
+	best := 0
+	var names []string
+	for _, name := range producers {
+		switch {
+		case score[name] > best:
+			best, names = score[name], []string{name}
+		case score[name] == best:
+			names = append(names, name)
+		}
+	}
+	p.Name = strings.Join(names, " or ")
+	p.Confidence = float64(best) / float64(voted)
+
+	var levels []string
+	for level, n := range pf.traits.levels {
+		if n > 0 {
+			levels = append(levels, fmt.Sprintf("%d at %s", n, zlibLevels[level]))
+		}
+	}
+	if len(levels) > 0 {
+		p.Evidence = append(p.Evidence, "zlib compression levels: "+strings.Join(levels, ", "))
+	}
+	if depth := pf.maxDepth(); depth > 0 {
+		p.Evidence = append(p.Evidence, fmt.Sprintf("deepest delta chain is %d", depth))
+	}
+	return p
+}
+
+// flateEndShare is one over the share of zlib streams ending in flateEnd
+// above which they are taken for compress/flate's. It ends about a fifth of
+// them so, zlib about one in a hundred by chance.
+const flateEndShare = 10
+
+// voteZlibEnds tells compress/flate from zlib, which git, JGit through
+// java.util.zip and libgit2 all use
+func (pf *PackFile) voteZlibEnds() *producerVote {
+	objects := uint32(len(pf.objects))
+	if objects == 0 {
+		return nil
+	}
+	ends := pf.traits.flateEnds
+	v := &producerVote{evidence: fmt.Sprintf("%d of %d zlib streams end in a byte aligned empty block, over 1 in %d is compress/flate", ends, objects, flateEndShare)}
+	if ends*flateEndShare > objects {
+		v.producers = []string{producerGoGit}
+	} else {
+		v.producers = []string{producerGit, producerJGit, producerLibgit2}
+	}
+	return v
+}
+
+// voteDeltas looks at the kind of deltas, libgit2 only writes ref-deltas
+func (pf *PackFile) voteDeltas() *producerVote {
+	var ofsDeltas, refDeltas, refBeforeBase uint32
+	for _, obj := range pf.objects {
+		switch obj._type {
+		case ObjOfsDelta:
+			ofsDeltas++
+		case ObjRefDelta:
+			refDeltas++
+			if obj.base != nil && !obj.base.external && obj.base.offset > obj.offset {
+				refBeforeBase++
+			}
+		}
+	}
+
+	v := &producerVote{}
+	switch {
+	case ofsDeltas > 0:
+		v.producers = []string{producerGit, producerJGit, producerGoGit}
+		v.evidence = fmt.Sprintf("%d of %d deltas are ofs-deltas", ofsDeltas, ofsDeltas+refDeltas)
+	case refDeltas > 0:
+		v.producers = []string{producerLibgit2}
+		v.evidence = fmt.Sprintf("all %d deltas are ref-deltas", refDeltas)
+	default:
+		return nil
+	}
+	if refBeforeBase > 0 {
+		v.evidence += fmt.Sprintf(", %d of them before their base", refBeforeBase)
+	}
+	return v
+}
+
+// voteOrder looks at how the object types follow each other. git and
+// libgit2 write trees and blobs in recency order, mostly mixing them, while
+// JGit writes all commits, tags, trees and then blobs, and go-git sorts the
+// objects by type so its tags come last.
+func (pf *PackFile) voteOrder() *producerVote {
+	var runs []ObjectType
+	seen := make(map[ObjectType]bool)
+	grouped := true
+	for _, obj := range pf.objects {
+		_type := obj.realType
+		if _type == ObjNone {
+			_type = obj._type
+		}
+		if len(runs) > 0 && runs[len(runs)-1] == _type {
+			continue
+		}
+		if seen[_type] {
+			grouped = false
+		}
+		seen[_type] = true
+		runs = append(runs, _type)
+	}
+	if !seen[ObjTree] || !seen[ObjBlob] {
+		return nil
+	}
+
+	v := &producerVote{}
+	if !grouped {
+		v.producers = []string{producerGit, producerLibgit2}
+		v.evidence = fmt.Sprintf("object types change %d times along the pack", len(runs)-1)
+		return v
+	}
+	var order []string
+	for _, _type := range runs {
+		order = append(order, _type.String())
+	}
+	v.evidence = "objects are grouped by type: " + strings.Join(order, ", ")
+	if inOrder(runs, ObjCommit, ObjTag, ObjTree, ObjBlob) {
+		v.producers = append(v.producers, producerJGit)
+	}
+	if inOrder(runs, ObjCommit, ObjTree, ObjBlob, ObjTag) {
+		v.producers = append(v.producers, producerGoGit)
+	}
+	if len(v.producers) == 0 {
+		v.producers = []string{producerGit, producerLibgit2}
+	}
+	return v
+}
+
+// inOrder tells if runs follows the order of types, leaving some out
+func inOrder(runs []ObjectType, types ...ObjectType) bool {
+	for _, _type := range runs {
+		for len(types) > 0 && types[0] != _type {
+			types = types[1:]
+		}
+		if len(types) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// maxDepth returns the length of the longest delta chain
+func (pf *PackFile) maxDepth() uint32 {
+	var depth uint32
+	for _, obj := range pf.objects {
+		if obj.depth > depth {
+			depth = obj.depth
+		}
+	}
+	return depth
+}
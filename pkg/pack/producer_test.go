@@ -0,0 +1,93 @@
+package pack
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestFlateEndStreams(t *testing.T) {
+	tests := []struct {
+		name string
+		// stream is a whole zlib stream, the deflate data ends 4 bytes before
+		// the end
+		stream string
+		want   bool
+	}{
+		{
+			// zlib 1.2.13, as git, JGit and libgit2 link it, deflating
+			// "line 1\nline 1\n\x00": its last block ends in 0c 00, the end of
+			// an empty block of compress/flate if it did not start on a byte
+			name:   "zlib",
+			stream: "789ccbc9cc4b5530e4ca81500c00260a0407",
+			want:   false,
+		},
+		{
+			// compress/zlib deflating "hello hello hello\n" into a stored
+			// block, which ends on a byte
+			name:   "compress/flate",
+			stream: "789c001200edff68656c6c6f2068656c6c6f2068656c6c6f0a030040b50687",
+			want:   true,
+		},
+		{
+			// the empty stream of both is just the empty final block, which
+			// is not after data
+			name:   "empty",
+			stream: "789c030000000001",
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := hex.DecodeString(tt.stream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			traits := &writerTraits{}
+			traits.consumed(stream)
+			obj := &Object{ObjectHeader: &ObjectHeader{}, packedSize: uint64(len(stream))}
+			traits.entry(obj, int(stream[1]>>6))
+			if got := traits.flateEnds == 1; got != tt.want {
+				t.Errorf("stream %s counted as a compress/flate end: %v, want %v", tt.stream, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProducer(t *testing.T) {
+	tests := []struct {
+		// pack is in testdata
+		pack string
+		want string
+	}{
+		// git repack -adf of six commits of four growing files and a tag
+		{"producer-git.pack", producerGit},
+		// the same history through the system zlib, the way libgit2 writes
+		// it: ref-deltas only, in recency order
+		{"producer-libgit2.pack", producerLibgit2},
+		// the same history through Writer, which deflates with
+		// compress/zlib, sorted by type with the tag last like go-git
+		{"producer-go-git.pack", producerGoGit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pack, func(t *testing.T) {
+			pf, err := NewPackFile("testdata/" + tt.pack)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pf.Close()
+			if err := pf.ParseHeader(); err != nil {
+				t.Fatal(err)
+			}
+			if err := pf.verifyObjects(); err != nil {
+				t.Fatal(err)
+			}
+			p := pf.Producer()
+			if p == nil {
+				t.Fatal("no producer guessed")
+			}
+			if p.Name != tt.want || p.Confidence != 1 {
+				t.Errorf("guessed %s at %v, want %s at 1: %v", p.Name, p.Confidence, tt.want, p.Evidence)
+			}
+		})
+	}
+}
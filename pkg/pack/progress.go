@@ -0,0 +1,151 @@
+package pack
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adlternative/git-miner/pkg/catalog"
+	log "github.com/sirupsen/logrus"
+)
+
+// progressWindow is how many ticks the rolling throughput is taken over
+const progressWindow = 10
+
+// PhaseTiming is how long a phase of the verification took
+type PhaseTiming struct {
+	Phase            string  `json:"phase"`
+	Seconds          float64 `json:"seconds"`
+	ObjectsPerSecond float64 `json:"objectsPerSecond"`
+	BytesPerSecond   float64 `json:"bytesPerSecond"`
+}
+
+type progressSample struct {
+	at      time.Time
+	objects uint64
+	bytes   uint64
+}
+
+// progress times the phases of the verification and, given an interval,
+// logs the rolling throughput and an ETA while a phase runs
+type progress struct {
+	interval time.Duration
+
+	phase        string
+	start        time.Time
+	totalObjects uint64
+	totalBytes   uint64
+	objects      uint64
+	bytes        uint64
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	timings []*PhaseTiming
+}
+
+func (p *progress) begin(phase string, totalObjects uint64, totalBytes uint64) {
+	p.end()
+	p.phase = phase
+	p.start = time.Now()
+	p.totalObjects = totalObjects
+	p.totalBytes = totalBytes
+	atomic.StoreUint64(&p.objects, 0)
+	atomic.StoreUint64(&p.bytes, 0)
+	if p.interval > 0 {
+		p.stop = make(chan struct{})
+		p.stopped.Add(1)
+		go p.show()
+	}
+}
+
+func (p *progress) add(objects uint64, bytes uint64) {
+	atomic.AddUint64(&p.objects, objects)
+	atomic.AddUint64(&p.bytes, bytes)
+}
+
+// end finishes the current phase, if any
+func (p *progress) end() {
+	if p.phase == "" {
+		return
+	}
+	if p.stop != nil {
+		close(p.stop)
+		p.stopped.Wait()
+		p.stop = nil
+	}
+	elapsed := time.Since(p.start)
+	timing := &PhaseTiming{
+		Phase:   p.phase,
+		Seconds: elapsed.Seconds(),
+	}
+	if elapsed > 0 {
+		timing.ObjectsPerSecond = float64(atomic.LoadUint64(&p.objects)) / elapsed.Seconds()
+		timing.BytesPerSecond = float64(atomic.LoadUint64(&p.bytes)) / elapsed.Seconds()
+	}
+	p.timings = append(p.timings, timing)
+	if p.interval > 0 {
+		log.Printf(catalog.Format(catalog.PhaseDone), timing.Phase, elapsed.Round(time.Millisecond),
+			timing.ObjectsPerSecond, timing.BytesPerSecond/(1<<20))
+	}
+	p.phase = ""
+}
+
+// showSummary logs the share of the total time each phase took
+func (p *progress) showSummary() {
+	p.end()
+	if p.interval <= 0 {
+		return
+	}
+	var total float64
+	for _, timing := range p.timings {
+		total += timing.Seconds
+	}
+	for _, timing := range p.timings {
+		share := 0.0
+		if total > 0 {
+			share = timing.Seconds / total * 100
+		}
+		log.Printf(catalog.Format(catalog.PhaseShare), timing.Phase, share)
+	}
+}
+
+func (p *progress) show() {
+	defer p.stopped.Done()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	window := []progressSample{{at: p.start}}
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			sample := progressSample{
+				at:      now,
+				objects: atomic.LoadUint64(&p.objects),
+				bytes:   atomic.LoadUint64(&p.bytes),
+			}
+			window = append(window, sample)
+			if len(window) > progressWindow {
+				window = window[1:]
+			}
+			oldest := window[0]
+			seconds := sample.at.Sub(oldest.at).Seconds()
+			objectRate := float64(sample.objects-oldest.objects) / seconds
+			byteRate := float64(sample.bytes-oldest.bytes) / seconds
+
+			eta := "unknown"
+			if byteRate > 0 && p.totalBytes >= sample.bytes {
+				eta = time.Duration(float64(p.totalBytes-sample.bytes) / byteRate * float64(time.Second)).Round(time.Second).String()
+			} else if objectRate > 0 && p.totalObjects >= sample.objects {
+				eta = time.Duration(float64(p.totalObjects-sample.objects) / objectRate * float64(time.Second)).Round(time.Second).String()
+			}
+			percent := 0.0
+			if p.totalObjects > 0 {
+				percent = float64(sample.objects) / float64(p.totalObjects) * 100
+			}
+			log.Printf(catalog.Format(catalog.Progress), p.phase, sample.objects, p.totalObjects, percent,
+				objectRate, byteRate/(1<<20), eta)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+//go:build !noreport
+
+package pack
+
+import (
+	"fmt"
+
+	"github.com/adlternative/git-miner/pkg/finding"
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+// Recheck re-runs only the checks behind f, a finding of the report, against
+// the pack as it is now, so that a triage tool can confirm a fix without
+// verifying everything again. The entry f is about, found through the idx by
+// its oid or else its offset, is verified against the idx and given to the
+// content checks of f's code; a tree's symlinks are checked against their
+// targets in the idx. A finding with neither, like the error a verification
+// stopped at, cannot be narrowed down: the idx, the header and trailer of the
+// pack and every entry through the idx are checked, like Sample does at 100
+// percent. Vetoes, signature verifiers and the thin bases of the pack are
+// not rechecked. opts should be those of the verification, for its
+// severities and baseline.
+//
+// It returns the finding as it stands now, nil if it is gone, e.g. because the
+// entry is no longer in the pack.
+func (r *Report) Recheck(f *finding.Finding, opts ...Option) (*finding.Finding, error) {
+	packFile, err := NewPackFile(r.Pack, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer packFile.Close()
+
+	if err := packFile.ParseHeader(); err != nil {
+		return packFile.recheckResult(f, AsFinding(packFile.checkChanged(err))), nil
+	}
+	idx, err := packFile.openIdx(r.Pack)
+	if err != nil {
+		return packFile.recheckResult(f, AsFinding(err)), nil
+	}
+	defer idx.Close()
+	s, err := newSampler(packFile, idx)
+	if err != nil {
+		return packFile.recheckResult(f, AsFinding(packFile.checkChanged(err))), nil
+	}
+
+	if f.Oid == "" && f.Offset == 0 {
+		for _, obj := range s.entries {
+			if err := s.verify(obj); err != nil {
+				return packFile.recheckResult(f, s.entryFinding(obj, err)), nil
+			}
+		}
+		if err := packFile.CheckUnchanged(); err != nil {
+			return packFile.recheckResult(f, AsFinding(err)), nil
+		}
+		return nil, nil
+	}
+
+	obj, err := s.find(f)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	if err := s.verify(obj); err != nil {
+		return packFile.recheckResult(f, s.entryFinding(obj, err)), nil
+	}
+	findings, err := s.recheckContent(obj, f.Code)
+	if err != nil {
+		return packFile.recheckResult(f, s.entryFinding(obj, err)), nil
+	}
+	if err := packFile.CheckUnchanged(); err != nil {
+		findings = append(findings, AsFinding(err))
+	}
+	return packFile.recheckResult(f, findings...), nil
+}
+
+// find returns the entry f is about, nil if the pack has none
+func (s *sampler) find(f *finding.Finding) (*Object, error) {
+	var obj *Object
+	if f.Oid != "" {
+		id, err := oid.FromHex(f.Oid)
+		if err != nil {
+			return nil, fmt.Errorf("finding %s: %w", f.Code, err)
+		}
+		i, ok := s.idx.Find(id)
+		if !ok {
+			return nil, nil
+		}
+		offset, err := s.idx.Offset(i)
+		if err != nil {
+			return nil, err
+		}
+		obj = s.byOffset[offset]
+	} else if obj = s.byOffset[f.Offset]; obj == nil {
+		return nil, nil
+	}
+	obj.oid = s.idx.Oid(obj.index)
+	return obj, nil
+}
+
+// entryFinding turns an error verifying an entry into a finding about it
+func (s *sampler) entryFinding(obj *Object, err error) *finding.Finding {
+	err = s.pf.checkChanged(fmt.Errorf("object %x at offset %d: %w", s.idx.Oid(obj.index), obj.offset, err))
+	return AsFinding(err).WithOid(s.idx.Oid(obj.index)).WithOffset(obj.offset)
+}
+
+// recheckContent runs the checks of the content of a verified entry that
+// report findings of code
+func (s *sampler) recheckContent(obj *Object, code string) ([]*finding.Finding, error) {
+	switch code {
+	case CodeNonCanonical:
+		// verify read the entry header
+		if obj.overlongSize {
+			return []*finding.Finding{finding.New(finding.Warning, CodeNonCanonical,
+				"entry header encodes size %d in more bytes than needed", obj.size).WithOffset(obj.offset)}, nil
+		}
+		return nil, nil
+	case CodeBadTree, CodeBadMode, CodeBadSymlink, CodeWindowsName, CodeCaseCollision,
+		CodeBadEncoding, CodeNulInMessage, CodeControlCharacter, CodeBadSignature:
+	default:
+		return nil, nil
+	}
+
+	realType, data, err := s.unpack(obj, 0)
+	if err != nil {
+		return nil, err
+	}
+	obj.realType = realType
+	switch code {
+	case CodeBadEncoding, CodeNulInMessage, CodeControlCharacter:
+		c := &textChecker{}
+		c.check(obj, data)
+		return c.done(), nil
+	case CodeBadSignature:
+		c := newSignatureChecker()
+		c.check(obj, data)
+		return c.done(), nil
+	}
+
+	c := newTreeChecker(int(s.idx.ObjectCount))
+	c.check(obj, data)
+	// the symlink targets in the pack are resolved to check them
+	objects := []*Object{obj}
+	for _, link := range c.symlinks {
+		i, ok := s.idx.Find(link.target)
+		if !ok {
+			continue
+		}
+		offset, err := s.idx.Offset(i)
+		if err != nil {
+			return nil, err
+		}
+		target := s.byOffset[offset]
+		target.oid = link.target
+		if _, err := s.realType(target, 0); err != nil {
+			return nil, err
+		}
+		if target.realType == ObjBlob {
+			_, data, err := s.unpack(target, 0)
+			if err != nil {
+				return nil, err
+			}
+			c.blobSizes[target.index] = uint64(len(data))
+		}
+		objects = append(objects, target)
+	}
+	return c.done(objects), nil
+}
+
+// recheckResult returns the finding of findings that f still stands as,
+// after the severities: one of its code, about the same tree entry if f is,
+// or else an error one, which may be what hides f now. nil means f is gone.
+func (pf *PackFile) recheckResult(f *finding.Finding, findings ...*finding.Finding) *finding.Finding {
+	var failed *finding.Finding
+	for _, found := range pf.severities.Apply(findings) {
+		if found == nil {
+			continue
+		}
+		if found.Code == f.Code && found.Data["entry"] == f.Data["entry"] {
+			pf.baseline.Mark(found)
+			return found
+		}
+		if failed == nil && found.Severity >= finding.Error {
+			failed = found
+		}
+	}
+	if failed != nil {
+		pf.baseline.Mark(failed)
+	}
+	return failed
+}
@@ -0,0 +1,300 @@
+package pack
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/finding"
+	"github.com/adlternative/git-miner/pkg/object"
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+// Finding codes of CheckRefs
+const (
+	CodeMissingTip      = "missing-tip"
+	CodeDisconnectedTip = "disconnected-tip"
+)
+
+// Ref is a ref of a remote
+type Ref struct {
+	Name string
+	Oid  oid.Oid
+}
+
+// ParseRefAdvertisement reads the refs of a remote, one per line: an object
+// id and a ref name apart by whitespace, the way git ls-remote and git
+// show-ref print them. Empty lines and the capabilities after a NUL, which
+// the first ref of a protocol advertisement carries, are dropped.
+func ParseRefAdvertisement(r io.Reader) ([]*Ref, error) {
+	var refs []*Ref
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if nul := strings.IndexByte(text, 0); nul >= 0 {
+			text = text[:nul]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want <oid> <ref>, got %q", line, text)
+		}
+		id, err := oid.FromHex(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		refs = append(refs, &Ref{Name: fields[1], Oid: id})
+	}
+	return refs, scanner.Err()
+}
+
+// OpenPackDir opens every pack of the pack directory dir as an ObjectSource,
+// the caller closes them. They share a FileBudget of half the open file
+// limit, unless opts give another.
+func OpenPackDir(dir string, opts ...Option) ([]*PackObjectSource, error) {
+	packs, err := filepath.Glob(filepath.Join(dir, "pack-*.pack"))
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]Option{WithFileBudget(NewFileBudget(0))}, opts...)
+	var sources []*PackObjectSource
+	for _, packPath := range packs {
+		source, err := NewPackObjectSource(packPath, opts...)
+		if err != nil {
+			for _, source := range sources {
+				source.Close()
+			}
+			return nil, fmt.Errorf("%s: %w", packPath, err)
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// refWalker walks the objects reachable from refs through a set of object
+// sources
+type refWalker struct {
+	sources []ObjectSource
+	seen    map[oid.Oid]bool
+	// links are the objects each commit, tree and tag walked refers to
+	links map[oid.Oid][]oid.Oid
+	// broken are the objects that are missing or refer to an object of
+	// another type than they say, and why
+	broken map[oid.Oid]string
+}
+
+// contains tells whether any source has the object, reading it only from
+// sources that cannot tell otherwise
+func (w *refWalker) contains(id oid.Oid) (bool, error) {
+	for _, source := range w.sources {
+		if c, ok := source.(interface{ Contains(oid.Oid) bool }); ok {
+			if c.Contains(id) {
+				return true, nil
+			}
+			continue
+		}
+		_, _, err := source.ReadObject(id)
+		if err == nil {
+			return true, nil
+		} else if !errors.Is(err, ErrObjectNotFound) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (w *refWalker) read(id oid.Oid) (ObjectType, []byte, error) {
+	for _, source := range w.sources {
+		_type, data, err := source.ReadObject(id)
+		if !errors.Is(err, ErrObjectNotFound) {
+			return _type, data, err
+		}
+	}
+	return ObjNone, nil, fmt.Errorf("%w: %s", ErrObjectNotFound, id)
+}
+
+// linksOf returns the objects a commit, tree or tag refers to and the types
+// it says they have
+func linksOf(_type ObjectType, id oid.Oid, data []byte) ([]oid.Oid, []ObjectType, error) {
+	var ids []oid.Oid
+	var types []ObjectType
+	add := func(value string, linkType ObjectType) error {
+		link, err := oid.FromHex(value)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", _type.ContentType(), id, err)
+		}
+		ids = append(ids, link)
+		types = append(types, linkType)
+		return nil
+	}
+	switch _type {
+	case ObjCommit, ObjTag:
+		commit, err := object.ParseCommit(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s %s: %w", _type.ContentType(), id, err)
+		}
+		if _type == ObjTag {
+			for _, value := range commit.Get("object") {
+				linkType := ObjNone
+				if types := commit.Get("type"); len(types) == 1 {
+					linkType, _ = ParseContentType(types[0])
+				}
+				if err := add(value, linkType); err != nil {
+					return nil, nil, err
+				}
+			}
+			break
+		}
+		for _, value := range commit.Get("tree") {
+			if err := add(value, ObjTree); err != nil {
+				return nil, nil, err
+			}
+		}
+		for _, value := range commit.Get("parent") {
+			if err := add(value, ObjCommit); err != nil {
+				return nil, nil, err
+			}
+		}
+	case ObjTree:
+		entries, err := object.ParseTree(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tree %s: %w", id, err)
+		}
+		for _, entry := range entries {
+			switch {
+			case entry.Mode == gitlinkMode:
+			case entry.Mode == treeMode:
+				ids, types = append(ids, entry.Oid), append(types, ObjTree)
+			default:
+				ids, types = append(ids, entry.Oid), append(types, ObjBlob)
+			}
+		}
+	}
+	return ids, types, nil
+}
+
+// walk visits every object reachable from tip, noting the broken ones
+func (w *refWalker) walk(tip oid.Oid) error {
+	type item struct {
+		id       oid.Oid
+		_type    ObjectType
+		referrer oid.Oid
+	}
+	stack := []item{{id: tip}}
+	w.seen[tip] = true
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if it._type == ObjBlob {
+			ok, err := w.contains(it.id)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				w.broken[it.id] = fmt.Sprintf("blob %s, referred to by %s, is missing", it.id, it.referrer)
+			}
+			continue
+		}
+		_type, data, err := w.read(it.id)
+		if errors.Is(err, ErrObjectNotFound) {
+			w.broken[it.id] = fmt.Sprintf("%s %s, referred to by %s, is missing", it._type.ContentType(), it.id, it.referrer)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if it._type != ObjNone && _type != it._type {
+			// the referrer is what is wrong, the object can still be walked
+			if _, ok := w.broken[it.referrer]; !ok {
+				w.broken[it.referrer] = fmt.Sprintf("%s refers to %s as a %s, it is a %s", it.referrer, it.id, it._type.ContentType(), _type.ContentType())
+			}
+		}
+		links, types, err := linksOf(_type, it.id, data)
+		if err != nil {
+			return err
+		}
+		w.links[it.id] = links
+		for i, link := range links {
+			if !w.seen[link] {
+				w.seen[link] = true
+				stack = append(stack, item{id: link, _type: types[i], referrer: it.id})
+			}
+		}
+	}
+	return nil
+}
+
+// CheckRefs reports the refs of a remote that the objects of sources cannot
+// serve, as a mirror of it must: an error finding for each ref whose tip
+// none of them has, and for each whose tip reaches an object that is missing
+// or not of the type its referrer says. No findings means every ref could be
+// fetched from the mirror complete.
+func CheckRefs(refs []*Ref, sources ...ObjectSource) ([]*finding.Finding, error) {
+	w := &refWalker{
+		sources: sources,
+		seen:    make(map[oid.Oid]bool),
+		links:   make(map[oid.Oid][]oid.Oid),
+		broken:  make(map[oid.Oid]string),
+	}
+	missing := make(map[oid.Oid]bool)
+	for _, ref := range refs {
+		if missing[ref.Oid] {
+			continue
+		}
+		ok, err := w.contains(ref.Oid)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			missing[ref.Oid] = true
+		} else if !w.seen[ref.Oid] {
+			if err := w.walk(ref.Oid); err != nil {
+				return nil, fmt.Errorf("ref %s: %w", ref.Name, err)
+			}
+		}
+	}
+
+	// the objects reaching a broken one, found backwards from it, and which
+	// one they reach
+	reaches := make(map[oid.Oid]oid.Oid)
+	if len(w.broken) > 0 {
+		referrers := make(map[oid.Oid][]oid.Oid)
+		for id, links := range w.links {
+			for _, link := range links {
+				referrers[link] = append(referrers[link], id)
+			}
+		}
+		for id := range w.broken {
+			reaches[id] = id
+			stack := []oid.Oid{id}
+			for len(stack) > 0 {
+				id := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				for _, referrer := range referrers[id] {
+					if _, ok := reaches[referrer]; !ok {
+						reaches[referrer] = reaches[id]
+						stack = append(stack, referrer)
+					}
+				}
+			}
+		}
+	}
+
+	var findings []*finding.Finding
+	for _, ref := range refs {
+		if missing[ref.Oid] {
+			findings = append(findings, finding.New(finding.Error, CodeMissingTip,
+				"ref %s points to %s, which is not there locally", ref.Name, ref.Oid).WithOid(ref.Oid).With("ref", ref.Name))
+		} else if broken, ok := reaches[ref.Oid]; ok {
+			findings = append(findings, finding.New(finding.Error, CodeDisconnectedTip,
+				"ref %s reaches objects that are not there: %s", ref.Name, w.broken[broken]).
+				WithOid(ref.Oid).With("ref", ref.Name).With("broken", broken.String()))
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,199 @@
+//go:build !noreport
+
+package pack
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/finding"
+	log "github.com/sirupsen/logrus"
+)
+
+// SchemaVersion is the version of the Report schema. It is bumped whenever
+// a field changes meaning or goes away; new fields may be added without a
+// bump, so parsers must ignore fields they do not know.
+//
+// Version 2 names the types of objects like git does, commit or ofs-delta,
+// where version 1 had the Go names, Commit or OfsDelta.
+const SchemaVersion = 2
+
+// schemaDowngrades rewrite a report of version v+1 into version v, so that
+// parsers written against an older schema can ask for it
+var schemaDowngrades = map[int]func(r *Report){
+	1: func(r *Report) {
+		for _, objects := range [][]*ObjectReport{r.ThinBases, r.Objects} {
+			for _, or := range objects {
+				or.Type = goTypeName(or.Type)
+				or.RealType = goTypeName(or.RealType)
+			}
+		}
+	},
+}
+
+// deltaTypeNames are the names git gives the delta entry types
+var deltaTypeNames = map[ObjectType]string{
+	ObjOfsDelta: "ofs-delta",
+	ObjRefDelta: "ref-delta",
+}
+
+// typeName is the name of t in reports, as git calls it
+func typeName(t ObjectType) string {
+	if name, ok := deltaTypeNames[t]; ok {
+		return name
+	}
+	return t.ContentType()
+}
+
+// goTypeName turns a type name of typeName into the one of version 1
+func goTypeName(name string) string {
+	if name == "" {
+		return ""
+	}
+	for t, deltaName := range deltaTypeNames {
+		if deltaName == name {
+			return t.String()
+		}
+	}
+	t, err := ParseContentType(name)
+	if err != nil {
+		return name
+	}
+	return t.String()
+}
+
+// SchemaVersions returns the schema versions a Report can be emitted in
+func SchemaVersions() []int {
+	versions := []int{SchemaVersion}
+	for v := range schemaDowngrades {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Report is the machine-readable result of verifying a pack
+type Report struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Pack          string           `json:"pack"`
+	Version       uint32           `json:"version,omitempty"`
+	ObjectNums    uint32           `json:"objectNums"`
+	ThinBases     []*ObjectReport  `json:"thinBases,omitempty"`
+	Objects       []*ObjectReport  `json:"objects"`
+	Error         string           `json:"error,omitempty"`
+	Producer      *Producer        `json:"producer,omitempty"`
+	Signatures    *SignatureCounts `json:"signatures,omitempty"`
+	// Findings holds the warnings and the error verification stopped at
+	Findings []*finding.Finding `json:"findings"`
+	Timings  []*PhaseTiming     `json:"timings,omitempty"`
+}
+
+type ObjectReport struct {
+	Index      uint32 `json:"index"`
+	Offset     uint64 `json:"offset"`
+	Oid        string `json:"oid"`
+	Type       string `json:"type"`
+	Size       uint64 `json:"size"`
+	PackedSize uint64 `json:"packedSize,omitempty"`
+	CRC32      string `json:"crc32,omitempty"`
+	RealType   string `json:"realType,omitempty"`
+	Depth      uint32 `json:"depth,omitempty"`
+	Base       string `json:"base,omitempty"`
+}
+
+// Report describes the pack as far as it was verified in the given schema
+// version, verifyErr is the error verification stopped at, if any.
+func (pf *PackFile) Report(packPath string, schemaVersion int, verifyErr error) (*Report, error) {
+	if schemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("unknown schema version %d, the latest is %d", schemaVersion, SchemaVersion)
+	}
+	for v := SchemaVersion - 1; v >= schemaVersion; v-- {
+		if schemaDowngrades[v] == nil {
+			return nil, fmt.Errorf("schema version %d is not supported", schemaVersion)
+		}
+	}
+
+	r := &Report{
+		SchemaVersion: SchemaVersion,
+		Pack:          packPath,
+		Version:       pf.version,
+		ObjectNums:    pf.objectNums,
+		Objects:       []*ObjectReport{},
+	}
+	for _, base := range pf.externalBases {
+		r.ThinBases = append(r.ThinBases, &ObjectReport{
+			Oid:  base.oid.String(),
+			Type: typeName(base.realType),
+			Size: base.size,
+		})
+	}
+	for _, obj := range pf.objects {
+		or := &ObjectReport{
+			Index:      obj.index,
+			Offset:     obj.offset,
+			Oid:        obj.oid.String(),
+			Type:       typeName(obj._type),
+			Size:       obj.size,
+			PackedSize: obj.packedSize,
+			CRC32:      fmt.Sprintf("%08x", obj.crc32),
+		}
+		if obj.base != nil {
+			or.RealType = typeName(obj.realType)
+			or.Depth = obj.depth
+			or.Base = obj.base.oid.String()
+		}
+		r.Objects = append(r.Objects, or)
+	}
+	if verifyErr == nil {
+		r.Producer = pf.Producer()
+		r.Signatures = pf.Signatures()
+	}
+	r.Findings = append([]*finding.Finding{}, pf.Findings()...)
+	r.Timings = pf.Timings()
+	if verifyErr != nil {
+		r.Error = verifyErr.Error()
+		r.Findings = append(r.Findings, AsFinding(verifyErr))
+	}
+
+	for r.SchemaVersion > schemaVersion {
+		r.SchemaVersion--
+		schemaDowngrades[r.SchemaVersion](r)
+	}
+	return r, nil
+}
+
+// VerifyReport verifies the pack like Verify, but returns what it found as
+// a Report in the given schema version instead of logging it. A failed
+// verification is recorded in the report and returned as well.
+func VerifyReport(packPath string, schemaVersion int, opts ...Option) (*Report, error) {
+	packFile, err := NewPackFile(packPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer packFile.Close()
+
+	verifyErr := packFile.ParseHeader()
+	if verifyErr != nil {
+		verifyErr = packFile.checkChanged(verifyErr)
+	} else {
+		verifyErr = packFile.verifyObjects()
+	}
+	verifyErr = packFile.markKnown(verifyErr)
+	if packFile.dropCache {
+		if err := packFile.DropCache(); err != nil {
+			log.Printf(catalog.Format(catalog.DropCacheError), packPath, err)
+		}
+	}
+	report, err := packFile.Report(packPath, schemaVersion, verifyErr)
+	if err != nil {
+		return nil, err
+	}
+	if verifyErr == nil {
+		// the findings making it fail are in the report already
+		if verifyErr = packFile.findingsError(); verifyErr != nil {
+			report.Error = verifyErr.Error()
+		}
+	}
+	return report, verifyErr
+}
@@ -0,0 +1,371 @@
+package pack
+
+import (
+	"errors"
+	"fmt"
+	"github.com/adlternative/git-miner/pkg/delta"
+	"github.com/adlternative/git-miner/pkg/finding"
+	"github.com/adlternative/git-miner/pkg/oid"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// entryReader reads a single entry straight from the pack file, checksumming
+// every byte consumed so the CRC32 matches the one idx files record.
+type entryReader struct {
+	inputBuf *buffer
+	crc      hash.Hash32
+}
+
+func newEntryReader(file io.ReaderAt, obj *Object) *entryReader {
+	return &entryReader{
+		inputBuf: newBuffer(io.NewSectionReader(file, int64(obj.offset), int64(obj.packedSize))),
+		crc:      crc32.NewIEEE(),
+	}
+}
+
+func (r *entryReader) Fill(min uint64) ([]byte, error) {
+	return r.inputBuf.Fill(min)
+}
+
+func (r *entryReader) Buffer() []byte {
+	return r.inputBuf.Buffer()
+}
+
+func (r *entryReader) Use(length uint64) {
+	r.crc.Write(r.inputBuf.Buffer()[:length])
+	r.inputBuf.Use(length)
+}
+
+func (r *entryReader) skipHeader(obj *Object) error {
+	length := obj.dataOffset - obj.offset
+	if _, err := r.Fill(length); err != nil {
+		return err
+	}
+	r.Use(length)
+	return nil
+}
+
+// resolver computes the CRC32 and object id of every entry, walking each delta
+// tree from its non-delta root. Every goroutine owns whole trees and writes
+// only to the objects in them, so results do not depend on scheduling.
+type resolver struct {
+	pf          *PackFile
+	ofsChildren map[uint64][]*Object
+	refChildren map[oid.Oid][]*Object
+	claimed     []int32
+	errs        []error
+	rejections  []*Rejection
+	// trees, signatures and text are set with WithTreeChecks,
+	// WithSignatureChecks and WithTextChecks
+	trees      *treeChecker
+	signatures *signatureChecker
+	text       *textChecker
+}
+
+func newResolver(pf *PackFile) (*resolver, error) {
+	r := &resolver{
+		pf:          pf,
+		ofsChildren: make(map[uint64][]*Object),
+		refChildren: make(map[oid.Oid][]*Object),
+		claimed:     make([]int32, len(pf.objects)),
+		errs:        make([]error, len(pf.objects)),
+		rejections:  make([]*Rejection, len(pf.objects)),
+	}
+	if pf.checkTrees {
+		r.trees = newTreeChecker(len(pf.objects))
+	}
+	if pf.checkSignatures {
+		r.signatures = newSignatureChecker()
+	}
+	if pf.checkText {
+		r.text = &textChecker{}
+	}
+
+	for _, obj := range pf.objects {
+		switch obj._type {
+		case ObjOfsDelta:
+			baseOffset := obj.offset - obj.baseDistance
+			i := sort.Search(len(pf.objects), func(i int) bool {
+				return pf.objects[i].offset >= baseOffset
+			})
+			if i == len(pf.objects) || pf.objects[i].offset != baseOffset {
+				return nil, fmt.Errorf("object %d at offset %d: delta base offset %d is not an object", obj.index, obj.offset, baseOffset)
+			}
+			r.ofsChildren[baseOffset] = append(r.ofsChildren[baseOffset], obj)
+		case ObjRefDelta:
+			r.refChildren[obj.baseOid] = append(r.refChildren[obj.baseOid], obj)
+		}
+	}
+	return r, nil
+}
+
+// claim makes sure an object is only resolved once, a ref-delta base may
+// appear more than once in a pack
+func (r *resolver) claim(obj *Object) bool {
+	return atomic.CompareAndSwapInt32(&r.claimed[obj.index], 0, 1)
+}
+
+func (r *resolver) children(base *Object) []*Object {
+	var children []*Object
+	if !base.external {
+		children = r.ofsChildren[base.offset]
+	}
+	if !base.oid.IsZero() {
+		children = append(children[:len(children):len(children)], r.refChildren[base.oid]...)
+	}
+	return children
+}
+
+// checkObject runs the checks given in the options on a resolved object, data
+// is nil for a streamed one
+func (r *resolver) checkObject(obj *Object, data []byte) {
+	r.vet(obj, data)
+	r.verifySignatures(obj, data)
+	if r.trees != nil {
+		r.trees.check(obj, data)
+	}
+	if r.signatures != nil {
+		r.signatures.check(obj, data)
+	}
+	if r.text != nil {
+		r.text.check(obj, data)
+	}
+}
+
+func (r *resolver) readData(obj *Object) ([]byte, error) {
+	in := newEntryReader(r.pf.file, obj)
+	if err := in.skipHeader(obj); err != nil {
+		return nil, err
+	}
+	data, err := unpackEntryData(r.pf.inflater, in, obj.size)
+	if err != nil {
+		return nil, r.checkFailedRead(obj, err)
+	}
+	obj.crc32 = in.crc.Sum32()
+	if err := r.checkReread(obj); err != nil {
+		return nil, err
+	}
+	return data, r.checkDoubleRead(obj)
+}
+
+// checkReread compares the crc32 of the two reads of an entry in network
+// filesystem mode
+func (r *resolver) checkReread(obj *Object) error {
+	if r.pf.scanCRC != nil && obj.crc32 != obj.scanCRC32 {
+		return fmt.Errorf("%w: entry crc32 was %08x on the first read and %08x on the second", ErrPackChanged, obj.scanCRC32, obj.crc32)
+	}
+	return nil
+}
+
+// streamOid hashes a non-delta object without holding it in memory
+func (r *resolver) streamOid(obj *Object) error {
+	in := newEntryReader(r.pf.file, obj)
+	if err := in.skipHeader(obj); err != nil {
+		return err
+	}
+	hasher := newObjectHasher(obj._type, obj.size)
+	if err := r.pf.inflater.Inflate(in, obj.size, hasher); err != nil {
+		return r.checkFailedRead(obj, err)
+	}
+	obj.oid = oid.Sum(hasher)
+	obj.crc32 = in.crc.Sum32()
+	if err := r.checkReread(obj); err != nil {
+		return err
+	}
+	return r.checkDoubleRead(obj)
+}
+
+func (r *resolver) resolveRoot(obj *Object) {
+	if !r.claim(obj) {
+		return
+	}
+	r.pf.idle.yield()
+	obj.realType = obj._type
+
+	var data []byte
+	var err error
+	if obj.size >= r.pf.bigFileThreshold && len(r.ofsChildren[obj.offset]) == 0 {
+		// large blobs are hashed while inflating so we never hold them in memory
+		if err = r.streamOid(obj); err == nil && len(r.refChildren[obj.oid]) > 0 {
+			data, err = r.readData(obj)
+		}
+	} else {
+		data, err = r.readData(obj)
+		if err == nil {
+			obj.oid = HashObject(obj._type, data)
+		}
+	}
+	if err != nil {
+		r.errs[obj.index] = err
+		return
+	}
+	r.pf.progress.add(1, obj.packedSize)
+	r.checkObject(obj, data)
+
+	r.resolveChildren(obj, data)
+}
+
+// resolveExternal resolves the deltas based on an object the pack lacks
+func (r *resolver) resolveExternal(base *Object) {
+	children := r.refChildren[base.oid]
+	_type, data, err := r.pf.source.ReadObject(base.oid)
+	if err != nil {
+		if !errors.Is(err, ErrObjectNotFound) {
+			r.errs[children[0].index] = err
+		}
+		return
+	}
+	base.ObjectHeader = &ObjectHeader{
+		size:  uint64(len(data)),
+		_type: _type,
+	}
+	base.realType = _type
+	r.resolveChildren(base, data)
+}
+
+func (r *resolver) resolveChildren(base *Object, baseData []byte) {
+	for _, child := range r.children(base) {
+		if !r.claim(child) {
+			continue
+		}
+		r.pf.idle.yield()
+
+		deltaData, err := r.readData(child)
+		if err != nil {
+			r.errs[child.index] = err
+			continue
+		}
+		data, err := delta.Apply(baseData, deltaData)
+		if err != nil {
+			r.errs[child.index] = err
+			continue
+		}
+
+		child.realType = base.realType
+		child.base = base
+		child.depth = base.depth + 1
+		child.oid = HashObject(child.realType, data)
+		r.pf.progress.add(1, child.packedSize)
+		r.checkObject(child, data)
+		r.resolveChildren(child, data)
+	}
+}
+
+// ResolveObjects inflates every entry found by ParseObjects, computes its
+// CRC32 and object id and resolves delta chains, using a pool of goroutines.
+func (pf *PackFile) ResolveObjects() error {
+	r, err := newResolver(pf)
+	if err != nil {
+		return err
+	}
+
+	threads := pf.idle.threads(pf.threads)
+
+	var packedSize uint64
+	for _, obj := range pf.objects {
+		packedSize += obj.packedSize
+	}
+	pf.progress.begin("resolve", uint64(len(pf.objects)), packedSize)
+	defer pf.progress.end()
+
+	var roots []*Object
+	for _, obj := range pf.objects {
+		if !obj._type.IsDelta() {
+			roots = append(roots, obj)
+		}
+	}
+	r.run(roots, threads)
+
+	if pf.source != nil && !r.failed() {
+		// a thin pack: look up the bases of the ref-deltas left over
+		seen := make(map[oid.Oid]bool)
+		for _, obj := range pf.objects {
+			if obj._type == ObjRefDelta && r.claimed[obj.index] == 0 && !seen[obj.baseOid] {
+				seen[obj.baseOid] = true
+				pf.externalBases = append(pf.externalBases, &Object{
+					oid:      obj.baseOid,
+					external: true,
+				})
+			}
+		}
+		r.run(pf.externalBases, threads)
+
+		found := pf.externalBases[:0]
+		for _, base := range pf.externalBases {
+			if base.ObjectHeader != nil {
+				found = append(found, base)
+			}
+		}
+		pf.externalBases = found
+	}
+
+	// report in pack order so that the result is the same for any thread count
+	for _, obj := range pf.objects {
+		if err := r.errs[obj.index]; err != nil {
+			return fmt.Errorf("object %d at offset %d: %w", obj.index, obj.offset, err)
+		}
+	}
+	var unresolved []*Object
+	for _, obj := range pf.objects {
+		if r.claimed[obj.index] == 0 {
+			unresolved = append(unresolved, obj)
+		}
+	}
+	if len(unresolved) > 0 {
+		first := unresolved[0]
+		if first._type == ObjRefDelta {
+			err := fmt.Errorf("%d deltas could not be resolved, first at offset %d needs base %s (thin pack?)", len(unresolved), first.offset, first.baseOid)
+			return finding.Wrap(CodeMissingObject, err).WithOid(first.baseOid).WithOffset(first.offset)
+		}
+		return fmt.Errorf("%d deltas could not be resolved, first at offset %d", len(unresolved), first.offset)
+	}
+	if r.trees != nil {
+		pf.findings = append(pf.findings, r.trees.done(pf.objects)...)
+	}
+	if r.signatures != nil {
+		pf.findings = append(pf.findings, r.signatures.done()...)
+		pf.signatures = &r.signatures.counts
+	}
+	if r.text != nil {
+		pf.findings = append(pf.findings, r.text.done()...)
+	}
+	return r.rejected()
+}
+
+// run resolves the trees under roots with a pool of goroutines
+func (r *resolver) run(roots []*Object, threads int) {
+	jobs := make(chan *Object)
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range jobs {
+				if obj.external {
+					r.resolveExternal(obj)
+				} else {
+					r.resolveRoot(obj)
+				}
+			}
+		}()
+	}
+	for _, obj := range roots {
+		jobs <- obj
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (r *resolver) failed() bool {
+	for _, err := range r.errs {
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+package pack
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/finding"
+	log "github.com/sirupsen/logrus"
+)
+
+// tmpResumePrefix is the temporary file a resume state is written to
+const tmpResumePrefix = "tmp_resume_"
+
+// OffsetRange is the bytes from Start up to End of a pack
+type OffsetRange struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// ResumeState records how far verifying a pack across several windows got,
+// see VerifyWindow
+type ResumeState struct {
+	// Checksum is the trailer of the pack, the state of another pack is
+	// ignored
+	Checksum string `json:"checksum"`
+	// Passed are the sorted, disjoint ranges of entries which verified
+	Passed []OffsetRange `json:"passed"`
+	// Failed are the entries which did not, retried first in the next window
+	Failed []*finding.Finding `json:"failed"`
+	// Remaining is how many entries were not verified yet
+	Remaining int `json:"remaining"`
+}
+
+// passed tells if the entry at offset is in one of the passed ranges
+func (s *ResumeState) passed(offset uint64) bool {
+	i := sort.Search(len(s.Passed), func(i int) bool {
+		return s.Passed[i].End > offset
+	})
+	return i < len(s.Passed) && s.Passed[i].Start <= offset
+}
+
+// pass adds r to the passed ranges, merging it with its neighbours
+func (s *ResumeState) pass(r OffsetRange) {
+	i := sort.Search(len(s.Passed), func(i int) bool {
+		return s.Passed[i].End >= r.Start
+	})
+	j := i
+	for j < len(s.Passed) && s.Passed[j].Start <= r.End {
+		if s.Passed[j].Start < r.Start {
+			r.Start = s.Passed[j].Start
+		}
+		if s.Passed[j].End > r.End {
+			r.End = s.Passed[j].End
+		}
+		j++
+	}
+	s.Passed = append(s.Passed[:i], append([]OffsetRange{r}, s.Passed[j:]...)...)
+}
+
+// loadResumeState reads the state at path, a missing one or one of another
+// pack starts over
+func loadResumeState(path string, checksum string) (*ResumeState, error) {
+	fresh := &ResumeState{
+		Checksum: checksum,
+		Passed:   []OffsetRange{},
+		Failed:   []*finding.Finding{},
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &ResumeState{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("parse resume state %s: %w", path, err)
+	}
+	if state.Checksum != checksum {
+		return fresh, nil
+	}
+	return state, nil
+}
+
+func (s *ResumeState) save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := CreateTempFile(filepath.Dir(path), tmpResumePrefix)
+	if err != nil {
+		return err
+	}
+	defer tmp.Cleanup()
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return tmp.Commit(path)
+}
+
+// VerifyWindow verifies the entries of a pack, found through its idx, that
+// the state at statePath does not record as passed yet, entries which failed
+// before first. The header and trailer are checked against the idx before
+// any entry. With a budget the entries go by priority, see prioritize. It
+// stops once budget is spent, zero means no limit, though not before one
+// entry that did not fail before is verified, or once
+// WithMaxErrors more entries failed, and saves how far it got to statePath
+// for the next window, so that a huge pack can be verified over several
+// maintenance windows. The returned state covers the
+// whole pack once nothing remains and no entry failed, the error tells of the
+// failed ones. Like Sample, it fails if the tree, signature or text checks
+// are on.
+func VerifyWindow(packPath string, statePath string, budget time.Duration, opts ...Option) (*ResumeState, error) {
+	packFile, err := NewPackFile(packPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer packFile.Close()
+	if err := packFile.noContentChecks("a resumable verification"); err != nil {
+		return nil, err
+	}
+
+	err = packFile.ParseHeader()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := packFile.openIdx(packPath)
+	if err != nil {
+		return nil, err
+	}
+	defer idx.Close()
+	s, err := newSampler(packFile, idx)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadResumeState(statePath, hex.EncodeToString(idx.PackChecksum))
+	if err != nil {
+		return nil, err
+	}
+
+	retry := make(map[uint64]bool)
+	for _, f := range state.Failed {
+		retry[f.Offset] = true
+	}
+	var retries, fresh []*Object
+	for _, obj := range s.entries {
+		switch {
+		case retry[obj.offset]:
+			retries = append(retries, obj)
+		case !state.passed(obj.offset):
+			fresh = append(fresh, obj)
+		}
+	}
+	if len(retries) == 0 && len(fresh) == 0 {
+		// the last round is done, start the next one
+		state.Passed = state.Passed[:0]
+		fresh = append(fresh, s.entries...)
+	}
+	if budget > 0 {
+		s.prioritize(fresh)
+	}
+	todo := append(retries, fresh...)
+	// the budget is for verifying, the setup above does not count
+	deadline := time.Now().Add(budget)
+
+	failed := make(map[uint64]*finding.Finding)
+	for _, f := range state.Failed {
+		failed[f.Offset] = f
+	}
+	verified, errs, verifiedFresh := 0, 0, 0
+	for _, obj := range todo {
+		// however small the budget, a window gets past the entries failing
+		// since earlier ones, or the windows would never end
+		if budget > 0 && verifiedFresh > 0 && time.Now().After(deadline) {
+			break
+		}
+		if packFile.maxErrors > 0 && errs >= packFile.maxErrors {
+			log.Printf(catalog.Format(catalog.MaxErrors), errs)
+			break
+		}
+		packFile.idle.yield()
+		if err := s.verify(obj); err != nil {
+			err = packFile.checkChanged(err)
+			if errors.Is(err, ErrPackChanged) {
+				return nil, err
+			}
+			failed[obj.offset] = AsFinding(err).WithOid(idx.Oid(obj.index)).WithOffset(obj.offset)
+			if !retry[obj.offset] {
+				// entries still failing since an earlier window do not
+				// count, or a window might never get past them
+				errs++
+			}
+		} else {
+			delete(failed, obj.offset)
+			state.pass(OffsetRange{Start: obj.offset, End: obj.offset + obj.packedSize})
+		}
+		if !retry[obj.offset] {
+			verifiedFresh++
+		}
+		verified++
+	}
+	if err := packFile.CheckUnchanged(); err != nil {
+		return nil, err
+	}
+
+	state.Failed = state.Failed[:0]
+	for _, obj := range s.entries {
+		if f := failed[obj.offset]; f != nil {
+			state.Failed = append(state.Failed, f)
+		}
+	}
+	state.Remaining = len(todo) - verified
+	if err := state.save(statePath); err != nil {
+		return nil, err
+	}
+	log.Printf(catalog.Format(catalog.ResumeWindow), verified, len(s.entries), len(state.Failed), state.Remaining)
+
+	if len(state.Failed) > 0 {
+		first := state.Failed[0]
+		return state, fmt.Errorf("%d entries failed, first at offset %d: %w", len(state.Failed), first.Offset, first)
+	}
+	return state, nil
+}
+
+// Priorities of the entries in a window with a budget, the lowest goes first
+const (
+	priorityBroken = iota
+	priorityStructure
+	priorityBlob
+	priorityRest
+)
+
+// prioritize orders entries for a window with a budget, so that one cut
+// short still checked what matters most: entries whose headers do not even
+// parse, then the commits and trees everything else hangs off, then the
+// blobs with the most bytes of the pack first, then the rest. The types of
+// deltas come from the headers down their chains, nothing is inflated.
+func (s *sampler) prioritize(entries []*Object) {
+	priorities := make(map[*Object]int, len(entries))
+	for _, obj := range entries {
+		_type, err := s.realType(obj, 0)
+		switch {
+		case err != nil:
+			priorities[obj] = priorityBroken
+		case _type == ObjCommit || _type == ObjTree:
+			priorities[obj] = priorityStructure
+		case _type == ObjBlob:
+			priorities[obj] = priorityBlob
+		default:
+			priorities[obj] = priorityRest
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if priorities[a] != priorities[b] {
+			return priorities[a] < priorities[b]
+		}
+		return priorities[a] == priorityBlob && a.packedSize > b.packedSize
+	})
+}
@@ -0,0 +1,26 @@
+package pack
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyWindowTinyBudget(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	remaining := -1
+	for window := 0; ; window++ {
+		// a budget spent before the first entry still verifies one
+		state, err := VerifyWindow("testdata/producer-git.pack", statePath, time.Nanosecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if remaining >= 0 && state.Remaining >= remaining {
+			t.Fatalf("window %d left %d entries, the one before %d", window, state.Remaining, remaining)
+		}
+		if state.Remaining == 0 {
+			return
+		}
+		remaining = state.Remaining
+	}
+}
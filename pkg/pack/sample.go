@@ -0,0 +1,292 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/delta"
+	"github.com/adlternative/git-miner/pkg/oid"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxSampleDepth bounds the delta chains followed to resolve a sampled entry
+const maxSampleDepth = 10000
+
+// maxEntryHeaderSize is the longest entry header: a 64-bit size and the base
+// of a ref-delta
+var maxEntryHeaderSize = 10 + hashSize
+
+// sampler checks single entries found through the idx, without scanning the
+// pack from the start
+type sampler struct {
+	pf  *PackFile
+	idx *Idx
+	// entries are in pack order, with the idx position in index
+	entries  []*Object
+	byOffset map[uint64]*Object
+}
+
+// Sample checks the header and trailer of a pack against its idx and fully
+// verifies a random percent of its entries, picked by seed. It is a quick
+// probabilistic check, entries outside the sample are not read at all. It
+// does not run the tree, signature and text checks and fails if they are on.
+func Sample(packPath string, percent float64, seed int64, opts ...Option) error {
+	packFile, err := NewPackFile(packPath, opts...)
+	if err != nil {
+		return err
+	}
+	defer packFile.Close()
+	if err := packFile.noContentChecks("sampling"); err != nil {
+		return err
+	}
+	if packFile.dropCache {
+		defer func() {
+			if err := packFile.DropCache(); err != nil {
+				log.Printf(catalog.Format(catalog.DropCacheError), packPath, err)
+			}
+		}()
+	}
+
+	err = packFile.ParseHeader()
+	if err != nil {
+		return err
+	}
+	idx, err := packFile.openIdx(packPath)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+	s, err := newSampler(packFile, idx)
+	if err != nil {
+		return err
+	}
+
+	count := int(math.Ceil(float64(len(s.entries)) * percent / 100))
+	if count > len(s.entries) {
+		count = len(s.entries)
+	}
+	picked := rand.New(rand.NewSource(seed)).Perm(len(s.entries))[:count]
+	// read in pack order
+	sort.Ints(picked)
+	for _, i := range picked {
+		if err := s.verify(s.entries[i]); err != nil {
+			return packFile.checkChanged(fmt.Errorf("object %x at offset %d: %w", idx.Oid(s.entries[i].index), s.entries[i].offset, err))
+		}
+	}
+	log.Printf(catalog.Format(catalog.Sampled), count, len(s.entries), seed)
+	return packFile.CheckUnchanged()
+}
+
+// noContentChecks fails for the tree, signature and text checks, which a
+// verification through the idx, like the one named by what, does not run
+func (pf *PackFile) noContentChecks(what string) error {
+	if pf.checkTrees || pf.checkSignatures || pf.checkText {
+		return fmt.Errorf("%s does not run the tree, signature and text checks, verify the whole pack for them", what)
+	}
+	return nil
+}
+
+func newSampler(pf *PackFile, idx *Idx) (*sampler, error) {
+	if idx.ObjectCount != pf.objectNums {
+		return nil, fmt.Errorf("pack has %d objects but its idx %d", pf.objectNums, idx.ObjectCount)
+	}
+	stat, err := pf.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() < int64(headerSize+hashSize) {
+		return nil, fmt.Errorf("pack is too small for a trailer")
+	}
+	end := uint64(stat.Size()) - uint64(hashSize)
+	trailer := make([]byte, hashSize)
+	if _, err := pf.file.ReadAt(trailer, int64(end)); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(trailer, idx.PackChecksum) {
+		return nil, fmt.Errorf("pack checksum %x does not match %x in its idx", trailer, idx.PackChecksum)
+	}
+
+	entries, err := idxEntries(idx, end)
+	if err != nil {
+		return nil, err
+	}
+	s := &sampler{
+		pf:       pf,
+		idx:      idx,
+		entries:  entries,
+		byOffset: make(map[uint64]*Object, len(entries)),
+	}
+	for _, obj := range entries {
+		s.byOffset[obj.offset] = obj
+	}
+	return s, nil
+}
+
+// idxEntries lists the entries of the idx in pack order, with their idx
+// position in index. end is where the trailer of the pack starts, the last
+// entry ends there.
+func idxEntries(idx *Idx, end uint64) ([]*Object, error) {
+	entries := make([]*Object, 0, idx.ObjectCount)
+	for i := uint32(0); i < idx.ObjectCount; i++ {
+		offset, err := idx.Offset(i)
+		if err != nil {
+			return nil, err
+		}
+		if offset < headerSize || offset >= end {
+			return nil, fmt.Errorf("idx object %d has offset %d outside of the pack", i, offset)
+		}
+		entries = append(entries, &Object{
+			index:  i,
+			offset: offset,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].offset < entries[j].offset
+	})
+	for i, obj := range entries {
+		if i+1 < len(entries) {
+			if entries[i+1].offset == obj.offset {
+				return nil, fmt.Errorf("idx has objects sharing offset %d", obj.offset)
+			}
+			obj.packedSize = entries[i+1].offset - obj.offset
+		} else {
+			obj.packedSize = end - obj.offset
+		}
+	}
+	return entries, nil
+}
+
+// readHeader parses the entry header of obj and returns a reader positioned
+// at its data
+func (s *sampler) readHeader(obj *Object) (*entryReader, error) {
+	in := newEntryReader(s.pf.file, obj)
+	length := uint64(maxEntryHeaderSize)
+	if length > obj.packedSize {
+		length = obj.packedSize
+	}
+	buf, err := in.Fill(length)
+	if err != nil {
+		return nil, err
+	}
+	header, n, err := ParseEntryHeader(buf[:length])
+	if err != nil {
+		return nil, err
+	}
+	in.Use(uint64(n))
+	obj.ObjectHeader = header
+	obj.dataOffset = obj.offset + uint64(n)
+	return in, nil
+}
+
+// base returns the entry obj is a delta against
+func (s *sampler) base(obj *Object) (*Object, error) {
+	if obj._type == ObjRefDelta {
+		i, ok := s.idx.Find(obj.baseOid)
+		if !ok {
+			return nil, fmt.Errorf("%w: delta base %x is not in the pack", ErrObjectNotFound, obj.baseOid)
+		}
+		offset, err := s.idx.Offset(i)
+		if err != nil {
+			return nil, err
+		}
+		return s.byOffset[offset], nil
+	}
+	if obj.baseDistance >= obj.offset {
+		return nil, fmt.Errorf("delta base offset is out of bound: curOffset=%d, baseOffet=%d", obj.offset, obj.baseDistance)
+	}
+	base, ok := s.byOffset[obj.offset-obj.baseDistance]
+	if !ok {
+		return nil, fmt.Errorf("delta base offset %d is not an object", obj.offset-obj.baseDistance)
+	}
+	return base, nil
+}
+
+// realType returns the type obj resolves to, reading only the entry headers
+// down its delta chain
+func (s *sampler) realType(obj *Object, depth int) (ObjectType, error) {
+	if obj.realType != ObjNone {
+		return obj.realType, nil
+	}
+	if depth > maxSampleDepth {
+		return ObjNone, fmt.Errorf("delta chain is longer than %d", maxSampleDepth)
+	}
+	if _, err := s.readHeader(obj); err != nil {
+		return ObjNone, err
+	}
+	if !obj._type.IsDelta() {
+		obj.realType = obj._type
+		return obj.realType, nil
+	}
+	base, err := s.base(obj)
+	if err != nil {
+		return ObjNone, err
+	}
+	obj.realType, err = s.realType(base, depth+1)
+	return obj.realType, err
+}
+
+// unpack returns the type and content of the object in obj, resolving
+// deltas down to their root
+func (s *sampler) unpack(obj *Object, depth int) (ObjectType, []byte, error) {
+	if depth > maxSampleDepth {
+		return ObjNone, nil, fmt.Errorf("delta chain is longer than %d", maxSampleDepth)
+	}
+	in, err := s.readHeader(obj)
+	if err != nil {
+		return ObjNone, nil, err
+	}
+	data, err := unpackEntryData(s.pf.inflater, in, obj.size)
+	if err != nil {
+		return ObjNone, nil, err
+	}
+	obj.crc32 = in.crc.Sum32()
+	if !obj._type.IsDelta() {
+		return obj._type, data, nil
+	}
+
+	base, err := s.base(obj)
+	if err != nil {
+		return ObjNone, nil, err
+	}
+	realType, baseData, err := s.unpack(base, depth+1)
+	if err != nil {
+		return ObjNone, nil, err
+	}
+	data, err = delta.Apply(baseData, data)
+	return realType, data, err
+}
+
+// verify checks the crc32 and object id of obj against the idx
+func (s *sampler) verify(obj *Object) error {
+	var id oid.Oid
+	in, err := s.readHeader(obj)
+	if err != nil {
+		return err
+	}
+	if !obj._type.IsDelta() {
+		hasher := newObjectHasher(obj._type, obj.size)
+		if err := s.pf.inflater.Inflate(in, obj.size, hasher); err != nil {
+			return err
+		}
+		obj.crc32 = in.crc.Sum32()
+		id = oid.Sum(hasher)
+	} else {
+		realType, data, err := s.unpack(obj, 0)
+		if err != nil {
+			return err
+		}
+		id = HashObject(realType, data)
+	}
+
+	if crc, ok := s.idx.CRC32(obj.index); ok && crc != obj.crc32 {
+		return fmt.Errorf("crc32 %08x does not match %08x in the idx", obj.crc32, crc)
+	}
+	if id != s.idx.Oid(obj.index) {
+		return fmt.Errorf("object hashes to %s", id)
+	}
+	return nil
+}
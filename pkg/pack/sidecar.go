@@ -0,0 +1,299 @@
+//go:build !nowriter
+
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/bitmap"
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/object"
+	"github.com/adlternative/git-miner/pkg/oid"
+	log "github.com/sirupsen/logrus"
+)
+
+// bitmapCommitInterval is how many commits in pack order get a bitmap
+// between two selected ones, besides the tips which always get one
+const bitmapCommitInterval = 100
+
+// writeSidecars writes the idx and rev of a verified pack if they are
+// missing, and its bitmap with WithWriteMissing's bitmap. The idx goes in
+// last, like git, so that the pack is only picked up with its other sidecars
+// in place.
+func (pf *PackFile) writeSidecars(packPath string) error {
+	if len(pf.externalBases) > 0 {
+		return fmt.Errorf("a thin pack cannot be served, not writing its sidecars")
+	}
+	base := strings.TrimSuffix(packPath, ".pack")
+	missing := func(ext string) bool {
+		_, err := os.Stat(base + ext)
+		return errors.Is(err, fs.ErrNotExist)
+	}
+
+	entries := make([]*WriterEntry, len(pf.objects))
+	for i, obj := range pf.objects {
+		entries[i] = &WriterEntry{
+			Oid:    obj.oid,
+			Offset: obj.offset,
+			CRC32:  obj.crc32,
+		}
+	}
+	var idx bytes.Buffer
+	if err := writeIdx(&idx, entries, pf.checksum); err != nil {
+		return err
+	}
+
+	if missing(".rev") {
+		if err := writeSidecar(base+".rev", TmpRevPrefix, pf.revIndex()); err != nil {
+			return err
+		}
+	}
+	if pf.writeBitmap && missing(".bitmap") {
+		data, err := pf.bitmapIndex(packPath, idx.Bytes())
+		if err != nil {
+			return fmt.Errorf("cannot write the bitmap: %w", err)
+		}
+		if err := writeSidecar(base+".bitmap", TmpBitmapPrefix, data); err != nil {
+			return err
+		}
+	}
+	if missing(".idx") {
+		if err := writeSidecar(base+".idx", TmpIdxPrefix, idx.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSidecar(path string, prefix string, data []byte) error {
+	tmp, err := CreateTempFile(filepath.Dir(path), prefix)
+	if err != nil {
+		return err
+	}
+	defer tmp.Cleanup()
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Commit(path); err != nil {
+		return err
+	}
+	log.Printf(catalog.Format(catalog.SidecarWritten), path)
+	return nil
+}
+
+// idxOrder returns the positions of the objects of the pack in idx order
+func (pf *PackFile) idxOrder() []uint32 {
+	order := make([]uint32, len(pf.objects))
+	for i := range order {
+		order[i] = uint32(i)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return pf.objects[order[i]].oid.Compare(pf.objects[order[j]].oid) < 0
+	})
+	return order
+}
+
+// revIndex returns the .rev file of the pack: the idx position of each
+// object, in pack order
+func (pf *PackFile) revIndex() []byte {
+	buf := make([]byte, revHeaderSize, revHeaderSize+len(pf.objects)*4+2*hashSize)
+	binary.BigEndian.PutUint32(buf[0:4], revSignature)
+	binary.BigEndian.PutUint32(buf[4:8], 1)
+	binary.BigEndian.PutUint32(buf[8:12], hashID())
+
+	positions := make([]uint32, len(pf.objects))
+	for idxPos, packPos := range pf.idxOrder() {
+		positions[packPos] = uint32(idxPos)
+	}
+	for _, idxPos := range positions {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], idxPos)
+		buf = append(buf, b[:]...)
+	}
+	buf = append(buf, pf.checksum...)
+	return append(buf, fileChecksum(buf)...)
+}
+
+// bitmapBuilder walks the objects of a pack to build its reachability
+// bitmaps, positions are in pack order
+type bitmapBuilder struct {
+	pf       *PackFile
+	source   *PackObjectSource
+	position map[oid.Oid]uint32
+	// links are the objects a commit or tree points to, once read
+	links map[uint32][]uint32
+}
+
+// bitmapIndex returns the .bitmap file of the pack, given the contents of
+// its idx. Every object reachable from a commit of the pack must be in it.
+func (pf *PackFile) bitmapIndex(packPath string, idxData []byte) ([]byte, error) {
+	idx, err := ParseIdx(idxData)
+	if err != nil {
+		return nil, err
+	}
+	packFile, err := NewPackFile(packPath)
+	if err != nil {
+		return nil, err
+	}
+	defer packFile.Close()
+	if err := packFile.ParseHeader(); err != nil {
+		return nil, err
+	}
+	s, err := newSampler(packFile, idx)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bitmapBuilder{
+		pf:       pf,
+		source:   &PackObjectSource{s: s},
+		position: make(map[oid.Oid]uint32, len(pf.objects)),
+		links:    make(map[uint32][]uint32),
+	}
+	types := make(map[ObjectType]*bitmap.Bitmap)
+	for _, _type := range []ObjectType{ObjCommit, ObjTree, ObjBlob, ObjTag} {
+		types[_type] = &bitmap.Bitmap{}
+	}
+	for i, obj := range pf.objects {
+		b.position[obj.oid] = uint32(i)
+		types[obj.realType].Set(uint32(i))
+	}
+
+	selected, err := b.selectCommits()
+	if err != nil {
+		return nil, err
+	}
+	idxPos := make([]uint32, len(pf.objects))
+	for i, packPos := range pf.idxOrder() {
+		idxPos[packPos] = uint32(i)
+	}
+	var entries []*bitmap.Entry
+	for _, pos := range selected {
+		reachable, err := b.reachable(pos)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &bitmap.Entry{
+			ObjectPos: idxPos[pos],
+			Bitmap:    reachable,
+		})
+	}
+
+	var buf bytes.Buffer
+	err = bitmap.Write(&buf, pf.checksum, uint32(len(pf.objects)),
+		types[ObjCommit], types[ObjTree], types[ObjBlob], types[ObjTag], entries)
+	return buf.Bytes(), err
+}
+
+// selectCommits picks the commits to give a bitmap: the tips, which no other
+// commit of the pack has as a parent, and every bitmapCommitInterval-th one
+func (b *bitmapBuilder) selectCommits() ([]uint32, error) {
+	var commits []uint32
+	parents := make(map[uint32]bool)
+	for i, obj := range b.pf.objects {
+		if obj.realType != ObjCommit {
+			continue
+		}
+		links, err := b.linksOf(uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		for _, pos := range links {
+			if b.pf.objects[pos].realType == ObjCommit {
+				parents[pos] = true
+			}
+		}
+		commits = append(commits, uint32(i))
+	}
+
+	var selected []uint32
+	for i, pos := range commits {
+		if !parents[pos] || i%bitmapCommitInterval == 0 {
+			selected = append(selected, pos)
+		}
+	}
+	return selected, nil
+}
+
+// reachable returns the objects reachable from the commit at pos, itself
+// included
+func (b *bitmapBuilder) reachable(pos uint32) (*bitmap.Bitmap, error) {
+	seen := &bitmap.Bitmap{}
+	seen.Set(pos)
+	stack := []uint32{pos}
+	for len(stack) > 0 {
+		pos := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		links, err := b.linksOf(pos)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			if !seen.Get(link) {
+				seen.Set(link)
+				stack = append(stack, link)
+			}
+		}
+	}
+	return seen, nil
+}
+
+// linksOf returns the tree and parents of the commit at pos, or the entries
+// of the tree at pos
+func (b *bitmapBuilder) linksOf(pos uint32) ([]uint32, error) {
+	if links, ok := b.links[pos]; ok {
+		return links, nil
+	}
+	obj := b.pf.objects[pos]
+	if obj.realType != ObjCommit && obj.realType != ObjTree {
+		return nil, nil
+	}
+	_, data, err := b.source.ReadObjectAt(obj.offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []oid.Oid
+	if obj.realType == ObjCommit {
+		commit, err := object.ParseCommit(data)
+		if err != nil {
+			return nil, fmt.Errorf("commit %s: %w", obj.oid, err)
+		}
+		for _, value := range append(commit.Get("tree"), commit.Get("parent")...) {
+			id, err := oid.FromHex(value)
+			if err != nil {
+				return nil, fmt.Errorf("commit %s: %w", obj.oid, err)
+			}
+			ids = append(ids, id)
+		}
+	} else {
+		entries, err := object.ParseTree(data)
+		if err != nil {
+			return nil, fmt.Errorf("tree %s: %w", obj.oid, err)
+		}
+		for _, entry := range entries {
+			if entry.Mode != gitlinkMode {
+				ids = append(ids, entry.Oid)
+			}
+		}
+	}
+
+	links := make([]uint32, 0, len(ids))
+	for _, id := range ids {
+		link, ok := b.position[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s, referred to by %s, is not in the pack", ErrObjectNotFound, id, obj.oid)
+		}
+		links = append(links, link)
+	}
+	b.links[pos] = links
+	return links, nil
+}
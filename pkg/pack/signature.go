@@ -0,0 +1,207 @@
+package pack
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/adlternative/git-miner/pkg/finding"
+	"github.com/adlternative/git-miner/pkg/object"
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+var ErrUnsigned = errors.New("not signed")
+
+// CodeBadSignature is the finding code of a signature with broken framing
+const CodeBadSignature = "bad-signature"
+
+// SignatureCounts counts the signed and unsigned commits and tags of a pack.
+// Signatures are only checked for their framing, not verified.
+type SignatureCounts struct {
+	SignedCommits   uint64 `json:"signedCommits"`
+	UnsignedCommits uint64 `json:"unsignedCommits"`
+	SignedTags      uint64 `json:"signedTags"`
+	UnsignedTags    uint64 `json:"unsignedTags"`
+	// Formats counts the signatures by format, an object may have several
+	Formats map[string]uint64 `json:"formats,omitempty"`
+	// Malformed counts the signatures with broken framing
+	Malformed uint64 `json:"malformed,omitempty"`
+}
+
+// WithSignatureChecks counts the signed commits and tags and checks the
+// framing of their signatures, reporting a warning finding for each broken
+// one. Commits and tags of the big file threshold or larger are left out.
+func WithSignatureChecks(check bool) Option {
+	return func(pf *PackFile) {
+		pf.checkSignatures = check
+	}
+}
+
+// signatureChecker looks at the signatures of the commits and tags of a pack
+// while they resolve
+type signatureChecker struct {
+	mu       sync.Mutex
+	counts   SignatureCounts
+	findings []*finding.Finding
+}
+
+func newSignatureChecker() *signatureChecker {
+	return &signatureChecker{
+		counts: SignatureCounts{
+			Formats: make(map[string]uint64),
+		},
+	}
+}
+
+// check looks at a resolved object, data is nil for a streamed one
+func (c *signatureChecker) check(obj *Object, data []byte) {
+	if data == nil || (obj.realType != ObjCommit && obj.realType != ObjTag) {
+		return
+	}
+	// a commit that does not parse is no concern of the signature checks
+	commit, err := object.ParseCommit(data)
+	if err != nil {
+		return
+	}
+	signatures := commit.Signatures()
+	if obj.realType == ObjTag {
+		if s := commit.MessageSignature(); s != nil {
+			signatures = append(signatures, s)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case obj.realType == ObjCommit && len(signatures) > 0:
+		c.counts.SignedCommits++
+	case obj.realType == ObjCommit:
+		c.counts.UnsignedCommits++
+	case len(signatures) > 0:
+		c.counts.SignedTags++
+	default:
+		c.counts.UnsignedTags++
+	}
+	for _, s := range signatures {
+		if s.Format != "" {
+			c.counts.Formats[s.Format]++
+		}
+		if err := s.Check(); err != nil {
+			c.counts.Malformed++
+			where := "message"
+			if s.Header != "" {
+				where = s.Header + " header"
+			}
+			c.findings = append(c.findings, finding.New(finding.Warning, CodeBadSignature,
+				"%s signature in the %s: %v", obj.realType.ContentType(), where, err).WithOid(obj.oid).WithOffset(obj.offset))
+		}
+	}
+}
+
+// done returns the findings in pack order, so that they are the same for
+// any thread count
+func (c *signatureChecker) done() []*finding.Finding {
+	sort.SliceStable(c.findings, func(i, j int) bool {
+		return c.findings[i].Offset < c.findings[j].Offset
+	})
+	return c.findings
+}
+
+// Signatures returns the signature counts of the pack once resolved with
+// WithSignatureChecks, nil otherwise
+func (pf *PackFile) Signatures() *SignatureCounts {
+	return pf.signatures
+}
+
+// SignatureVerifier checks the signatures of the commits and tags of a pack
+// cryptographically, e.g. with gpg or ssh-keygen -Y verify. format is
+// "openpgp", "x509" or "ssh", payload is what signature signs. It is called
+// from several goroutines at once.
+type SignatureVerifier interface {
+	VerifySignature(id oid.Oid, format string, payload []byte, signature string) error
+}
+
+// SignatureVerifierFunc adapts a function to SignatureVerifier
+type SignatureVerifierFunc func(id oid.Oid, format string, payload []byte, signature string) error
+
+func (f SignatureVerifierFunc) VerifySignature(id oid.Oid, format string, payload []byte, signature string) error {
+	return f(id, format, payload, signature)
+}
+
+// WithSignatureVerifier rejects the commits and tags whose signatures
+// verifier does not accept, and with requireSigned those without any, so
+// that policies like "every pushed commit must be signed" keep the pack from
+// being finalized like a Veto does. Tags only need a signature when signed
+// tags are required as well.
+func WithSignatureVerifier(verifier SignatureVerifier, requireSigned bool, requireSignedTags bool) Option {
+	return func(pf *PackFile) {
+		pf.verifier = verifier
+		pf.requireSigned = requireSigned
+		pf.requireSignedTags = requireSignedTags
+	}
+}
+
+// verifySignatures runs the SignatureVerifier of the pack on a resolved
+// commit or tag, data is nil for a streamed one
+func (r *resolver) verifySignatures(obj *Object, data []byte) {
+	if r.pf.verifier == nil || (obj.realType != ObjCommit && obj.realType != ObjTag) {
+		return
+	}
+	if reason := r.pf.signatureRejection(obj, data); reason != nil && r.rejections[obj.index] == nil {
+		r.rejections[obj.index] = &Rejection{
+			Oid:    obj.oid,
+			Offset: obj.offset,
+			Reason: reason,
+		}
+	}
+}
+
+// signatureRejection returns why the signatures of a commit or tag are not
+// accepted, or nil. Like git, only the signatures over the object as hashed
+// with oidAlgorithm are verified: the one at the end of a tag message and
+// the one in the header of oidAlgorithm. The other header signs the object
+// converted to the other hash, which the payload does not give.
+func (pf *PackFile) signatureRejection(obj *Object, data []byte) error {
+	required := pf.requireSigned
+	if obj.realType == ObjTag {
+		required = pf.requireSignedTags
+	}
+	if data == nil {
+		if required {
+			return fmt.Errorf("%s is too big to check its signature", obj.realType.ContentType())
+		}
+		return nil
+	}
+	commit, err := object.ParseCommit(data)
+	if err != nil {
+		return err
+	}
+	var signatures []*object.Signature
+	header := object.SignatureHeader(oidAlgorithm)
+	for _, s := range commit.Signatures() {
+		if s.Header == header {
+			signatures = append(signatures, s)
+		}
+	}
+	if obj.realType == ObjTag {
+		if s := commit.MessageSignature(); s != nil {
+			signatures = append(signatures, s)
+		}
+	}
+	if len(signatures) == 0 {
+		if required {
+			return ErrUnsigned
+		}
+		return nil
+	}
+	for _, s := range signatures {
+		if err := s.Check(); err != nil {
+			return err
+		}
+		if err := pf.verifier.VerifySignature(obj.oid, s.Format, s.Payload(data), s.Armor); err != nil {
+			return fmt.Errorf("bad %s signature: %w", s.Format, err)
+		}
+	}
+	return nil
+}
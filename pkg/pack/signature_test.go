@@ -0,0 +1,50 @@
+package pack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+// dualSigned is a commit signed over its SHA-1 form in gpgsig and over its
+// SHA-256 form in gpgsig-sha256, as git writes with both hashes
+const dualSigned = "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+	"author A U Thor <author@example.com> 1112912053 -0700\n" +
+	"committer C O Mitter <committer@example.com> 1112912053 -0700\n" +
+	"gpgsig -----BEGIN SSH SIGNATURE-----\n" +
+	" U1NIU0lHAQ==\n" +
+	" -----END SSH SIGNATURE-----\n" +
+	"gpgsig-sha256 -----BEGIN SSH SIGNATURE-----\n" +
+	" U1NIU0lHAg==\n" +
+	" -----END SSH SIGNATURE-----\n" +
+	"\n" +
+	"signed with both hashes\n"
+
+const dualSignedPayload = "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+	"author A U Thor <author@example.com> 1112912053 -0700\n" +
+	"committer C O Mitter <committer@example.com> 1112912053 -0700\n" +
+	"\n" +
+	"signed with both hashes\n"
+
+func TestSignatureRejectionDualSigned(t *testing.T) {
+	var verified []string
+	verifier := SignatureVerifierFunc(func(id oid.Oid, format string, payload []byte, signature string) error {
+		verified = append(verified, signature)
+		if string(payload) != dualSignedPayload {
+			t.Errorf("payload = %q, want %q", payload, dualSignedPayload)
+		}
+		// only the SHA-1 signature is over this payload
+		if signature != "-----BEGIN SSH SIGNATURE-----\nU1NIU0lHAQ==\n-----END SSH SIGNATURE-----" {
+			return errors.New("signature does not match")
+		}
+		return nil
+	})
+	pf := &PackFile{verifier: verifier, requireSigned: true}
+	if err := pf.signatureRejection(&Object{realType: ObjCommit}, []byte(dualSigned)); err != nil {
+		t.Errorf("signatureRejection = %v, want nil", err)
+	}
+	if len(verified) != 1 {
+		t.Errorf("verified %d signatures, want the gpgsig one only", len(verified))
+	}
+}
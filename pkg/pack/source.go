@@ -0,0 +1,101 @@
+package pack
+
+import (
+	"bufio"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"github.com/adlternative/git-miner/pkg/oid"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectSource looks up objects outside the pack, such as the ref-delta
+// bases a thin pack leaves out. It returns ErrObjectNotFound for objects it
+// does not have. The resolver calls ReadObject from all its threads at once,
+// so implementations must be safe for concurrent use.
+type ObjectSource interface {
+	ReadObject(id oid.Oid) (ObjectType, []byte, error)
+}
+
+// ObjectSourceFunc adapts a function to ObjectSource, the function must be
+// safe for concurrent use
+type ObjectSourceFunc func(id oid.Oid) (ObjectType, []byte, error)
+
+func (f ObjectSourceFunc) ReadObject(id oid.Oid) (ObjectType, []byte, error) {
+	return f(id)
+}
+
+// LooseObjectSource reads loose objects from a .git/objects directory
+type LooseObjectSource struct {
+	dir string
+}
+
+func NewLooseObjectSource(objectsDir string) *LooseObjectSource {
+	return &LooseObjectSource{
+		dir: objectsDir,
+	}
+}
+
+// Contains tells whether the directory has a loose object, without reading it
+func (s *LooseObjectSource) Contains(id oid.Oid) bool {
+	name := id.String()
+	_, err := os.Stat(filepath.Join(s.dir, name[:2], name[2:]))
+	return err == nil
+}
+
+func (s *LooseObjectSource) ReadObject(id oid.Oid) (ObjectType, []byte, error) {
+	if id.Algorithm() != oidAlgorithm {
+		return ObjNone, nil, fmt.Errorf("invalid object id %q", id)
+	}
+	name := id.String()
+
+	file, err := os.Open(filepath.Join(s.dir, name[:2], name[2:]))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ObjNone, nil, fmt.Errorf("%w: %s", ErrObjectNotFound, name)
+		}
+		return ObjNone, nil, err
+	}
+	defer file.Close()
+
+	zr, err := zlib.NewReader(file)
+	if err != nil {
+		return ObjNone, nil, fmt.Errorf("loose object %s: %w", name, err)
+	}
+	defer zr.Close()
+
+	r := bufio.NewReader(zr)
+	typeName, err := r.ReadString(' ')
+	if err != nil {
+		return ObjNone, nil, fmt.Errorf("loose object %s has a bad header: %w", name, err)
+	}
+	_type, err := ParseContentType(typeName[:len(typeName)-1])
+	if err != nil {
+		return ObjNone, nil, fmt.Errorf("loose object %s: %w", name, err)
+	}
+	sizeStr, err := r.ReadString(0)
+	if err != nil {
+		return ObjNone, nil, fmt.Errorf("loose object %s has a bad header: %w", name, err)
+	}
+	size, err := strconv.ParseUint(sizeStr[:len(sizeStr)-1], 10, 63)
+	if err != nil {
+		return ObjNone, nil, fmt.Errorf("loose object %s has a bad size: %w", name, err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, int64(size)+1))
+	if err != nil {
+		return ObjNone, nil, fmt.Errorf("loose object %s: %w", name, err)
+	}
+	if uint64(len(data)) != size {
+		return ObjNone, nil, fmt.Errorf("loose object %s has %d bytes, expect %d", name, len(data), size)
+	}
+	if HashObject(_type, data) != id {
+		return ObjNone, nil, fmt.Errorf("loose object %s is corrupt", name)
+	}
+	return _type, data, nil
+}
@@ -0,0 +1,144 @@
+package pack
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefixes of the temporary files git (and our writers) leave in an object
+// directory while writing.
+const (
+	TmpPackPrefix   = "tmp_pack_"
+	TmpIdxPrefix    = "tmp_idx_"
+	TmpRevPrefix    = "tmp_rev_"
+	TmpBitmapPrefix = "tmp_bitmap_"
+	TmpObjPrefix    = "tmp_obj_"
+)
+
+var tmpPrefixes = []string{TmpPackPrefix, TmpIdxPrefix, TmpRevPrefix, TmpBitmapPrefix, TmpObjPrefix}
+
+// DefaultTempExpire is how old a temporary file must be before it is
+// considered stale, the same as git's gc.pruneExpire default.
+const DefaultTempExpire = 14 * 24 * time.Hour
+
+var (
+	tempFilesLock sync.Mutex
+	tempFiles     = make(map[*TempFile]struct{})
+)
+
+// TempFile is a uniquely named file which is renamed into place by Commit.
+// Until then it is registered so that RemoveTempFiles can clean it up when
+// the process fails or is interrupted.
+type TempFile struct {
+	*os.File
+	done bool
+}
+
+// CreateTempFile creates dir/<prefix>XXXXXX
+func CreateTempFile(dir, prefix string) (*TempFile, error) {
+	file, err := os.CreateTemp(dir, prefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	t := &TempFile{File: file}
+
+	tempFilesLock.Lock()
+	tempFiles[t] = struct{}{}
+	tempFilesLock.Unlock()
+	return t, nil
+}
+
+func (t *TempFile) unregister() {
+	t.done = true
+	tempFilesLock.Lock()
+	delete(tempFiles, t)
+	tempFilesLock.Unlock()
+}
+
+// committedMode is the mode of committed files, read-only like git writes
+// packs and their sidecars, before the umask. os.CreateTemp makes them 0600,
+// which a git daemon running as another user could not read.
+const committedMode = 0444
+
+// Commit flushes the file to disk and renames it to path, readable by anyone
+// the umask allows
+func (t *TempFile) Commit(path string) error {
+	if err := t.Chmod(committedMode &^ processUmask); err != nil {
+		return err
+	}
+	if err := t.Sync(); err != nil {
+		return err
+	}
+	if err := t.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(t.Name(), path); err != nil {
+		return err
+	}
+	t.unregister()
+	return nil
+}
+
+// Cleanup removes the file unless it was committed, it is meant to be deferred
+func (t *TempFile) Cleanup() {
+	if t.done {
+		return
+	}
+	t.Close()
+	os.Remove(t.Name())
+	t.unregister()
+}
+
+// RemoveTempFiles removes every temporary file not committed yet, for use on
+// fatal errors and signals.
+func RemoveTempFiles() {
+	tempFilesLock.Lock()
+	defer tempFilesLock.Unlock()
+	for t := range tempFiles {
+		t.Close()
+		os.Remove(t.Name())
+		t.done = true
+	}
+	tempFiles = make(map[*TempFile]struct{})
+}
+
+func isTempName(name string) bool {
+	for _, prefix := range tmpPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindStaleTempFiles walks dir for temporary files which were last modified
+// longer than expire ago.
+func FindStaleTempFiles(dir string, expire time.Duration) ([]string, error) {
+	var stale []string
+	deadline := time.Now().Add(-expire)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isTempName(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(deadline) {
+			stale = append(stale, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stale, nil
+}
@@ -0,0 +1,121 @@
+package pack
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/adlternative/git-miner/pkg/finding"
+	"github.com/adlternative/git-miner/pkg/object"
+)
+
+// Finding codes of the text checks
+const (
+	CodeBadEncoding      = "bad-encoding"
+	CodeNulInMessage     = "nul-in-message"
+	CodeControlCharacter = "control-character"
+)
+
+// WithTextChecks checks the messages of commits and tags and the names of
+// tree entries for hosting hygiene: messages must be valid UTF-8 unless an
+// encoding header says otherwise and hold no NUL, names must be valid UTF-8,
+// and neither may hold control characters that fool terminals and editors,
+// like escapes or bidi overrides. What is wrong is reported as a warning
+// finding, WithSeverities can make it an error or ignore it.
+func WithTextChecks(check bool) Option {
+	return func(pf *PackFile) {
+		pf.checkText = check
+	}
+}
+
+// textChecker checks the text of the objects of a pack while they resolve
+type textChecker struct {
+	mu       sync.Mutex
+	findings []*finding.Finding
+}
+
+// dangerousRune returns the first control character of text which can be
+// used to hide or disguise text, if any. NUL is left to the caller. In a
+// message tabs, newlines and the carriage returns of CRLF line ends are
+// fine.
+func dangerousRune(text []byte, message bool) (rune, bool) {
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRune(text[i:])
+		i += size
+		switch {
+		case r == 0 || r == utf8.RuneError:
+		case message && (r == '\t' || r == '\n' || r == '\r' && i < len(text) && text[i] == '\n'):
+		case r < 0x20, r >= 0x7f && r <= 0x9f:
+			return r, true
+		case r >= 0x202a && r <= 0x202e, r >= 0x2066 && r <= 0x2069:
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// isUTF8 tells whether the encoding header of a commit or tag says its
+// message is UTF-8, which is what no header means
+func isUTF8(commit *object.Commit) bool {
+	encoding := commit.Get("encoding")
+	if len(encoding) == 0 {
+		return true
+	}
+	name := strings.ToLower(encoding[0])
+	return name == "utf-8" || name == "utf8"
+}
+
+func (c *textChecker) add(obj *Object, code string, format string, a ...interface{}) {
+	c.mu.Lock()
+	c.findings = append(c.findings, finding.New(finding.Warning, code, format, a...).WithOid(obj.oid).WithOffset(obj.offset))
+	c.mu.Unlock()
+}
+
+// check looks at a resolved object, data is nil for a streamed one
+func (c *textChecker) check(obj *Object, data []byte) {
+	if data == nil {
+		return
+	}
+	switch obj.realType {
+	case ObjCommit, ObjTag:
+		// a commit that does not parse is no concern of the text checks
+		commit, err := object.ParseCommit(data)
+		if err != nil {
+			return
+		}
+		_type := obj.realType.ContentType()
+		if nul := bytes.IndexByte(commit.Message, 0); nul >= 0 {
+			c.add(obj, CodeNulInMessage, "%s message has a NUL at byte %d", _type, nul)
+		}
+		if isUTF8(commit) && !utf8.Valid(commit.Message) {
+			c.add(obj, CodeBadEncoding, "%s message is not valid UTF-8", _type)
+		}
+		if r, ok := dangerousRune(commit.Message, true); ok {
+			c.add(obj, CodeControlCharacter, "%s message has control character %U", _type, r)
+		}
+	case ObjTree:
+		entries, err := object.ParseTree(data)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			if !utf8.ValidString(entry.Name) {
+				c.add(obj, CodeBadEncoding, "entry %q is not valid UTF-8", entry.Name)
+			}
+			if r, ok := dangerousRune([]byte(entry.Name), false); ok {
+				c.add(obj, CodeControlCharacter, "entry %q has control character %U", entry.Name, r)
+			}
+		}
+	}
+}
+
+// done returns the findings in pack order, so that they are the same for
+// any thread count
+func (c *textChecker) done() []*finding.Finding {
+	sort.SliceStable(c.findings, func(i, j int) bool {
+		return c.findings[i].Offset < c.findings[j].Offset
+	})
+	return c.findings
+}
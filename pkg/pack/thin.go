@@ -0,0 +1,111 @@
+//go:build !nowriter
+
+package pack
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/catalog"
+	log "github.com/sirupsen/logrus"
+)
+
+// FixThin writes the pack with the external bases found by ResolveObjects
+// appended as non-delta objects, like git index-pack --fix-thin does. The
+// original entries are copied as they are and keep their offsets.
+func (pf *PackFile) FixThin(w io.Writer) (*Writer, error) {
+	pw, err := NewWriter(w, pf.objectNums+uint32(len(pf.externalBases)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range pf.objects {
+		raw := make([]byte, obj.packedSize)
+		if _, err := pf.file.ReadAt(raw, int64(obj.offset)); err != nil {
+			return nil, err
+		}
+		if _, err := pw.WriteRawEntry(raw, obj.oid); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, base := range pf.externalBases {
+		_type, data, err := pf.source.ReadObject(base.oid)
+		if err != nil {
+			return nil, fmt.Errorf("read thin pack base %x failed: %w", base.oid, err)
+		}
+		if _, err := pw.WriteObject(_type, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := pw.Close(); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// FixThin verifies a thin pack, looking up the missing bases with the
+// ObjectSource given in opts, and writes the completed pack to outPath and
+// its idx next to it. Nothing is written if a Veto given in opts rejects an
+// object.
+func FixThin(packPath string, outPath string, opts ...Option) error {
+	packFile, err := NewPackFile(packPath, opts...)
+	if err != nil {
+		return err
+	}
+	defer packFile.Close()
+
+	err = packFile.ParseHeader()
+	if err != nil {
+		return packFile.checkChanged(err)
+	}
+	err = packFile.ParseObjects()
+	if err != nil {
+		return packFile.checkChanged(err)
+	}
+	err = packFile.ResolveObjects()
+	if err != nil {
+		return packFile.checkChanged(err)
+	}
+
+	dir := filepath.Dir(outPath)
+	tmpPack, err := CreateTempFile(dir, TmpPackPrefix)
+	if err != nil {
+		return err
+	}
+	defer tmpPack.Cleanup()
+	pw, err := packFile.FixThin(tmpPack)
+	if err != nil {
+		return packFile.checkChanged(err)
+	}
+	err = packFile.CheckUnchanged()
+	if err != nil {
+		return err
+	}
+
+	tmpIdx, err := CreateTempFile(dir, TmpIdxPrefix)
+	if err != nil {
+		return err
+	}
+	defer tmpIdx.Cleanup()
+	err = pw.WriteIdx(tmpIdx)
+	if err != nil {
+		return err
+	}
+
+	// like git, the idx goes in last so it only ever points to a complete pack
+	err = tmpPack.Commit(outPath)
+	if err != nil {
+		return err
+	}
+	err = tmpIdx.Commit(strings.TrimSuffix(outPath, ".pack") + ".idx")
+	if err != nil {
+		return err
+	}
+
+	log.Printf(catalog.Format(catalog.ThinAppended), len(packFile.externalBases), outPath)
+	return nil
+}
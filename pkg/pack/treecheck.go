@@ -0,0 +1,198 @@
+package pack
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adlternative/git-miner/pkg/finding"
+	"github.com/adlternative/git-miner/pkg/object"
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+// Finding codes of the tree checks
+const (
+	CodeBadTree    = "bad-tree"
+	CodeBadMode    = "bad-tree-mode"
+	CodeBadSymlink = "bad-symlink"
+	// CodeWindowsName is for names Windows cannot represent
+	CodeWindowsName   = "windows-name"
+	CodeCaseCollision = "case-collision"
+)
+
+// windowsDevices are the names Windows keeps for devices, with any extension
+var windowsDevices = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// Modes of the tree entries git writes
+const (
+	regularMode    = 0100644
+	executableMode = 0100755
+	symlinkMode    = 0120000
+	treeMode       = 0040000
+	// gitlinkMode is the mode of a submodule tree entry, whose commit lives in
+	// another repository
+	gitlinkMode = 0160000
+)
+
+// maxSymlinkTarget is the longest symlink target accepted, PATH_MAX on linux
+const maxSymlinkTarget = 4096
+
+// symlink is a symlink entry of a tree, its target is checked once every
+// object of the pack is resolved
+type symlink struct {
+	tree   *Object
+	name   string
+	target oid.Oid
+}
+
+// treeChecker checks the entries of the trees of a pack while they resolve
+type treeChecker struct {
+	// blobSizes are the resolved sizes of the blobs, by object index
+	blobSizes []uint64
+
+	mu       sync.Mutex
+	findings []*finding.Finding
+	symlinks []*symlink
+}
+
+// WithTreeChecks checks the entries of every tree, like git fsck does: their
+// modes must be ones git writes, without setuid or sticky bits, and symlinks
+// must point to blobs that make a sane target. Names Windows cannot represent
+// and names of a tree differing only in case, which collide on
+// case-insensitive filesystems, are flagged too. What is wrong is reported as
+// a warning finding per entry.
+func WithTreeChecks(check bool) Option {
+	return func(pf *PackFile) {
+		pf.checkTrees = check
+	}
+}
+
+func newTreeChecker(objects int) *treeChecker {
+	return &treeChecker{
+		blobSizes: make([]uint64, objects),
+	}
+}
+
+// badMode tells what is wrong with the mode of a tree entry, "" if nothing
+func badMode(mode uint32) string {
+	switch mode {
+	case regularMode, executableMode, symlinkMode, treeMode, gitlinkMode:
+		return ""
+	}
+	if mode&07000 != 0 {
+		return "has setuid, setgid or sticky bits"
+	}
+	switch mode & 0170000 {
+	case 0100000, symlinkMode, treeMode, gitlinkMode:
+		return "has permission bits git does not write"
+	}
+	return "is of no file type git knows"
+}
+
+// badWindowsName tells why Windows cannot represent name, "" if it can
+func badWindowsName(name string) string {
+	base, _, _ := strings.Cut(name, ".")
+	switch {
+	case windowsDevices[strings.ToLower(strings.TrimRight(base, " "))]:
+		return "is a device name on Windows"
+	case strings.HasSuffix(name, ".") || strings.HasSuffix(name, " "):
+		return "ends with a dot or a space, which Windows drops"
+	case strings.ContainsAny(name, `<>:"\|?*`):
+		return "has a character Windows does not allow"
+	}
+	return ""
+}
+
+func (c *treeChecker) add(f *finding.Finding) {
+	c.mu.Lock()
+	c.findings = append(c.findings, f)
+	c.mu.Unlock()
+}
+
+// check looks at a resolved object, data is nil for a streamed one
+func (c *treeChecker) check(obj *Object, data []byte) {
+	switch obj.realType {
+	case ObjBlob:
+		size := obj.size
+		if data != nil {
+			size = uint64(len(data))
+		}
+		c.blobSizes[obj.index] = size
+		return
+	case ObjTree:
+	default:
+		return
+	}
+
+	entries, err := object.ParseTree(data)
+	if err != nil {
+		c.add(finding.New(finding.Warning, CodeBadTree, "tree cannot be parsed: %v", err).
+			WithOid(obj.oid).WithOffset(obj.offset))
+		return
+	}
+	byFold := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if reason := badWindowsName(entry.Name); reason != "" {
+			c.add(finding.New(finding.Warning, CodeWindowsName, "entry %q %s", entry.Name, reason).
+				WithOid(obj.oid).WithOffset(obj.offset).With("entry", entry.Name))
+		}
+		fold := strings.ToLower(entry.Name)
+		if other, ok := byFold[fold]; ok {
+			c.add(finding.New(finding.Warning, CodeCaseCollision, "entries %q and %q differ only in case", other, entry.Name).
+				WithOid(obj.oid).WithOffset(obj.offset).With("entry", entry.Name))
+		} else {
+			byFold[fold] = entry.Name
+		}
+		if reason := badMode(entry.Mode); reason != "" {
+			c.add(finding.New(finding.Warning, CodeBadMode, "entry %q has mode %06o, which %s", entry.Name, entry.Mode, reason).
+				WithOid(obj.oid).WithOffset(obj.offset).With("entry", entry.Name))
+		}
+		if entry.Mode == symlinkMode {
+			c.mu.Lock()
+			c.symlinks = append(c.symlinks, &symlink{tree: obj, name: entry.Name, target: entry.Oid})
+			c.mu.Unlock()
+		}
+	}
+}
+
+// checkSymlinks checks the targets of the symlinks found in the trees, those
+// outside the pack are left alone
+func (c *treeChecker) checkSymlinks(objects []*Object) {
+	byOid := make(map[oid.Oid]*Object, len(objects))
+	for _, obj := range objects {
+		byOid[obj.oid] = obj
+	}
+	for _, link := range c.symlinks {
+		target, ok := byOid[link.target]
+		if !ok {
+			continue
+		}
+		var reason string
+		switch size := c.blobSizes[target.index]; {
+		case target.realType != ObjBlob:
+			reason = "points to a " + target.realType.ContentType() + " instead of a blob"
+		case size == 0:
+			reason = "has an empty target"
+		case size > maxSymlinkTarget:
+			reason = "has a target longer than a path can be"
+		}
+		if reason != "" {
+			c.findings = append(c.findings, finding.New(finding.Warning, CodeBadSymlink, "symlink %q %s", link.name, reason).
+				WithOid(link.tree.oid).WithOffset(link.tree.offset).With("entry", link.name).With("target", link.target.String()))
+		}
+	}
+}
+
+// done returns the findings in pack order, so that they are the same for
+// any thread count
+func (c *treeChecker) done(objects []*Object) []*finding.Finding {
+	c.checkSymlinks(objects)
+	sort.SliceStable(c.findings, func(i, j int) bool {
+		return c.findings[i].Offset < c.findings[j].Offset
+	})
+	return c.findings
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package pack
+
+import "os"
+
+var processUmask os.FileMode = 022
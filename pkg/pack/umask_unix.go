@@ -0,0 +1,18 @@
+//go:build linux || darwin
+
+package pack
+
+import (
+	"os"
+	"syscall"
+)
+
+// processUmask is read once at startup, the umask can only be read by
+// setting it, which would race with files created later
+var processUmask = readUmask()
+
+func readUmask() os.FileMode {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return os.FileMode(mask)
+}
@@ -1,25 +1,109 @@
 package pack
 
-func Verify(packPath string) error {
-	packFile, err := NewPackFile(packPath)
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adlternative/git-miner/pkg/catalog"
+	"github.com/adlternative/git-miner/pkg/finding"
+	log "github.com/sirupsen/logrus"
+)
+
+func Verify(packPath string, opts ...Option) error {
+	packFile, err := NewPackFile(packPath, opts...)
 	if err != nil {
 		return err
 	}
-	err = packFile.ShowFileStat()
+	return packFile.verify(packPath)
+}
+
+// verify runs the checks of Verify on pf, named packPath in messages, and
+// closes it
+func (pf *PackFile) verify(packPath string) error {
+	defer pf.Close()
+	if pf.dropCache {
+		defer func() {
+			if err := pf.DropCache(); err != nil {
+				log.Printf(catalog.Format(catalog.DropCacheError), packPath, err)
+			}
+		}()
+	}
+	err := pf.ShowFileStat()
 	if err != nil {
 		return err
 	}
 
-	err = packFile.ParseHeader()
+	err = pf.ParseHeader()
 	if err != nil {
-		return err
+		return pf.markKnown(pf.checkChanged(err))
 	}
-	packFile.ShowHeader()
-	err = packFile.ParseObjects()
+	pf.ShowHeader()
+	err = pf.verifyObjects()
 	if err != nil {
+		return pf.markKnown(err)
+	}
+	pf.progress.showSummary()
+	pf.ShowObjects()
+	if p := pf.Producer(); p != nil {
+		log.Printf(catalog.Format(catalog.VerifyProducer), packPath, p.Name, p.Confidence*100, strings.Join(p.Evidence, "; "))
+	}
+	if s := pf.Signatures(); s != nil {
+		log.Printf(catalog.Format(catalog.VerifySignatures), packPath, s.SignedCommits, s.SignedCommits+s.UnsignedCommits,
+			s.SignedTags, s.SignedTags+s.UnsignedTags, s.Malformed)
+	}
+	pf.markKnown(nil)
+	for _, f := range pf.Findings() {
+		log.Printf(catalog.Format(catalog.Finding), f.String())
+	}
+	if err := pf.findingsError(); err != nil {
 		return err
 	}
-	packFile.ShowObjects()
+	if pf.writeMissing {
+		return pf.writeSidecars(packPath)
+	}
 
 	return nil
 }
+
+// findingsError returns an error for the findings WithSeverities made errors,
+// the known ones aside
+func (pf *PackFile) findingsError() error {
+	var failed []*finding.Finding
+	for _, f := range pf.Findings() {
+		if f.Severity >= finding.Error && !f.Known {
+			failed = append(failed, f)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d findings are errors, the first: %w", len(failed), failed[0])
+}
+
+// markKnown marks the findings in the baseline given by WithBaseline, err
+// comes back as a finding then
+func (pf *PackFile) markKnown(err error) error {
+	if pf.baseline == nil {
+		return err
+	}
+	pf.baseline.Mark(pf.Findings()...)
+	if err == nil {
+		return nil
+	}
+	f := AsFinding(err)
+	pf.baseline.Mark(f)
+	return f
+}
+
+func (pf *PackFile) verifyObjects() error {
+	err := pf.ParseObjects()
+	if err != nil {
+		return pf.checkChanged(err)
+	}
+	err = pf.ResolveObjects()
+	if err != nil {
+		return pf.checkChanged(err)
+	}
+	// a clean run over a pack that changed meanwhile proves nothing either
+	return pf.CheckUnchanged()
+}
@@ -0,0 +1,83 @@
+package pack
+
+import (
+	"errors"
+	"fmt"
+	"github.com/adlternative/git-miner/pkg/oid"
+	"strings"
+)
+
+var ErrRejected = errors.New("objects rejected")
+
+// Veto inspects every object of the pack once it is resolved and returns a
+// reason to reject it, or nil. data may be nil for objects of the big file
+// threshold or larger, which are hashed while streaming. A Veto is called
+// from several goroutines at once.
+type Veto func(id oid.Oid, _type ObjectType, data []byte) error
+
+// Rejection is an object a Veto rejected
+type Rejection struct {
+	Oid    oid.Oid
+	Offset uint64
+	Reason error
+}
+
+// RejectedError lists the objects a Veto rejected, in pack order. It wraps
+// ErrRejected.
+type RejectedError struct {
+	Rejections []*Rejection
+}
+
+// maxRejectionsShown bounds the rejections spelled out in the message
+const maxRejectionsShown = 5
+
+func (e *RejectedError) Error() string {
+	var reasons []string
+	for i, rejection := range e.Rejections {
+		if i == maxRejectionsShown {
+			reasons = append(reasons, fmt.Sprintf("and %d more", len(e.Rejections)-i))
+			break
+		}
+		reasons = append(reasons, fmt.Sprintf("%x: %v", rejection.Oid, rejection.Reason))
+	}
+	return fmt.Sprintf("%v: %d objects, %s", ErrRejected, len(e.Rejections), strings.Join(reasons, "; "))
+}
+
+func (e *RejectedError) Unwrap() error {
+	return ErrRejected
+}
+
+// WithVeto lets veto reject objects, so that the pack is not finalized
+func WithVeto(veto Veto) Option {
+	return func(pf *PackFile) {
+		pf.veto = veto
+	}
+}
+
+// vet runs the veto of the pack on a resolved object
+func (r *resolver) vet(obj *Object, data []byte) {
+	if r.pf.veto == nil {
+		return
+	}
+	if reason := r.pf.veto(obj.oid, obj.realType, data); reason != nil {
+		r.rejections[obj.index] = &Rejection{
+			Oid:    obj.oid,
+			Offset: obj.offset,
+			Reason: reason,
+		}
+	}
+}
+
+// rejected collects the rejections in pack order
+func (r *resolver) rejected() error {
+	var rejections []*Rejection
+	for _, rejection := range r.rejections {
+		if rejection != nil {
+			rejections = append(rejections, rejection)
+		}
+	}
+	if len(rejections) == 0 {
+		return nil
+	}
+	return &RejectedError{Rejections: rejections}
+}
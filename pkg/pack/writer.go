@@ -0,0 +1,225 @@
+//go:build !nowriter
+
+package pack
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/adlternative/git-miner/pkg/codec"
+	"github.com/adlternative/git-miner/pkg/oid"
+)
+
+// WriterEntry records where and how an object was written
+type WriterEntry struct {
+	Oid    oid.Oid
+	Offset uint64
+	CRC32  uint32
+}
+
+// Writer builds a version 2 pack, and the matching idx, from objects and
+// deltas handed to it in order.
+type Writer struct {
+	w          io.Writer
+	hasher     hash.Hash
+	offset     uint64
+	objectNums uint32
+	entries    []*WriterEntry
+	checksum   []byte
+}
+
+// NewWriter writes the header of a pack which will hold objectNums entries
+func NewWriter(w io.Writer, objectNums uint32) (*Writer, error) {
+	pw := &Writer{
+		w:          w,
+		hasher:     oidAlgorithm.New(),
+		objectNums: objectNums,
+	}
+
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(header[0:4], Signature)
+	binary.BigEndian.PutUint32(header[4:8], 2)
+	binary.BigEndian.PutUint32(header[8:12], objectNums)
+	if err := pw.write(header); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *Writer) write(buf []byte) error {
+	if _, err := pw.w.Write(buf); err != nil {
+		return err
+	}
+	pw.hasher.Write(buf)
+	pw.offset += uint64(len(buf))
+	return nil
+}
+
+func (pw *Writer) writeEntry(header []byte, data []byte, id oid.Oid) (*WriterEntry, error) {
+	if uint32(len(pw.entries)) >= pw.objectNums {
+		return nil, fmt.Errorf("pack already holds %d objects", pw.objectNums)
+	}
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	entry := &WriterEntry{
+		Oid:    id,
+		Offset: pw.offset,
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(header)
+	crc.Write(compressed.Bytes())
+	entry.CRC32 = crc.Sum32()
+
+	if err := pw.write(header); err != nil {
+		return nil, err
+	}
+	if err := pw.write(compressed.Bytes()); err != nil {
+		return nil, err
+	}
+	pw.entries = append(pw.entries, entry)
+	return entry, nil
+}
+
+// WriteObject writes a non-delta object
+func (pw *Writer) WriteObject(_type ObjectType, data []byte) (*WriterEntry, error) {
+	if _type.ContentType() == "" {
+		return nil, fmt.Errorf("cannot write %v as a non-delta object", _type)
+	}
+	return pw.writeEntry(codec.AppendEntryHeader(nil, uint8(_type), uint64(len(data))), data, HashObject(_type, data))
+}
+
+// WriteOfsDelta writes a delta against an entry already in this pack, id is
+// the id of the object the delta produces.
+func (pw *Writer) WriteOfsDelta(base *WriterEntry, delta []byte, id oid.Oid) (*WriterEntry, error) {
+	header := codec.AppendEntryHeader(nil, uint8(ObjOfsDelta), uint64(len(delta)))
+	header = codec.AppendOfsDistance(header, pw.offset-base.Offset)
+	return pw.writeEntry(header, delta, id)
+}
+
+// WriteRefDelta writes a delta against baseOid, which need not be in this pack
+func (pw *Writer) WriteRefDelta(baseOid oid.Oid, delta []byte, id oid.Oid) (*WriterEntry, error) {
+	header := codec.AppendEntryHeader(nil, uint8(ObjRefDelta), uint64(len(delta)))
+	header = append(header, baseOid.Bytes()...)
+	return pw.writeEntry(header, delta, id)
+}
+
+// WriteRawEntry copies an already encoded entry, header included, e.g. from
+// another pack. An ofs-delta can only be copied if its base keeps its distance.
+func (pw *Writer) WriteRawEntry(raw []byte, id oid.Oid) (*WriterEntry, error) {
+	if uint32(len(pw.entries)) >= pw.objectNums {
+		return nil, fmt.Errorf("pack already holds %d objects", pw.objectNums)
+	}
+
+	entry := &WriterEntry{
+		Oid:    id,
+		Offset: pw.offset,
+		CRC32:  crc32.ChecksumIEEE(raw),
+	}
+	if err := pw.write(raw); err != nil {
+		return nil, err
+	}
+	pw.entries = append(pw.entries, entry)
+	return entry, nil
+}
+
+// Close writes the trailing checksum and returns it
+func (pw *Writer) Close() ([]byte, error) {
+	if uint32(len(pw.entries)) != pw.objectNums {
+		return nil, fmt.Errorf("pack header promises %d objects, %d written", pw.objectNums, len(pw.entries))
+	}
+	checksum := pw.hasher.Sum(nil)
+	if _, err := pw.w.Write(checksum); err != nil {
+		return nil, err
+	}
+	pw.checksum = checksum
+	return checksum, nil
+}
+
+// WriteIdx writes a version 2 idx for the pack, Close must be called first
+func (pw *Writer) WriteIdx(w io.Writer) error {
+	if pw.checksum == nil {
+		return fmt.Errorf("pack is not closed yet")
+	}
+	return writeIdx(w, pw.entries, pw.checksum)
+}
+
+// writeIdx writes a version 2 idx of the entries of the pack with the given
+// checksum
+func writeIdx(w io.Writer, packEntries []*WriterEntry, packChecksum []byte) error {
+	entries := make([]*WriterEntry, len(packEntries))
+	copy(entries, packEntries)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Oid.Compare(entries[j].Oid) < 0
+	})
+
+	hasher := oidAlgorithm.New()
+	out := io.MultiWriter(w, hasher)
+	buf := make([]byte, 8)
+
+	binary.BigEndian.PutUint32(buf[0:4], IdxSignature)
+	binary.BigEndian.PutUint32(buf[4:8], 2)
+	if _, err := out.Write(buf); err != nil {
+		return err
+	}
+
+	fanout := make([]byte, idxFanoutSize)
+	for _, entry := range entries {
+		for i := int(entry.Oid.Bytes()[0]); i < 256; i++ {
+			binary.BigEndian.PutUint32(fanout[i*4:], binary.BigEndian.Uint32(fanout[i*4:])+1)
+		}
+	}
+	if _, err := out.Write(fanout); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if _, err := out.Write(entry.Oid.Bytes()); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		binary.BigEndian.PutUint32(buf[0:4], entry.CRC32)
+		if _, err := out.Write(buf[0:4]); err != nil {
+			return err
+		}
+	}
+
+	var largeOffsets []uint64
+	for _, entry := range entries {
+		offset := uint32(entry.Offset)
+		if entry.Offset >= idxLargeOffsetNeeded {
+			offset = idxLargeOffsetNeeded | uint32(len(largeOffsets))
+			largeOffsets = append(largeOffsets, entry.Offset)
+		}
+		binary.BigEndian.PutUint32(buf[0:4], offset)
+		if _, err := out.Write(buf[0:4]); err != nil {
+			return err
+		}
+	}
+	for _, offset := range largeOffsets {
+		binary.BigEndian.PutUint64(buf, offset)
+		if _, err := out.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	if _, err := out.Write(packChecksum); err != nil {
+		return err
+	}
+	_, err := w.Write(hasher.Sum(nil))
+	return err
+}
@@ -0,0 +1,169 @@
+package packfs
+
+import (
+	"archive/tar"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/adlternative/git-miner/pkg/oid"
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+// checkoutMode returns the permissions a checkout gives the file or
+// directory of n, rather than the read-only ones of the view
+func checkoutMode(n *node) fs.FileMode {
+	switch {
+	case n.kind == symlinkFile:
+		return 0777
+	case n.isDir(), n.kind == blobFile && n.mode&executableOK != 0:
+		return 0755
+	}
+	return 0644
+}
+
+// walk calls fn for n, named name, and for everything below it in the view
+func (f *FS) walk(n *node, name string, fn func(n *node, name string) error) error {
+	if err := fn(n, name); err != nil {
+		return err
+	}
+	if !n.isDir() {
+		return nil
+	}
+	children, err := f.children(n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	for _, child := range children {
+		if err := f.walk(child, path.Join(name, child.name), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkRoot walks the view below root, naming what it finds relative to root
+func (f *FS) walkRoot(root string, fn func(n *node, name string) error) error {
+	n, err := f.lookup(root)
+	if err != nil {
+		return &fs.PathError{Op: "open", Path: root, Err: err}
+	}
+	if !n.isDir() {
+		return fn(n, n.name)
+	}
+	return f.walk(n, ".", func(n *node, name string) error {
+		if name == "." {
+			return nil
+		}
+		return fn(n, name)
+	})
+}
+
+// WriteTar writes the view below root, e.g. commits/<oid> for the worktree
+// of a commit, as a tar archive to w. The blobs of worktrees go through the
+// Transformers like they read in the view, files get the modes of a checkout.
+func (f *FS) WriteTar(w io.Writer, root string) error {
+	tw := tar.NewWriter(w)
+	err := f.walkRoot(root, func(n *node, name string) error {
+		header := &tar.Header{Name: name, Mode: int64(checkoutMode(n)), Format: tar.FormatPAX}
+		if n.isDir() {
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+			return tw.WriteHeader(header)
+		}
+		data, err := f.content(n)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if n.kind == symlinkFile {
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = string(data)
+			return tw.WriteHeader(header)
+		}
+		header.Typeflag = tar.TypeReg
+		header.Size = int64(len(data))
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// Extract writes the view below root into the directory dir, which it
+// creates, like WriteTar does into an archive. Symlinks become symlinks.
+func (f *FS) Extract(dir string, root string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return f.walkRoot(root, func(n *node, name string) error {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if n.isDir() {
+			return os.Mkdir(target, checkoutMode(n))
+		}
+		data, err := f.content(n)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if n.kind == symlinkFile {
+			return os.Symlink(string(data), target)
+		}
+		return os.WriteFile(target, data, checkoutMode(n))
+	})
+}
+
+// WriteLoose writes every object of the pack into the objects directory dir
+// as a loose object, skipping those it already has. The transformers do not
+// apply: a loose object has to hash to its name, and git runs its own
+// filters when it checks one out.
+func (f *FS) WriteLoose(dir string) error {
+	for _, id := range f.objects {
+		if err := f.writeLoose(dir, id); err != nil {
+			return fmt.Errorf("object %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (f *FS) writeLoose(dir string, id oid.Oid) error {
+	hex := id.String()
+	path := filepath.Join(dir, hex[:2], hex[2:])
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	f.mu.Lock()
+	_type, data, err := f.source.ReadObject(id)
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if got := pack.HashObject(_type, data); got != id {
+		return fmt.Errorf("content hashes to %s", got)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	tmp, err := pack.CreateTempFile(filepath.Dir(path), pack.TmpObjPrefix)
+	if err != nil {
+		return err
+	}
+	defer tmp.Cleanup()
+	zw := zlib.NewWriter(tmp)
+	fmt.Fprintf(zw, "%s %d\x00", _type.ContentType(), len(data))
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return tmp.Commit(path)
+}
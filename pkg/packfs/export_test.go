@@ -0,0 +1,125 @@
+package packfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+// testCommit is the newest commit of testPack
+const testCommit = "commits/c1f813c9272c8b473454c4a3eb87c5807052eed0"
+
+var testWorktree = []string{"a.txt", "b.txt", "c.txt", "d.txt", "sub/", "sub/v"}
+
+func TestWriteTar(t *testing.T) {
+	f, err := New(testPack, WithTransformer(CRLF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	if err := f.WriteTar(&buf, testCommit); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	tr := tar.NewReader(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Mode != 0644 || bytes.Contains(bytes.ReplaceAll(data, []byte("\r\n"), nil), []byte("\n")) {
+			t.Errorf("%s has mode %o and LF line ends %q, want 644 and CRLF", header.Name, header.Mode, data)
+		}
+	}
+	if !reflect.DeepEqual(names, testWorktree) {
+		t.Errorf("tar has %q, want %q", names, testWorktree)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	f, err := New(testPack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dir := filepath.Join(t.TempDir(), "worktree")
+	if err := f.Extract(dir, testCommit); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range testWorktree {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		want, err := fs.ReadFile(f, testCommit+"/"+name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("extracted %s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestWriteLoose(t *testing.T) {
+	f, err := New(testPack, WithTransformer(CRLF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dir := t.TempDir()
+	if err := f.WriteLoose(dir); err != nil {
+		t.Fatal(err)
+	}
+	// a second run finds the objects there
+	if err := f.WriteLoose(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range f.objects {
+		hex := id.String()
+		file, err := os.Open(filepath.Join(dir, hex[:2], hex[2:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zlib.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loose, err := io.ReadAll(zr)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_type, data, err := f.source.ReadObject(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := append([]byte(fmt.Sprintf("%s %d\x00", _type.ContentType(), len(data))), data...)
+		if !bytes.Equal(loose, want) || pack.HashObject(_type, data) != id {
+			t.Errorf("loose object %s differs from the packed one", hex)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package packfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"syscall"
+	"time"
+
+	gofs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// cacheTimeout is how long the kernel may cache entries and attributes, the
+// content of a pack never changes
+const cacheTimeout = time.Hour
+
+// Mount serves fsys read-only through FUSE at dir, until the server returned
+// is unmounted. Root can mount without fusermount.
+func Mount(fsys fs.FS, dir string) (*fuse.Server, error) {
+	timeout := cacheTimeout
+	return gofs.Mount(dir, &fuseNode{fsys: fsys, name: "."}, &gofs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:           "git-miner",
+			Name:             "packfs",
+			DirectMount:      true,
+			DirectMountFlags: syscall.MS_RDONLY | syscall.MS_NOSUID | syscall.MS_NODEV,
+		},
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+	})
+}
+
+// fuseNode is a file or directory of fsys, by its name there
+type fuseNode struct {
+	gofs.Inode
+	fsys fs.FS
+	name string
+}
+
+var (
+	_ gofs.NodeLookuper   = (*fuseNode)(nil)
+	_ gofs.NodeGetattrer  = (*fuseNode)(nil)
+	_ gofs.NodeReaddirer  = (*fuseNode)(nil)
+	_ gofs.NodeOpener     = (*fuseNode)(nil)
+	_ gofs.NodeReadlinker = (*fuseNode)(nil)
+)
+
+func errno(err error) syscall.Errno {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, fs.ErrInvalid):
+		return syscall.EINVAL
+	}
+	return syscall.EIO
+}
+
+func fileMode(mode fs.FileMode) uint32 {
+	switch {
+	case mode.IsDir():
+		return syscall.S_IFDIR | uint32(mode.Perm())
+	case mode&fs.ModeSymlink != 0:
+		return syscall.S_IFLNK | uint32(mode.Perm())
+	}
+	return syscall.S_IFREG | uint32(mode.Perm())
+}
+
+func setAttr(out *fuse.Attr, info fs.FileInfo) {
+	out.Mode = fileMode(info.Mode())
+	out.Size = uint64(info.Size())
+	out.Blocks = (out.Size + 511) / 512
+	out.Nlink = 1
+}
+
+func (n *fuseNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*gofs.Inode, syscall.Errno) {
+	childName := path.Join(n.name, name)
+	info, err := fs.Stat(n.fsys, childName)
+	if err != nil {
+		return nil, errno(err)
+	}
+	setAttr(&out.Attr, info)
+	child := &fuseNode{fsys: n.fsys, name: childName}
+	return n.NewInode(ctx, child, gofs.StableAttr{Mode: out.Attr.Mode & syscall.S_IFMT}), 0
+}
+
+func (n *fuseNode) Getattr(ctx context.Context, f gofs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	info, err := fs.Stat(n.fsys, n.name)
+	if err != nil {
+		return errno(err)
+	}
+	setAttr(&out.Attr, info)
+	return 0
+}
+
+func (n *fuseNode) Readdir(ctx context.Context) (gofs.DirStream, syscall.Errno) {
+	entries, err := fs.ReadDir(n.fsys, n.name)
+	if err != nil {
+		return nil, errno(err)
+	}
+	list := make([]fuse.DirEntry, len(entries))
+	for i, entry := range entries {
+		list[i] = fuse.DirEntry{Name: entry.Name(), Mode: fileMode(entry.Type()) & syscall.S_IFMT}
+	}
+	return gofs.NewListDirStream(list), 0
+}
+
+// fuseFile holds the content of an open file, so that reads in chunks need
+// not read its object again
+type fuseFile struct {
+	data []byte
+}
+
+var _ gofs.FileReader = (*fuseFile)(nil)
+
+func (n *fuseNode) Open(ctx context.Context, flags uint32) (gofs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC|syscall.O_APPEND) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	data, err := fs.ReadFile(n.fsys, n.name)
+	if err != nil {
+		return nil, 0, errno(err)
+	}
+	return &fuseFile{data: data}, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+func (f *fuseFile) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	if off >= int64(len(f.data)) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(f.data)) {
+		end = int64(len(f.data))
+	}
+	return fuse.ReadResultData(f.data[off:end]), 0
+}
+
+func (n *fuseNode) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	target, err := fs.ReadFile(n.fsys, n.name)
+	if err != nil {
+		return nil, errno(err)
+	}
+	return target, 0
+}
@@ -0,0 +1,454 @@
+package packfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adlternative/git-miner/pkg/object"
+	"github.com/adlternative/git-miner/pkg/oid"
+	"github.com/adlternative/git-miner/pkg/pack"
+)
+
+// modes of tree entries
+const (
+	typeMask     = 0170000
+	treeType     = 0040000
+	symlinkType  = 0120000
+	gitlinkType  = 0160000
+	executableOK = 0100
+)
+
+type kind int
+
+const (
+	rootDir kind = iota
+	objectsDir
+	commitsDir
+	objectFile
+	// commitDir is the worktree of a commit, a treeDir once its tree is read
+	commitDir
+	treeDir
+	blobFile
+	symlinkFile
+	// gitlinkDir is a submodule, whose commit lives in another repository
+	gitlinkDir
+)
+
+type node struct {
+	kind kind
+	name string
+	id   oid.Oid
+	// mode is the tree entry mode of a blob, path that of a tree entry in its
+	// worktree
+	mode uint32
+	path string
+}
+
+func (n *node) isDir() bool {
+	switch n.kind {
+	case objectFile, blobFile, symlinkFile:
+		return false
+	}
+	return true
+}
+
+// FS is a read-only view of a pack through its idx, to browse its objects with
+// normal tools without extracting everything:
+//
+//	objects/<oid>      the content of each object
+//	commits/<oid>/...  the worktree of each commit
+//
+// Trees are directories and blobs files, submodules are empty directories.
+// Symlinks are not followed, opening one reads its target. Objects are read
+// when opened, a tree entry whose object is not in the pack fails to open.
+// The blobs of worktrees go through the Transformers, see WithTransformer.
+// WriteTar and Extract write the view out, WriteLoose its objects.
+type FS struct {
+	// mu serializes the reads of the pack
+	mu      sync.Mutex
+	source  *pack.PackObjectSource
+	objects []oid.Oid
+	commits []oid.Oid
+	sizes   map[oid.Oid]int64
+
+	packOptions  []pack.Option
+	transformers []Transformer
+	// transformedSizes are the sizes of worktree blobs after the transformers,
+	// which may depend on the path
+	transformedSizes map[blobPath]int64
+}
+
+type blobPath struct {
+	id   oid.Oid
+	path string
+}
+
+// Option configures an FS
+type Option func(f *FS)
+
+// WithPackOptions reads the pack with opts, e.g. pack.WithInflater
+func WithPackOptions(opts ...pack.Option) Option {
+	return func(f *FS) {
+		f.packOptions = append(f.packOptions, opts...)
+	}
+}
+
+// WithTransformer passes the blobs of worktrees through transformer, after
+// the transformers added before it. The objects/ files stay as they are in
+// the pack.
+func WithTransformer(transformer Transformer) Option {
+	return func(f *FS) {
+		f.transformers = append(f.transformers, transformer)
+	}
+}
+
+// New opens the pack and its idx, reading the entry headers to list its
+// commits
+func New(packPath string, opts ...Option) (*FS, error) {
+	f := &FS{
+		sizes:            make(map[oid.Oid]int64),
+		transformedSizes: make(map[blobPath]int64),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	source, err := pack.NewPackObjectSource(packPath, f.packOptions...)
+	if err != nil {
+		return nil, err
+	}
+	f.source = source
+	f.objects = source.Oids()
+	for _, id := range f.objects {
+		_type, err := source.TypeOf(id)
+		if err != nil {
+			source.Close()
+			return nil, fmt.Errorf("object %s: %w", id, err)
+		}
+		if _type == pack.ObjCommit {
+			f.commits = append(f.commits, id)
+		}
+	}
+	return f, nil
+}
+
+func (f *FS) Close() error {
+	return f.source.Close()
+}
+
+// read returns the content of an object of the pack
+func (f *FS) read(id oid.Oid) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, data, err := f.source.ReadObject(id)
+	if err != nil {
+		return nil, err
+	}
+	f.sizes[id] = int64(len(data))
+	return data, nil
+}
+
+// content returns the content of a file, that of a worktree blob after the
+// transformers
+func (f *FS) content(n *node) ([]byte, error) {
+	data, err := f.read(n.id)
+	if err != nil || n.kind != blobFile || len(f.transformers) == 0 {
+		return data, err
+	}
+	for _, transformer := range f.transformers {
+		if data, err = transformer.Transform(n.path, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", n.path, err)
+		}
+	}
+	f.mu.Lock()
+	f.transformedSizes[blobPath{n.id, n.path}] = int64(len(data))
+	f.mu.Unlock()
+	return data, nil
+}
+
+func (f *FS) size(n *node) (int64, error) {
+	f.mu.Lock()
+	size, ok := f.sizes[n.id]
+	if n.kind == blobFile && len(f.transformers) > 0 {
+		size, ok = f.transformedSizes[blobPath{n.id, n.path}]
+	}
+	f.mu.Unlock()
+	if ok {
+		return size, nil
+	}
+	data, err := f.content(n)
+	return int64(len(data)), err
+}
+
+// tree returns the entries of the tree of a commitDir or treeDir
+func (f *FS) tree(n *node) ([]*object.TreeEntry, error) {
+	id := n.id
+	if n.kind == commitDir {
+		data, err := f.read(id)
+		if err != nil {
+			return nil, err
+		}
+		commit, err := object.ParseCommit(data)
+		if err != nil {
+			return nil, fmt.Errorf("commit %s: %w", id, err)
+		}
+		trees := commit.Get("tree")
+		if len(trees) != 1 {
+			return nil, fmt.Errorf("commit %s has %d tree headers", id, len(trees))
+		}
+		if id, err = oid.FromHex(trees[0]); err != nil {
+			return nil, fmt.Errorf("commit %s: %w", n.id, err)
+		}
+	}
+	data, err := f.read(id)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := object.ParseTree(data)
+	if err != nil {
+		return nil, fmt.Errorf("tree %s: %w", id, err)
+	}
+	return entries, nil
+}
+
+// entryNode returns the node of a tree entry of the directory dir
+func entryNode(dir *node, entry *object.TreeEntry) *node {
+	n := &node{name: entry.Name, id: entry.Oid, mode: entry.Mode, path: path.Join(dir.path, entry.Name)}
+	switch entry.Mode & typeMask {
+	case treeType:
+		n.kind = treeDir
+	case symlinkType:
+		n.kind = symlinkFile
+	case gitlinkType:
+		n.kind = gitlinkDir
+	default:
+		n.kind = blobFile
+	}
+	return n
+}
+
+// find returns the node named hex out of ids, which are sorted
+func find(ids []oid.Oid, hex string, kind kind) (*node, error) {
+	id, err := oid.FromHex(hex)
+	if err != nil {
+		return nil, fs.ErrNotExist
+	}
+	i := sort.Search(len(ids), func(i int) bool {
+		return ids[i].Compare(id) >= 0
+	})
+	if i == len(ids) || ids[i] != id {
+		return nil, fs.ErrNotExist
+	}
+	return &node{kind: kind, name: hex, id: id}, nil
+}
+
+func (f *FS) children(n *node) ([]*node, error) {
+	var children []*node
+	switch n.kind {
+	case rootDir:
+		children = []*node{{kind: commitsDir, name: "commits"}, {kind: objectsDir, name: "objects"}}
+	case objectsDir:
+		for _, id := range f.objects {
+			children = append(children, &node{kind: objectFile, name: id.String(), id: id})
+		}
+	case commitsDir:
+		for _, id := range f.commits {
+			children = append(children, &node{kind: commitDir, name: id.String(), id: id})
+		}
+	case commitDir, treeDir:
+		entries, err := f.tree(n)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			children = append(children, entryNode(n, entry))
+		}
+	}
+	return children, nil
+}
+
+func (f *FS) child(n *node, name string) (*node, error) {
+	switch n.kind {
+	case objectsDir:
+		return find(f.objects, name, objectFile)
+	case commitsDir:
+		return find(f.commits, name, commitDir)
+	case commitDir, treeDir:
+		entries, err := f.tree(n)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.Name == name {
+				return entryNode(n, entry), nil
+			}
+		}
+		return nil, fs.ErrNotExist
+	}
+	children, err := f.children(n)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if child.name == name {
+			return child, nil
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (f *FS) lookup(name string) (*node, error) {
+	if !fs.ValidPath(name) {
+		return nil, fs.ErrInvalid
+	}
+	n := &node{kind: rootDir, name: "."}
+	if name == "." {
+		return n, nil
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if !n.isDir() {
+			return nil, fs.ErrNotExist
+		}
+		child, err := f.child(n, elem)
+		if err != nil {
+			return nil, err
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// nodeInfo returns the fileInfo of n but for the size of a file
+func nodeInfo(n *node) *fileInfo {
+	info := &fileInfo{name: n.name}
+	switch n.kind {
+	case objectFile, blobFile:
+		info.mode = 0444
+		if n.kind == blobFile && n.mode&executableOK != 0 {
+			info.mode = 0555
+		}
+	case symlinkFile:
+		info.mode = fs.ModeSymlink | 0777
+	default:
+		info.mode = fs.ModeDir | 0555
+	}
+	return info
+}
+
+func (f *FS) stat(n *node) (*fileInfo, error) {
+	info := nodeInfo(n)
+	if n.isDir() {
+		return info, nil
+	}
+	size, err := f.size(n)
+	if err != nil {
+		return nil, err
+	}
+	info.size = size
+	return info, nil
+}
+
+// Open opens a file or directory of the view, see FS
+func (f *FS) Open(name string) (fs.File, error) {
+	n, err := f.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info := nodeInfo(n)
+	if n.isDir() {
+		children, err := f.children(n)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		d := &dir{info: info}
+		for _, child := range children {
+			d.entries = append(d.entries, &dirEntry{fsys: f, node: child})
+		}
+		return d, nil
+	}
+	// the size is that of the content, which is read only once
+	data, err := f.content(n)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info.size = int64(len(data))
+	return &file{info: info, Reader: bytes.NewReader(data)}, nil
+}
+
+type fileInfo struct {
+	name string
+	mode fs.FileMode
+	size int64
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *fileInfo) ModTime() time.Time { return time.Time{} }
+func (i *fileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *fileInfo) Sys() interface{}   { return nil }
+
+// dirEntry stats its node only when asked, listing objects/ reads no object
+type dirEntry struct {
+	fsys *FS
+	node *node
+}
+
+func (e *dirEntry) Name() string { return e.node.name }
+func (e *dirEntry) IsDir() bool  { return e.node.isDir() }
+
+func (e *dirEntry) Type() fs.FileMode {
+	switch {
+	case e.node.isDir():
+		return fs.ModeDir
+	case e.node.kind == symlinkFile:
+		return fs.ModeSymlink
+	}
+	return 0
+}
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	return e.fsys.stat(e.node)
+}
+
+type file struct {
+	info *fileInfo
+	*bytes.Reader
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+type dir struct {
+	info    *fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) ReadDir(count int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if count > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		if count < len(entries) {
+			entries = entries[:count]
+		}
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
@@ -0,0 +1,74 @@
+package packfs
+
+import (
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// testPack is a git pack of six commits of four growing files and a tag
+const testPack = "../pack/testdata/producer-git.pack"
+
+func TestFS(t *testing.T) {
+	f, err := New(testPack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if len(f.commits) != 6 {
+		t.Fatalf("found %d commits, want 6", len(f.commits))
+	}
+	if err := fstest.TestFS(f, "commits", "objects", "objects/"+f.objects[0].String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenReadsOnce(t *testing.T) {
+	var mu sync.Mutex
+	transforms := make(map[string]int)
+	f, err := New(testPack, WithTransformer(TransformerFunc(func(path string, data []byte) ([]byte, error) {
+		mu.Lock()
+		transforms[path]++
+		mu.Unlock()
+		return data, nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	root := "commits/" + f.commits[0].String()
+	files := 0
+	err = fs.WalkDir(f, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		files++
+		transforms = make(map[string]int)
+		file, err := f.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		data := make([]byte, info.Size()+1)
+		n, _ := file.Read(data)
+		if int64(n) != info.Size() {
+			t.Errorf("%s: read %d bytes, stat says %d", name, n, info.Size())
+		}
+		if calls := transforms[name[len(root)+1:]]; calls != 1 {
+			t.Errorf("opening %s read its blob %d times, want once", name, calls)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files == 0 {
+		t.Fatalf("no files in %s", root)
+	}
+}
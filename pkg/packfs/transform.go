@@ -0,0 +1,167 @@
+package packfs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Transformer rewrites the content of the blobs of worktrees, so that they
+// read like a checkout does after git's filters. path is the slash separated
+// path of the blob in its worktree. It is called from several goroutines at
+// once.
+type Transformer interface {
+	Transform(path string, data []byte) ([]byte, error)
+}
+
+// TransformerFunc adapts a function to Transformer
+type TransformerFunc func(path string, data []byte) ([]byte, error)
+
+func (f TransformerFunc) Transform(path string, data []byte) ([]byte, error) {
+	return f(path, data)
+}
+
+// textStats counts what git's convert.c looks at to tell text from binary
+type textStats struct {
+	nul, loneCR, loneLF, crlf int
+	printable, nonPrintable   int
+}
+
+func gatherStats(data []byte) textStats {
+	var stats textStats
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '\r':
+			if i+1 < len(data) && data[i+1] == '\n' {
+				stats.crlf++
+				i++
+			} else {
+				stats.loneCR++
+			}
+		case c == '\n':
+			stats.loneLF++
+		case c == 127:
+			stats.nonPrintable++
+		case c == '\b' || c == '\t' || c == '\033' || c == '\014':
+			stats.printable++
+		case c == 0:
+			stats.nul++
+			stats.nonPrintable++
+		case c < 32:
+			stats.nonPrintable++
+		default:
+			stats.printable++
+		}
+	}
+	// a trailing DOS end of file mark does not count
+	if len(data) > 0 && data[len(data)-1] == '\032' {
+		stats.nonPrintable--
+	}
+	return stats
+}
+
+// isBinary is convert_is_binary of git: a lone CR, a NUL or more than one
+// non-printable character per 128 printable ones make a file binary
+func (s textStats) isBinary() bool {
+	return s.loneCR > 0 || s.nul > 0 || s.printable>>7 < s.nonPrintable
+}
+
+// CRLF turns the LF line ends of text files into CRLF, like core.autocrlf=true
+// on checkout. It leaves alone what git does: files without a lone LF,
+// binary files as git tells them apart, files already holding a CR and Git
+// LFS pointers, which git lfs marks -text. It goes before LFS to leave the
+// objects of the pointers alone too.
+var CRLF Transformer = TransformerFunc(func(path string, data []byte) ([]byte, error) {
+	stats := gatherStats(data)
+	if stats.loneLF == 0 || stats.crlf > 0 || stats.isBinary() {
+		return data, nil
+	}
+	if _, _, ok := parseLFSPointer(data); ok {
+		return data, nil
+	}
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n")), nil
+})
+
+// lfsVersion is the first line of a Git LFS pointer file
+const lfsVersion = "version https://git-lfs.github.com/spec/v1"
+
+// maxLFSPointer is the size above which git lfs does not take a file for a
+// pointer
+const maxLFSPointer = 1024
+
+// LFSFetch returns the content of a Git LFS object by its sha256 object id
+// in hex and its size, fs.ErrNotExist if it has none
+type LFSFetch func(oid string, size int64) ([]byte, error)
+
+// parseLFSPointer returns the object id and size of a Git LFS pointer file,
+// ok is false for any other content
+func parseLFSPointer(data []byte) (oid string, size int64, ok bool) {
+	if len(data) > maxLFSPointer || !bytes.HasPrefix(data, []byte(lfsVersion+"\n")) {
+		return "", 0, false
+	}
+	size = -1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		switch key {
+		case "oid":
+			oid = strings.TrimPrefix(value, "sha256:")
+			if _, err := hex.DecodeString(oid); err != nil || len(oid) != 2*sha256.Size || oid == value {
+				return "", 0, false
+			}
+		case "size":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return "", 0, false
+			}
+			size = n
+		}
+	}
+	return oid, size, oid != "" && size >= 0
+}
+
+// LFS replaces Git LFS pointer files with the content fetch returns for them,
+// like the smudge filter of git lfs. A pointer whose object fetch does not
+// have stays as it is, as it does in a checkout without the object.
+func LFS(fetch LFSFetch) Transformer {
+	return TransformerFunc(func(path string, data []byte) ([]byte, error) {
+		oid, size, ok := parseLFSPointer(data)
+		if !ok {
+			return data, nil
+		}
+		content, err := fetch(oid, size)
+		if errors.Is(err, fs.ErrNotExist) {
+			return data, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("lfs object %s: %w", oid, err)
+		}
+		return content, nil
+	})
+}
+
+// LFSObjects fetches Git LFS objects from a .git/lfs/objects directory,
+// checking their size and sha256
+func LFSObjects(dir string) LFSFetch {
+	return func(oid string, size int64) ([]byte, error) {
+		content, err := os.ReadFile(filepath.Join(dir, oid[0:2], oid[2:4], oid))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(content)) != size {
+			return nil, fmt.Errorf("has %d bytes, the pointer says %d", len(content), size)
+		}
+		if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != oid {
+			return nil, fmt.Errorf("has sha256 %x", sum)
+		}
+		return content, nil
+	}
+}
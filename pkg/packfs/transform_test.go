@@ -0,0 +1,40 @@
+package packfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCRLF(t *testing.T) {
+	pointer := lfsVersion + "\noid sha256:" + string(bytes.Repeat([]byte("ab"), 32)) + "\nsize 12\n"
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "text", data: "a\nb\n", want: "a\r\nb\r\n"},
+		{name: "no line end", data: "a", want: "a"},
+		{name: "empty", data: "", want: ""},
+		{name: "has crlf", data: "a\r\nb\n", want: "a\r\nb\n"},
+		// git's convert_is_binary takes a lone CR for binary, even in text
+		{name: "lone cr", data: "a\rb\n", want: "a\rb\n"},
+		{name: "nul", data: "a\x00b\n", want: "a\x00b\n"},
+		{name: "nul past 8000 bytes", data: string(bytes.Repeat([]byte("a\n"), 5000)) + "\x00", want: string(bytes.Repeat([]byte("a\n"), 5000)) + "\x00"},
+		{name: "non-printable", data: "\x01\x02\n", want: "\x01\x02\n"},
+		{name: "few non-printable", data: string(bytes.Repeat([]byte("a"), 128)) + "\x01\n", want: string(bytes.Repeat([]byte("a"), 128)) + "\x01\r\n"},
+		{name: "tabs and escapes", data: "\t\b\033\014\n", want: "\t\b\033\014\r\n"},
+		{name: "dos end of file", data: "abc\n\032", want: "abc\r\n\032"},
+		{name: "lfs pointer", data: pointer, want: pointer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CRLF.Transform("file", []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("CRLF(%q) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}